@@ -0,0 +1,130 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// minRepeat is the shortest run of a fill character that accessible
+// output replaces by a count.
+const minRepeat = 4
+
+// plainRune returns the plain punctuation standing in for the box
+// drawing or leader character r, or r itself.
+func plainRune(r rune) rune {
+	switch r {
+	case 0x2500, 0x2501, 0x2504, 0x2505, 0x2508, 0x2509, 0x254C, 0x254D,
+		0x2550, 0x2574, 0x2576, 0x2578, 0x257A, 0x257C, 0x257E:
+		return '-'
+	case 0x2502, 0x2503, 0x2506, 0x2507, 0x250A, 0x250B, 0x254E, 0x254F,
+		0x2551, 0x2575, 0x2577, 0x2579, 0x257B, 0x257D, 0x257F:
+		return '|'
+	case '·', '‥', '․', '・', '･':
+		return '.'
+	case '＿':
+		return '_'
+	case '　': // IDEOGRAPHIC SPACE
+		return ' '
+	}
+	if 0x2500 <= r && r <= 0x257F {
+		return '+' // corners, junctions and crossings
+	}
+	return r
+}
+
+// isFill reports whether runs of r are used to pad or rule output.
+func isFill(r rune) bool {
+	return strings.ContainsRune(".-=_*~+#|", r)
+}
+
+// accessible rewrites s for screen readers: box drawing and leader
+// characters become plain punctuation, runs of spaces collapse into one,
+// and longer runs of a fill character, such as the dots of a leader or
+// the dashes of a rule, become the character and a count, as in "-×40".
+// Escape sequences are kept.
+func (c *Condition) accessible(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	run, count := rune(-1), 0
+	flush := func() {
+		switch {
+		case count == 0:
+		case run == ' ':
+			b.WriteByte(' ')
+		case count >= minRepeat:
+			b.WriteRune(run)
+			b.WriteString("×")
+			b.WriteString(strconv.Itoa(count))
+		default:
+			b.WriteString(strings.Repeat(string(run), count))
+		}
+		run, count = -1, 0
+	}
+	scale := 1
+	for i := 0; i < len(s); {
+		if n := c.seqLen(s[i:], &scale); n > 0 {
+			flush()
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r == '…' {
+			r = '.'
+			if run != r {
+				flush()
+			}
+			run, count = r, count+3
+			continue
+		}
+		r = plainRune(r)
+		if r == run {
+			count++
+			continue
+		}
+		flush()
+		if r == ' ' || isFill(r) {
+			run, count = r, 1
+			continue
+		}
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String()
+}
+
+// Linearize returns the rows of a table as "column: value" lines, one
+// line per cell and a blank line between rows, which a screen reader
+// reads more easily than aligned columns. Cells without a heading are
+// labeled by their column number, and empty cells are left out.
+func Linearize(header []string, rows [][]string) string {
+	var b strings.Builder
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		for j, cell := range row {
+			if cell == "" {
+				continue
+			}
+			name := ""
+			if j < len(header) {
+				name = header[j]
+			}
+			if name == "" {
+				name = "Column " + strconv.Itoa(j+1)
+			}
+			b.WriteString(name)
+			b.WriteString(": ")
+			b.WriteString(cell)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
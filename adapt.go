@@ -0,0 +1,33 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import stdfmt "fmt"
+
+// adapted formats its value with a Printer when formatted by package fmt.
+type adapted struct {
+	pr *Printer
+	v  interface{}
+}
+
+func (a adapted) Format(f stdfmt.State, verb rune) {
+	a.pr.Fprintf(f, FormatString(f, verb), a.v)
+}
+
+// Adapt returns v wrapped so that package fmt formats it as wfmt does,
+// computing widths and precisions in display columns. It fixes the
+// alignment of text printed by code that uses package fmt:
+//
+//	fmt.Printf("%-10s|\n", wfmt.Adapt("日本語"))
+//
+// prints the name padded to 10 columns rather than 10 runes.
+func Adapt(v interface{}) stdfmt.Formatter {
+	return adapted{new(Printer), v}
+}
+
+// Adapt is like the package-level Adapt but formats v with pr.
+func (pr *Printer) Adapt(v interface{}) stdfmt.Formatter {
+	return adapted{pr, v}
+}
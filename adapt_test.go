@@ -0,0 +1,40 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+var adaptTests = []struct {
+	format string
+	v      interface{}
+	out    string
+}{
+	{"[%-6s]", "日本", "[日本  ]"},
+	{"[%6s]", "日本", "[  日本]"},
+	{"[%6.1s]", "日本", "[    日]"},
+	{"[%v]", "日本", "[日本]"},
+	{"[%05d]", 42, "[00042]"},
+	{"[%+.2f]", 1.5, "[+1.50]"},
+	{"[%q]", "日本", `["日本"]`},
+	{"[%#v]", []string{"日本"}, `[[]string{"日本"}]`},
+	{"[%-6v]", []string{"日本"}, "[[日本  ]]"},
+}
+
+func TestAdapt(t *testing.T) {
+	pr := &Printer{Condition: &Condition{}}
+	for _, tt := range adaptTests {
+		if got := fmt.Sprintf(tt.format, pr.Adapt(tt.v)); got != tt.out {
+			t.Errorf("fmt.Sprintf(%q, Adapt(%#v)) = %q want %q", tt.format, tt.v, got, tt.out)
+		}
+	}
+	if got, want := fmt.Sprintf("%-6s|", Adapt("ab")), "ab    |"; got != want {
+		t.Errorf("fmt.Sprintf with Adapt = %q want %q", got, want)
+	}
+}
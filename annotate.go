@@ -0,0 +1,65 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// A FieldLayout describes where a formatted operand was rendered, so
+// that tests can assert the alignment of output without parsing it.
+// Positions are relative to the output of a single call and refer to
+// the text before any wrapping or accessible rewriting by the Printer.
+type FieldLayout struct {
+	Arg    int    `json:"arg"`    // index of the operand
+	Verb   string `json:"verb"`   // verb it was formatted with
+	Line   int    `json:"line"`   // line the field starts on, from 0
+	Column int    `json:"column"` // cell the field starts at, from 0
+	Width  int    `json:"width"`  // width in cells, including padding
+	Text   string `json:"text"`   // the rendered field
+}
+
+// layout returns the layout of the operands recorded in p.
+func (pr *Printer) layout(p *pp) []FieldLayout {
+	c := pr.cond()
+	fields := make([]FieldLayout, 0, len(p.spans))
+	for _, sp := range p.spans {
+		before := string(p.buf[:sp.start])
+		lineStart := strings.LastIndexByte(before, '\n') + 1
+		text := string(p.buf[sp.start:sp.end])
+		fields = append(fields, FieldLayout{
+			Arg:    sp.arg,
+			Verb:   string(sp.verb),
+			Line:   strings.Count(before, "\n"),
+			Column: c.StringWidth(before[lineStart:]),
+			Width:  c.StringWidth(text),
+			Text:   text,
+		})
+	}
+	return fields
+}
+
+// writeAnnotations writes the layout of the operands recorded in p to
+// pr.Annotations as a JSON array on a line of its own.
+func (pr *Printer) writeAnnotations(p *pp) {
+	b, err := json.Marshal(pr.layout(p))
+	if err != nil {
+		return
+	}
+	pr.Annotations.Write(append(b, '\n'))
+}
+
+// Layoutf formats according to a format specifier and returns the
+// resulting string together with the layout of each operand.
+func (pr *Printer) Layoutf(format string, a ...interface{}) (string, []FieldLayout) {
+	p := pr.newPrinter()
+	p.annotate = true
+	p.doPrintf(format, a)
+	fields := pr.layout(p)
+	s := string(p.buf)
+	p.free()
+	return s, fields
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrWidth is returned by the write methods of a WidthBuilder when the
+// text does not fit in the remaining width.
+var ErrWidth = errors.New("wfmt: text exceeds the width budget")
+
+// A WidthBuilder builds a string, like strings.Builder, within a budget
+// of display columns, so that a status bar or a table cell composed of
+// several parts never overflows. The zero value has no budget to write
+// in; use NewWidthBuilder.
+type WidthBuilder struct {
+	// Condition measures text; DefaultCondition if nil.
+	Condition *Condition
+	// Strict makes a write that does not fit fail without writing
+	// anything instead of writing as much of the text as fits.
+	Strict bool
+	// Tail marks text cut short by a write; "…" if empty.
+	Tail string
+
+	b     strings.Builder
+	max   int
+	width int
+	full  bool
+}
+
+// NewWidthBuilder returns an empty WidthBuilder with a budget of max
+// columns.
+func NewWidthBuilder(max int) *WidthBuilder {
+	return &WidthBuilder{max: max}
+}
+
+func (w *WidthBuilder) cond() *Condition {
+	if w.Condition != nil {
+		return w.Condition
+	}
+	return DefaultCondition
+}
+
+// WriteString appends s if it fits in the remaining width. Otherwise it
+// returns ErrWidth after appending as much of s as fits followed by
+// Tail, after which the builder is full; in Strict mode it appends
+// nothing. It returns the number of bytes appended.
+func (w *WidthBuilder) WriteString(s string) (n int, err error) {
+	c := w.cond()
+	if w.full {
+		return 0, ErrWidth
+	}
+	if sw := c.StringWidth(s); w.width+sw <= w.max {
+		w.b.WriteString(s)
+		w.width += sw
+		return len(s), nil
+	}
+	if w.Strict {
+		return 0, ErrWidth
+	}
+	tail := w.Tail
+	if tail == "" {
+		tail = ellipsis
+	}
+	t := c.Truncate(s, w.max-w.width, tail)
+	w.b.WriteString(t)
+	w.width += c.StringWidth(t)
+	w.full = true
+	return len(t), ErrWidth
+}
+
+// Writef formats according to a format specifier and appends the result
+// as WriteString does.
+func (w *WidthBuilder) Writef(format string, a ...interface{}) (n int, err error) {
+	pr := Printer{Condition: w.cond()}
+	return w.WriteString(pr.Sprintf(format, a...))
+}
+
+// String returns the accumulated string.
+func (w *WidthBuilder) String() string {
+	return w.b.String()
+}
+
+// Len returns the number of accumulated bytes.
+func (w *WidthBuilder) Len() int {
+	return w.b.Len()
+}
+
+// Width returns the number of columns occupied by the accumulated string.
+func (w *WidthBuilder) Width() int {
+	return w.width
+}
+
+// Remaining returns the number of columns left in the budget.
+func (w *WidthBuilder) Remaining() int {
+	if w.full || w.width > w.max {
+		return 0
+	}
+	return w.max - w.width
+}
+
+// Reset empties the builder, keeping its budget.
+func (w *WidthBuilder) Reset() {
+	w.b.Reset()
+	w.width, w.full = 0, false
+}
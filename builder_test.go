@@ -0,0 +1,56 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestWidthBuilder(t *testing.T) {
+	w := NewWidthBuilder(12)
+	w.Condition = &Condition{}
+	if _, err := w.Writef("%-6s", "状态"); err != nil {
+		t.Fatalf("Writef: %v", err)
+	}
+	if _, err := w.WriteString("\x1b[32mok\x1b[0m"); err != nil {
+		t.Fatalf("WriteString: %v", err)
+	}
+	if got := w.Remaining(); got != 4 {
+		t.Errorf("Remaining() = %d want 4", got)
+	}
+	if _, err := w.WriteString(" 同步中"); err != ErrWidth {
+		t.Errorf("overflowing WriteString returned %v want ErrWidth", err)
+	}
+	if got, want := w.String(), "状态  \x1b[32mok\x1b[0m 同…"; got != want {
+		t.Errorf("String() = %+q want %+q", got, want)
+	}
+	if w.Width() != 12 || w.Remaining() != 0 {
+		t.Errorf("Width() = %d, Remaining() = %d want 12, 0", w.Width(), w.Remaining())
+	}
+	if n, err := w.WriteString("x"); n != 0 || err != ErrWidth {
+		t.Errorf("WriteString on a full builder = %d, %v", n, err)
+	}
+	w.Reset()
+	if w.Len() != 0 || w.Remaining() != 12 {
+		t.Errorf("after Reset Len() = %d, Remaining() = %d", w.Len(), w.Remaining())
+	}
+}
+
+func TestWidthBuilderStrict(t *testing.T) {
+	w := NewWidthBuilder(5)
+	w.Strict = true
+	w.WriteString("abc")
+	if n, err := w.WriteString("def"); n != 0 || err != ErrWidth {
+		t.Errorf("WriteString = %d, %v want 0, ErrWidth", n, err)
+	}
+	if _, err := w.WriteString("de"); err != nil {
+		t.Errorf("WriteString of fitting text: %v", err)
+	}
+	if got := w.String(); got != "abcde" {
+		t.Errorf("String() = %q want %q", got, "abcde")
+	}
+}
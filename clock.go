@@ -0,0 +1,130 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock makes the tickers that time the helpers that depend on time,
+// such as Spinner. Replacing it with a FrozenClock makes their output
+// reproducible in tests.
+type Clock interface {
+	NewTicker(d time.Duration) Ticker
+}
+
+// A Ticker delivers ticks at intervals, like time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock of the time package.
+var SystemClock Clock = systemClock{}
+
+// DefaultClock is the Clock used by helpers that are not given one.
+var DefaultClock = SystemClock
+
+type systemClock struct{}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	t *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
+
+// A FrozenClock is a Clock that stands still until it is advanced. Its
+// tickers fire only from Advance, which waits for each tick to be
+// received, so that everything a tick triggers happens in order.
+type FrozenClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*frozenTicker
+}
+
+// NewFrozenClock returns a FrozenClock stopped at t.
+func NewFrozenClock(t time.Time) *FrozenClock {
+	return &FrozenClock{now: t}
+}
+
+// Now returns the time the clock is stopped at, so that a test can
+// check how far it was advanced.
+func (c *FrozenClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker returns a Ticker that fires every d of advanced time.
+func (c *FrozenClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("wfmt: non-positive interval for NewTicker")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &frozenTicker{
+		clock:  c,
+		c:      make(chan time.Time),
+		period: d,
+		next:   c.now.Add(d),
+		done:   make(chan struct{}),
+	}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d and delivers the ticks that
+// fall due, in order, waiting for each to be received or for its ticker
+// to be stopped. Advance must not be called concurrently.
+func (c *FrozenClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	tickers := append([]*frozenTicker(nil), c.tickers...)
+	c.mu.Unlock()
+	for _, t := range tickers {
+	ticks:
+		for !t.next.After(now) {
+			select {
+			case t.c <- t.next:
+				t.next = t.next.Add(t.period)
+			case <-t.done:
+				break ticks
+			}
+		}
+	}
+}
+
+type frozenTicker struct {
+	clock  *FrozenClock
+	c      chan time.Time
+	period time.Duration
+	next   time.Time // guarded by the caller of Advance
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (t *frozenTicker) C() <-chan time.Time { return t.c }
+
+func (t *frozenTicker) Stop() {
+	t.once.Do(func() {
+		close(t.done)
+		c := t.clock
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, other := range c.tickers {
+			if other == t {
+				c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+				break
+			}
+		}
+	})
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "strings"
+
+// dbcsLatin1 lists, for each CJK console code page, the ambiguous
+// Latin-1 characters the code page encodes as double-byte. A legacy
+// Windows console shows a character in as many cells as it has bytes in
+// the output code page, and those not listed here are single-byte or
+// replaced by a single-byte best fit, such as e for é in code page 932.
+var dbcsLatin1 = map[int]string{
+	932:   "§¨°±´¶×÷",
+	936:   "¤§¨°±·×àáèéêìíòóùúü÷",
+	949:   "¡¤§¨ª°±²³´¶·¸¹º¼½¾¿ÆÐ×ØÞßæð÷øþ",
+	950:   "§°±·×÷",
+	51932: "§¨°±´¶×÷",
+}
+
+// codePageWidth returns the number of cells r occupies on a legacy
+// console using one of the cjkCodePages, if it differs from that of an
+// East Asian terminal. ok is false if it does not.
+func codePageWidth(cp int, r rune) (width int, ok bool) {
+	switch {
+	case 0xA1 <= r && r <= 0xFF:
+		if strings.ContainsRune(dbcsLatin1[cp], r) {
+			return 2, true
+		}
+		return 1, true
+	case 0xFF61 <= r && r <= 0xFFDC, 0xFFE8 <= r && r <= 0xFFEE:
+		// Halfwidth katakana, Hangul and forms are single-byte or
+		// shown as such.
+		return 1, true
+	case r > 0xFFFF:
+		// The console stores the two UTF-16 surrogates in a cell each.
+		return 2, true
+	}
+	return 0, false
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "io"
+
+// ColumnFlags control the formatting of a ColumnWriter.
+type ColumnFlags uint
+
+const (
+	// ColumnAlignRight right-aligns the cells of a column rather than
+	// left-aligning them.
+	ColumnAlignRight ColumnFlags = 1 << iota
+	// ColumnDiscardEmpty drops columns whose cells are all empty, as if
+	// their tabs were not there.
+	ColumnDiscardEmpty
+	// ColumnDebug writes a vertical bar between columns.
+	ColumnDebug
+)
+
+// A colCell is a tab-terminated cell of a ColumnWriter, or the text after
+// the last tab of a line.
+type colCell struct {
+	text  string
+	width int // in cells
+}
+
+// A ColumnWriter is a filter, modeled on text/tabwriter, that aligns the
+// tab-terminated cells of consecutive lines in columns. Unlike
+// text/tabwriter it measures cells in display cells, as the Condition
+// does, so columns of CJK text, emoji and text colored with ANSI
+// sequences line up on a terminal.
+//
+// As with text/tabwriter, a cell is text terminated by a tab; the text
+// after the last tab of a line is not part of a column. A column block
+// is a run of adjacent lines with a cell in that column, and is as wide
+// as its widest cell plus the padding. A line without tabs ends all
+// blocks, and the lines before it are written out. Call Flush after the
+// last Write.
+type ColumnWriter struct {
+	// Condition measures cells; DefaultCondition if nil.
+	Condition *Condition
+
+	minwidth int
+	padding  int
+	padchar  rune
+	flags    ColumnFlags
+	out      io.Writer
+
+	cell   []byte      // the text of the current cell so far
+	line   []colCell   // the cells of the current line
+	lines  [][]colCell // the complete lines not yet written
+	widths []int       // the widths of the enclosing column blocks
+	buf    []byte      // output being assembled
+	// partial is set when the last of lines had no newline.
+	partial bool
+}
+
+// NewColumnWriter returns a ColumnWriter writing to w. Columns are at
+// least minwidth cells wide, including padding cells of padchar added
+// to each cell; a wide padchar fills two cells. flags changes the
+// formatting.
+func NewColumnWriter(w io.Writer, minwidth, padding int, padchar rune, flags ColumnFlags) *ColumnWriter {
+	return &ColumnWriter{
+		minwidth: minwidth,
+		padding:  padding,
+		padchar:  padchar,
+		flags:    flags,
+		out:      w,
+	}
+}
+
+func (cw *ColumnWriter) cond() *Condition {
+	if cw.Condition != nil {
+		return cw.Condition
+	}
+	return DefaultCondition
+}
+
+// endCell terminates the current cell.
+func (cw *ColumnWriter) endCell() {
+	text := string(cw.cell)
+	cw.line = append(cw.line, colCell{text, cw.cond().StringWidth(text)})
+	cw.cell = cw.cell[:0]
+}
+
+// Write buffers buf, writing out the lines before each line that has no
+// tabs. It returns len(buf) unless writing out fails.
+func (cw *ColumnWriter) Write(buf []byte) (n int, err error) {
+	for i, b := range buf {
+		switch b {
+		case '\t':
+			cw.endCell()
+		case '\n':
+			cw.endCell()
+			ncells := len(cw.line)
+			cw.lines = append(cw.lines, cw.line)
+			cw.line = nil
+			if ncells == 1 {
+				if err := cw.flushLines(); err != nil {
+					return i + 1, err
+				}
+			}
+		default:
+			cw.cell = append(cw.cell, b)
+		}
+	}
+	return len(buf), nil
+}
+
+// Flush writes out all buffered text, including an unterminated last
+// line, which is aligned with the lines before it.
+func (cw *ColumnWriter) Flush() error {
+	if len(cw.cell) > 0 || len(cw.line) > 0 {
+		cw.endCell()
+		cw.lines = append(cw.lines, cw.line)
+		cw.line = nil
+		cw.partial = true
+	}
+	return cw.flushLines()
+}
+
+// flushLines formats the complete lines and writes them out.
+func (cw *ColumnWriter) flushLines() error {
+	cw.buf = cw.buf[:0]
+	cw.format(0, len(cw.lines))
+	cw.widths = cw.widths[:0]
+	if cw.partial {
+		cw.buf = cw.buf[:len(cw.buf)-1]
+		cw.partial = false
+	}
+	cw.lines = cw.lines[:0]
+	_, err := cw.out.Write(cw.buf)
+	return err
+}
+
+// format lays out lines[line0:line1], whose cells in the columns before
+// len(cw.widths) are already sized, sizing the blocks of the next column
+// as text/tabwriter does.
+func (cw *ColumnWriter) format(line0, line1 int) {
+	column := len(cw.widths)
+	for this := line0; this < line1; this++ {
+		if column >= len(cw.lines[this])-1 {
+			continue
+		}
+		// A block of the column begins here; write the lines before it.
+		cw.writeLines(line0, this)
+		line0 = this
+
+		width := cw.minwidth
+		discardable := true
+		for ; this < line1; this++ {
+			line := cw.lines[this]
+			if column >= len(line)-1 {
+				break
+			}
+			c := line[column]
+			if w := c.width + cw.padding; w > width {
+				width = w
+			}
+			if c.width > 0 {
+				discardable = false
+			}
+		}
+		if discardable && cw.flags&ColumnDiscardEmpty != 0 {
+			width = 0
+		}
+
+		cw.widths = append(cw.widths, width)
+		cw.format(line0, this)
+		cw.widths = cw.widths[:len(cw.widths)-1]
+		line0 = this
+	}
+	cw.writeLines(line0, line1)
+}
+
+// writeLines writes lines[line0:line1] to cw.buf, padding their cells to
+// the widths of their columns.
+func (cw *ColumnWriter) writeLines(line0, line1 int) {
+	c := cw.cond()
+	for _, line := range cw.lines[line0:line1] {
+		for j, cell := range line {
+			if j > 0 && cw.flags&ColumnDebug != 0 {
+				cw.buf = append(cw.buf, '|')
+			}
+			if j >= len(cw.widths) {
+				cw.buf = append(cw.buf, cell.text...)
+				continue
+			}
+			pad := c.fill(cw.padchar, cw.widths[j]-cell.width)
+			if cw.flags&ColumnAlignRight != 0 {
+				cw.buf = append(cw.buf, pad...)
+				cw.buf = append(cw.buf, cell.text...)
+			} else {
+				cw.buf = append(cw.buf, cell.text...)
+				cw.buf = append(cw.buf, pad...)
+			}
+		}
+		cw.buf = append(cw.buf, '\n')
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+var columnWriterTests = []struct {
+	name    string
+	padding int
+	padchar rune
+	flags   ColumnFlags
+	in      string
+	out     string
+}{
+	{"ascii", 1, '.', 0,
+		"a\tb\tc\naa\tbbb\tc\n",
+		"a..b...c\naa.bbb.c\n"},
+	{"cjk", 1, '.', 0,
+		"名前\t年齢\n山田太郎\t30\nBob\t4\n",
+		"名前.....年齢\n山田太郎.30\nBob......4\n"},
+	{"emoji", 1, '.', 0,
+		"🍣\tsushi\nx\ty\n",
+		"🍣.sushi\nx..y\n"},
+	{"ansi", 1, '.', 0,
+		"\x1b[31mred\x1b[0m\t1\ngreen\t2\n",
+		"\x1b[31mred\x1b[0m...1\ngreen.2\n"},
+	{"right", 1, ' ', ColumnAlignRight,
+		"1\t日本\t\n100\tx\t\n",
+		"   1 日本\n 100    x\n"},
+	{"debug", 1, ' ', ColumnDebug,
+		"a\t日本\tz\n",
+		"a |日本 |z\n"},
+	{"blocks", 1, '.', 0,
+		"aaaa\tb\nno tabs\nc\td\n",
+		"aaaa.b\nno tabs\nc.d\n"},
+	// The last cell of the middle line is not in a column, so it
+	// splits the second column into two blocks.
+	{"nested blocks", 1, '.', 0,
+		"a\tb\tc\naaaa\tbbbb\nx\tyy\tz\n",
+		"a....b.c\naaaa.bbbb\nx....yy.z\n"},
+	{"discard empty", 1, '.', ColumnDiscardEmpty,
+		"a\t\tb\naa\t\tb\n",
+		"a..b\naa.b\n"},
+	{"wide padchar", 2, '・', 0,
+		"a\tb\nccc\td\n",
+		"a・・b\nccc・d\n"},
+	{"unterminated", 1, '.', 0,
+		"a\tb\nccc\td",
+		"a...b\nccc.d"},
+}
+
+func TestColumnWriter(t *testing.T) {
+	for _, tt := range columnWriterTests {
+		var b strings.Builder
+		w := NewColumnWriter(&b, 0, tt.padding, tt.padchar, tt.flags)
+		// Write a byte at a time to split characters and sequences.
+		for i := 0; i < len(tt.in); i++ {
+			if _, err := w.Write([]byte{tt.in[i]}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != tt.out {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.out)
+		}
+	}
+}
+
+func TestColumnWriterMinWidth(t *testing.T) {
+	var b strings.Builder
+	w := NewColumnWriter(&b, 8, 1, ' ', 0)
+	Fprintf(w, "%s\t%s\n%s\t%s\n", "ab", "x", "日本語", "y")
+	// A line without tabs writes out the lines before it.
+	Fprintln(w, "end")
+	if got, want := b.String(), "ab      x\n日本語  y\nend\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	w.Flush()
+	if b.Len() != len("ab      x\n日本語  y\nend\n") {
+		t.Errorf("Flush wrote more: %q", b.String())
+	}
+}
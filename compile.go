@@ -0,0 +1,238 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A Format is a format string parsed once by Compile for printing many
+// times, as a logger does with its templates: each directive is parsed
+// ahead of time and the width of the text between directives is
+// measured ahead of time for Measure. A Format prints exactly as the
+// Printer it was compiled by would print its format string. It is safe
+// for concurrent use.
+type Format struct {
+	pr     Printer
+	format string
+	// specs are the directives of format, each with the text before it;
+	// the last holds the text after the last directive and no verb.
+	specs []spec
+	// dynamic is set when format takes widths, precisions or argument
+	// indexes from the operands, which is parsed at each call instead.
+	dynamic bool
+	// rescan is set when the output cannot be measured piecewise, as
+	// when the text between directives holds newlines or tabs advance to
+	// tab stops.
+	rescan bool
+}
+
+// A spec is a directive of a compiled format and the text before it.
+type spec struct {
+	lit      string
+	litWidth int
+	verb     rune // 0 for the text after the last directive
+	flags    fmtFlags
+	wid      int
+	prec     int
+	layout   string
+}
+
+// specRecorder is an operand that records the state of the directive it
+// is formatted with.
+type specRecorder struct{ s *spec }
+
+func (r specRecorder) Format(f State, verb rune) {
+	p := f.(*pp)
+	r.s.flags, r.s.wid, r.s.prec = p.fmt.fmtFlags, p.fmt.wid, p.fmt.prec
+}
+
+// Compile parses format for printing with the configuration set by
+// SetConfig at the time of the call. See Printer.Compile.
+func Compile(format string) (*Format, error) {
+	pr := GetConfig()
+	return pr.Compile(format)
+}
+
+// Compile parses format for printing by pr, as Printer.Sprintf and the
+// like would. It returns an error if format ends in the middle of a
+// directive or holds a time layout without its closing brace, which
+// Sprintf would print as a bad verb. A Format copies pr; later changes
+// to pr do not affect it.
+func (pr *Printer) Compile(format string) (*Format, error) {
+	f := &Format{pr: *pr, format: format}
+	c := pr.cond()
+	f.rescan = c.TabStops || c.EscPos
+	var lit strings.Builder
+	for i := 0; i < len(format); {
+		j := strings.IndexByte(format[i:], '%')
+		if j < 0 {
+			lit.WriteString(format[i:])
+			break
+		}
+		lit.WriteString(format[i : i+j])
+		i += j
+		d, n := parseDirective(format[i:])
+		switch {
+		case n == 0:
+			return nil, errors.New("wfmt: format " + strconv.Quote(format) + " ends without a verb")
+		case d.Verb == '{':
+			return nil, errors.New("wfmt: unterminated time layout in format " + strconv.Quote(format))
+		case strings.ContainsAny(d.Width+d.Precision+d.Index, "*["):
+			f.dynamic = true
+		case d.Verb == '%':
+			// Percent ignores the width and precision.
+			lit.WriteByte('%')
+			i += n
+			continue
+		case d.Verb != 't' && strings.IndexByte(format[i:i+n], '{') >= 0:
+			// Let doPrintf report the bad layout, even an empty one,
+			// which d does not record.
+			f.dynamic = true
+		}
+		s := spec{lit: lit.String(), verb: d.Verb}
+		layout := d.Layout
+		lit.Reset()
+		if !f.dynamic {
+			// Let doPrintf parse the directive, with a verb that
+			// leaves the flags as they are. The verb takes no layout,
+			// so the layout is kept aside.
+			verb := d.Verb
+			d.Verb, d.Layout = 's', ""
+			p := newPrinter()
+			p.doPrintf(d.String(), []interface{}{specRecorder{&s}})
+			p.free()
+			s.layout = layout
+			if verb == 'v' || verb == 'w' {
+				s.flags.sharpV, s.flags.sharp = s.flags.sharp, false
+				s.flags.plusV, s.flags.plus = s.flags.plus, false
+			}
+		}
+		f.specs = append(f.specs, s)
+		i += n
+	}
+	f.specs = append(f.specs, spec{lit: lit.String()})
+	for i := range f.specs {
+		s := &f.specs[i]
+		s.litWidth = c.StringWidth(s.lit)
+		if strings.IndexByte(s.lit, '\n') >= 0 {
+			f.rescan = true
+		}
+	}
+	return f, nil
+}
+
+// String returns the format string f was compiled from.
+func (f *Format) String() string {
+	return f.format
+}
+
+// print formats the operands a into p. If lits is false, the text
+// between directives is left out.
+func (f *Format) print(p *pp, a []interface{}, lits bool) {
+	if f.dynamic {
+		p.doPrintf(f.format, a)
+		return
+	}
+	argNum := 0
+	for i := range f.specs {
+		s := &f.specs[i]
+		if lits {
+			p.buf.WriteString(s.lit)
+		}
+		if s.verb == 0 {
+			break
+		}
+		p.fmt.fmtFlags, p.fmt.wid, p.fmt.prec = s.flags, s.wid, s.prec
+		if argNum >= len(a) {
+			p.missingArg(s.verb)
+			continue
+		}
+		p.layout = s.layout
+		p.printField(a[argNum], argNum, s.verb)
+		p.layout = ""
+		argNum++
+	}
+	if argNum < len(a) {
+		p.extraArgs(a[argNum:])
+	}
+}
+
+// Fprintf formats the operands a according to f and writes to w.
+// It returns the number of bytes written and any write error encountered.
+func (f *Format) Fprintf(w io.Writer, a ...interface{}) (n int, err error) {
+	p := f.pr.newPrinter()
+	if f.pr.streams() {
+		p.stream(w)
+	}
+	f.print(p, a, true)
+	n, err = p.writeOut(w, f.pr.output(p, w))
+	p.free()
+	return
+}
+
+// Printf formats the operands a according to f and writes to standard output.
+// It returns the number of bytes written and any write error encountered.
+func (f *Format) Printf(a ...interface{}) (n int, err error) {
+	return f.Fprintf(os.Stdout, a...)
+}
+
+// Sprintf formats the operands a according to f and returns the resulting string.
+func (f *Format) Sprintf(a ...interface{}) string {
+	p := f.pr.newPrinter()
+	f.print(p, a, true)
+	s := string(f.pr.output(p, nil))
+	p.free()
+	return s
+}
+
+// Appendf formats the operands a according to f, appends the result to the byte
+// slice, and returns the updated slice.
+func (f *Format) Appendf(b []byte, a ...interface{}) []byte {
+	p := f.pr.newPrinter()
+	f.print(p, a, true)
+	b = append(b, f.pr.output(p, nil)...)
+	p.free()
+	return b
+}
+
+// Bprintf formats the operands a according to f and writes the result to
+// buf without growing it, as Printer.Bprintf does.
+func (f *Format) Bprintf(buf []byte, a ...interface{}) (n int, err error) {
+	p := f.pr.newPrinter()
+	f.print(p, a, true)
+	n, err = bcopy(buf, f.pr.output(p, nil))
+	p.free()
+	return
+}
+
+// Measure returns the number of columns that the output of f.Sprintf
+// would occupy, as Printer.Measure does. The text between directives is
+// not formatted again: its width, measured by Compile, is added to the
+// width of the operands.
+func (f *Format) Measure(a ...interface{}) (columns int, err error) {
+	if f.dynamic || f.rescan {
+		return f.pr.Measure(f.format, a...)
+	}
+	p := f.pr.newPrinter()
+	c := f.pr.cond()
+	for i := range f.specs {
+		columns += f.specs[i].litWidth
+	}
+	f.print(p, a, false)
+	if p.badAt >= 0 || bytes.IndexByte(p.buf, '\n') >= 0 {
+		// Measure the whole output for the lines or the error.
+		p.free()
+		return f.pr.Measure(f.format, a...)
+	}
+	columns += c.StringWidth(bytesString(p.buf))
+	p.free()
+	return columns, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+// A compiled format prints as Sprintf does.
+func TestCompileMatchesSprintf(t *testing.T) {
+	for _, tt := range fmtTests {
+		f, err := Compile(tt.fmt)
+		if err != nil {
+			if !strings.Contains(Sprintf(tt.fmt, tt.val), "%!(NOVERB)") {
+				t.Errorf("Compile(%q): %v", tt.fmt, err)
+			}
+			continue
+		}
+		if got, want := f.Sprintf(tt.val), Sprintf(tt.fmt, tt.val); got != want {
+			t.Errorf("Compile(%q).Sprintf = %q want %q", tt.fmt, got, want)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []interface{}
+		out    string
+	}{
+		{"[%-6s|%4d]", []interface{}{"日本", 42}, "[日本  |  42]"},
+		{"100%% %v", []interface{}{1}, "100% 1"},
+		{"%+v %#v", []interface{}{struct{ A int }{1}, []int{2}}, "{A:1} []int{2}"},
+		{"%{15:04}t", []interface{}{layoutTime}, "15:04"},
+		{"%{2006}d %d", []interface{}{5, 6}, "%!d(BADLAYOUT) 6"},
+		{"%{}d %d", []interface{}{5, 6}, "%!d(BADLAYOUT) 6"},
+		{"[%-8{15:04}t]", []interface{}{layoutTime}, "[15:04   ]"},
+		{"%'.8s|", []interface{}{"ab"}, "......ab|"},
+		{"%d %d", []interface{}{1}, "1 %!d(MISSING)"},
+		{"%d", []interface{}{1, "x"}, "1%!(EXTRA string=x)"},
+		{"%*d|%[1]d", []interface{}{3, 4}, "  4|3"},
+		{"no verbs", nil, "no verbs"},
+	}
+	for _, tt := range tests {
+		f, err := Compile(tt.format)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.format, err)
+			continue
+		}
+		if got := f.Sprintf(tt.args...); got != tt.out {
+			t.Errorf("Compile(%q).Sprintf = %q want %q", tt.format, got, tt.out)
+		}
+		if got := string(f.Appendf([]byte("> "), tt.args...)); got != "> "+tt.out {
+			t.Errorf("Compile(%q).Appendf = %q", tt.format, got)
+		}
+		var b bytes.Buffer
+		if n, err := f.Fprintf(&b, tt.args...); n != len(tt.out) || err != nil || b.String() != tt.out {
+			t.Errorf("Compile(%q).Fprintf = %d, %v, %q", tt.format, n, err, b.String())
+		}
+	}
+	for _, bad := range []string{"%", "abc %-5", "%{15:04t"} {
+		if _, err := Compile(bad); err == nil {
+			t.Errorf("Compile(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestCompilePrinter(t *testing.T) {
+	pr := Printer{Condition: &Condition{EastAsian: true}, GroupSeparator: "."}
+	f, err := pr.Compile("%,d ±%3s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.GroupSeparator = " "
+	if got := f.Sprintf(1234, "±"); got != "1.234 ± ±" {
+		t.Errorf("Sprintf = %q", got)
+	}
+	if f.String() != "%,d ±%3s" {
+		t.Errorf("String() = %q", f.String())
+	}
+}
+
+func TestCompileMeasure(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		args   []interface{}
+	}{
+		{"名前: %-10s|%5d", []interface{}{"日本", 7}},
+		{"%s\n%s", []interface{}{"a", "日本語"}},
+		{"line: %s", []interface{}{"a\nbcdef"}},
+		{"%d", []interface{}{"x"}},
+		{"%*s", []interface{}{6, "ab"}},
+	} {
+		f, err := Compile(tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, gerr := f.Measure(tt.args...)
+		want, werr := Measure(tt.format, tt.args...)
+		if got != want || (gerr == nil) != (werr == nil) || gerr != nil && gerr.Error() != werr.Error() {
+			t.Errorf("Compile(%q).Measure = %d, %v want %d, %v", tt.format, got, gerr, want, werr)
+		}
+	}
+}
+
+func BenchmarkCompiledSprintf(b *testing.B) {
+	f, _ := Compile("%-8s %5d %6.2f %s")
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			f.Sprintf("INFO", 42, 3.14159, "request served")
+		}
+	})
+}
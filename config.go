@@ -0,0 +1,72 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "sync/atomic"
+
+// config holds the *Printer set by SetConfig, or a nil *Printer.
+var config atomic.Value
+
+// configured returns the Printer set by SetConfig, or nil if there is
+// none.
+func configured() *Printer {
+	pr, _ := config.Load().(*Printer)
+	return pr
+}
+
+// SetConfig makes a copy of pr the configuration of the package-level
+// print functions, such as Printf, Sprint and Appendln, which otherwise
+// behave like the zero Printer. The configuration is swapped
+// atomically: SetConfig may be called while other goroutines print,
+// and a call already under way finishes with the configuration it
+// started with. Changes made to pr, or to its Condition, after
+// SetConfig returns have no effect; a Printer without a Condition
+// measures with DefaultCondition as it is when printing. SetConfig(nil)
+// restores the default behavior.
+//
+// Libraries should leave the configuration to the program and print
+// with a Printer of their own, or with WithConfig, when they need
+// particular settings.
+func SetConfig(pr *Printer) {
+	if pr == nil {
+		config.Store((*Printer)(nil))
+		return
+	}
+	c := copyConfig(pr)
+	config.Store(&c)
+}
+
+// copyConfig returns a copy of pr that shares neither its post
+// processors nor its Condition.
+func copyConfig(pr *Printer) Printer {
+	c := *pr
+	c.post = append([]func([]byte) []byte(nil), pr.post...)
+	if pr.Condition != nil {
+		cond := *pr.Condition
+		c.Condition = &cond
+	}
+	return c
+}
+
+// GetConfig returns a copy of the configuration set by SetConfig, or the
+// zero Printer if there is none. A program may change the copy and pass
+// it back to SetConfig.
+func GetConfig() Printer {
+	if pr := configured(); pr != nil {
+		return copyConfig(pr)
+	}
+	return Printer{}
+}
+
+// WithConfig returns a Printer with the configuration cfg, for printing
+// with settings that differ from the global configuration for a single
+// call without changing it, as in
+//
+//	cfg := wfmt.GetConfig()
+//	cfg.Wrap = 72
+//	s := wfmt.WithConfig(cfg).Sprintf("%s", text)
+func WithConfig(cfg Printer) *Printer {
+	return &cfg
+}
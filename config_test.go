@@ -0,0 +1,95 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestSetConfig(t *testing.T) {
+	defer SetConfig(nil)
+	if cfg := GetConfig(); cfg.Wrap != 0 || cfg.Condition != nil {
+		t.Errorf("GetConfig() before SetConfig = %+v", cfg)
+	}
+	cfg := Printer{Condition: &Condition{EastAsian: true}, GroupSeparator: "."}
+	SetConfig(&cfg)
+	// Changes after SetConfig do not apply.
+	cfg.GroupSeparator = "'"
+	cfg.Condition.EastAsian = false
+
+	if got := Sprintf("[%,4d|%4s]", 1234, "α"); got != "[1.234|  α]" {
+		t.Errorf("Sprintf = %q", got)
+	}
+	if got := string(Appendf(nil, "%,d", 1234)); got != "1.234" {
+		t.Errorf("Appendf = %q", got)
+	}
+	if got := Sprint(1, "α"); got != "1α" {
+		t.Errorf("Sprint = %q", got)
+	}
+	if got := Sprintln(1234); got != "1234\n" {
+		t.Errorf("Sprintln = %q", got)
+	}
+	var b bytes.Buffer
+	Fprintf(&b, "%,d", 5678)
+	if got := b.String(); got != "5.678" {
+		t.Errorf("Fprintf = %q", got)
+	}
+	if got := Errorf("%,d: %w", 1234, io.EOF); got.Error() != "1.234: EOF" || !errors.Is(got, io.EOF) {
+		t.Errorf("Errorf = %v", got)
+	}
+	if got := GetConfig(); got.GroupSeparator != "." || !got.Condition.EastAsian {
+		t.Errorf("GetConfig() = %+v", got)
+	}
+	GetConfig().Condition.EastAsian = false
+	if got := Sprintf("%4s|", "α"); got != "  α|" {
+		t.Errorf("Sprintf after changing GetConfig's Condition = %q", got)
+	}
+
+	// WithConfig overrides the configuration for a single call.
+	over := GetConfig()
+	over.GroupSeparator = " "
+	if got := WithConfig(over).Sprintf("%,d", 1234); got != "1 234" {
+		t.Errorf("WithConfig(...).Sprintf = %q", got)
+	}
+	if got := Sprintf("%,d", 1234); got != "1.234" {
+		t.Errorf("Sprintf after WithConfig = %q", got)
+	}
+
+	SetConfig(nil)
+	if got := Sprintf("%,d", 1234); got != "1,234" {
+		t.Errorf("Sprintf after SetConfig(nil) = %q", got)
+	}
+}
+
+func TestSetConfigConcurrent(t *testing.T) {
+	defer SetConfig(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetConfig(&Printer{GroupSeparator: "."})
+				SetConfig(nil)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if got := Sprintf("%,d", 1234); got != "1,234" && got != "1.234" {
+					t.Errorf("Sprintf = %q", got)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
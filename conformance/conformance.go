@@ -0,0 +1,80 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package conformance provides table-driven cases for the display width
+// of text, covering East Asian Width categories, combining marks, emoji
+// sequences and terminal escape sequences, and runs them against any
+// width function. It lets a custom width provider or a new terminal
+// profile be validated the same way as wfmt's own Condition.
+package conformance
+
+import "testing"
+
+// A WidthFunc returns the number of terminal cells occupied by a string.
+type WidthFunc func(s string) int
+
+// A Case is a string and the number of cells it should occupy.
+type Case struct {
+	Category string // such as "wide" or "emoji"
+	Name     string
+	Input    string
+	Width    int
+}
+
+// A Profile selects the expectations that differ between terminals.
+type Profile struct {
+	// EastAsian expects East Asian ambiguous characters to be wide.
+	EastAsian bool
+}
+
+// Cases returns the cases for profile.
+func Cases(profile Profile) []Case {
+	amb := 1
+	if profile.EastAsian {
+		amb = 2
+	}
+	return []Case{
+		{"narrow", "ascii", "abc", 3},
+		{"narrow", "halfwidth katakana", "ｱｲｳ", 3},
+		{"wide", "han", "日本語", 6},
+		{"wide", "hiragana", "ひらがな", 8},
+		{"wide", "hangul", "한국어", 6},
+		{"wide", "fullwidth", "ＡＢ１", 6},
+		{"wide", "ideographic space", "　", 2},
+		{"wide", "mixed", "a日b", 4},
+		{"ambiguous", "greek", "αβγ", 3 * amb},
+		{"ambiguous", "cyrillic", "Жж", 2 * amb},
+		{"ambiguous", "box drawing", "─│┼", 3 * amb},
+		{"ambiguous", "circled digit", "①", amb},
+		{"ambiguous", "latin-1", "café", 3 + amb},
+		{"combining", "acute", "e\u0301", 1},
+		{"combining", "stacked", "a\u0308\u0304", 1},
+		{"combining", "on wide", "か\u3099", 2},
+		{"zero width", "space", "a\u200bb", 2},
+		{"zero width", "joiners", "\u200c\u200d", 0},
+		{"emoji", "face", "😀", 2},
+		{"emoji", "skin tone", "👍\U0001F3FD", 2},
+		{"emoji", "zwj family", "👨\u200d👩\u200d👧", 2},
+		{"emoji", "flag", "🇯🇵", 2},
+		{"emoji", "two flags", "🇯🇵🇰🇷", 4},
+		{"escapes", "sgr", "\x1b[1;31mred\x1b[0m", 3},
+		{"escapes", "csi cursor", "\x1b[2Kab", 2},
+		{"escapes", "osc title", "\x1b]0;title\aab", 2},
+		{"escapes", "osc 8 link", "\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", 4},
+		{"escapes", "around wide", "\x1b[7m日\x1b[27m本", 4},
+	}
+}
+
+// Test runs the cases for profile against width as subtests of t,
+// named category/name.
+func Test(t *testing.T, width WidthFunc, profile Profile) {
+	for _, c := range Cases(profile) {
+		c := c
+		t.Run(c.Category+"/"+c.Name, func(t *testing.T) {
+			if got := width(c.Input); got != c.Width {
+				t.Errorf("width(%+q) = %d want %d", c.Input, got, c.Width)
+			}
+		})
+	}
+}
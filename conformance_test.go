@@ -0,0 +1,23 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+	"github.com/lostsnow/wfmt/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	for _, eastAsian := range []bool{false, true} {
+		c := &Condition{EastAsian: eastAsian}
+		conformance.Test(t, c.StringWidth, conformance.Profile{EastAsian: eastAsian})
+		for _, version := range UnicodeVersions() {
+			c := &Condition{EastAsian: eastAsian, Unicode: version}
+			conformance.Test(t, c.StringWidth, conformance.Profile{EastAsian: eastAsian})
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// A RecordSource yields records one at a time, returning io.EOF after the
+// last, as *csv.Reader does.
+type RecordSource interface {
+	Read() (record []string, err error)
+}
+
+// A CSVPrinter prints the records of a CSV or TSV file, as read by
+// csv.Reader, as an aligned table, measuring cells in display cells.
+//
+// To align its columns a CSVPrinter needs their widths before it prints
+// the first row. By default it reads all records to find them, which
+// holds the whole input in memory. With Sample set it reads only that
+// many records and streams the rest, truncating cells wider than the
+// sample's with an ellipsis and dropping cells beyond its columns.
+// PrintTwoPass instead reads the input twice, first to measure it and
+// then to print it, holding one record at a time.
+type CSVPrinter struct {
+	// Condition measures cells; DefaultCondition if nil.
+	Condition *Condition
+	// Border is the set of characters the table is drawn with.
+	Border TableBorder
+	// Header makes the first record the header of the table.
+	Header bool
+	// Sample, if positive, is the number of records read to size the
+	// columns before the rest are streamed.
+	Sample int
+	// MaxWidth, if positive, limits every column to that many cells.
+	MaxWidth int
+	// Tail marks truncated cells; "…" if empty.
+	Tail string
+	// Wrap wraps cells wider than their columns onto more lines rather
+	// than truncating them.
+	Wrap bool
+}
+
+// NewCSVPrinter returns a CSVPrinter printing tables with a header, drawn
+// with LightBorder.
+func NewCSVPrinter() *CSVPrinter {
+	return &CSVPrinter{Border: LightBorder, Header: true}
+}
+
+// table returns a Table to lay out the records of cp.
+func (cp *CSVPrinter) table() *Table {
+	return &Table{Condition: cp.Condition, Border: cp.Border, Tail: cp.Tail, Wrap: cp.Wrap}
+}
+
+// limit narrows cols to cp.MaxWidth.
+func (cp *CSVPrinter) limit(cols []int) []int {
+	for j, w := range cols {
+		if cp.MaxWidth > 0 && w > cp.MaxWidth {
+			cols[j] = cp.MaxWidth
+		}
+	}
+	return cols
+}
+
+// Print prints the records read from src, sizing the columns by all of
+// them or, with Sample set, by the first Sample.
+func (cp *CSVPrinter) Print(w io.Writer, src RecordSource) error {
+	t := cp.table()
+	var cols []int
+	for cp.Sample <= 0 || len(t.rows) < cp.Sample {
+		rec, err := src.Read()
+		if err == io.EOF {
+			src = nil
+			break
+		}
+		if err != nil {
+			return err
+		}
+		cols = t.measure(cols, rec)
+		t.rows = append(t.rows, rec)
+	}
+	return cp.print(w, t, cp.limit(cols), src)
+}
+
+// PrintRecords prints records, sizing the columns by all of them.
+func (cp *CSVPrinter) PrintRecords(w io.Writer, records [][]string) error {
+	t := cp.table()
+	var cols []int
+	for _, rec := range records {
+		cols = t.measure(cols, rec)
+	}
+	t.rows = records
+	return cp.print(w, t, cp.limit(cols), nil)
+}
+
+// PrintTwoPass prints the records read from the RecordSource returned by
+// open, which it calls twice: once to size the columns and once to
+// print the rows. Only one record is held at a time, so it suits files
+// too large to read into memory.
+func (cp *CSVPrinter) PrintTwoPass(w io.Writer, open func() (RecordSource, error)) error {
+	t := cp.table()
+	src, err := open()
+	if err != nil {
+		return err
+	}
+	var cols []int
+	for {
+		rec, err := src.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		cols = t.measure(cols, rec)
+	}
+	if src, err = open(); err != nil {
+		return err
+	}
+	return cp.print(w, t, cp.limit(cols), src)
+}
+
+// print writes the table t with columns of widths cols: its header and
+// rows, which start with the header if cp.Header is set, followed by
+// the records read from rest, if not nil.
+func (cp *CSVPrinter) print(w io.Writer, t *Table, cols []int, rest RecordSource) error {
+	bw := bufio.NewWriter(w)
+	var b strings.Builder
+	emit := func() error {
+		_, err := bw.WriteString(b.String())
+		b.Reset()
+		return err
+	}
+
+	t.rule(&b, t.Border.Top, cols)
+	header := cp.Header
+	next := func() ([]string, error) {
+		if len(t.rows) > 0 {
+			rec := t.rows[0]
+			t.rows = t.rows[1:]
+			return rec, nil
+		}
+		if rest == nil {
+			return nil, io.EOF
+		}
+		return rest.Read()
+	}
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		t.line(&b, rec, cols)
+		if header {
+			t.rule(&b, t.Border.Rule, cols)
+			header = false
+		}
+		if err := emit(); err != nil {
+			return err
+		}
+	}
+	t.rule(&b, t.Border.Bottom, cols)
+	if err := emit(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
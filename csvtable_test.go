@@ -0,0 +1,104 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+const testCSV = "id,名前,city\n1,山田太郎,東京\n2,Bob,NYC\n3,José,São Paulo\n"
+
+func TestCSVPrinter(t *testing.T) {
+	want := "" +
+		"┌────┬──────────┬───────────┐\n" +
+		"│ id │ 名前     │ city      │\n" +
+		"├────┼──────────┼───────────┤\n" +
+		"│ 1  │ 山田太郎 │ 東京      │\n" +
+		"│ 2  │ Bob      │ NYC       │\n" +
+		"│ 3  │ José     │ São Paulo │\n" +
+		"└────┴──────────┴───────────┘\n"
+	cp := NewCSVPrinter()
+
+	var b strings.Builder
+	if err := cp.Print(&b, csv.NewReader(strings.NewReader(testCSV))); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("Print:\n%s\nwant\n%s", got, want)
+	}
+
+	records, _ := csv.NewReader(strings.NewReader(testCSV)).ReadAll()
+	b.Reset()
+	if err := cp.PrintRecords(&b, records); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("PrintRecords:\n%s\nwant\n%s", got, want)
+	}
+
+	opens := 0
+	b.Reset()
+	err := cp.PrintTwoPass(&b, func() (RecordSource, error) {
+		opens++
+		return csv.NewReader(strings.NewReader(testCSV)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want || opens != 2 {
+		t.Errorf("PrintTwoPass opened the input %d times:\n%s\nwant\n%s", opens, got, want)
+	}
+}
+
+// With Sample set, the rows after the sample are streamed in the
+// columns it sized, wider cells truncated.
+func TestCSVPrinterSample(t *testing.T) {
+	r := csv.NewReader(strings.NewReader("a\tb\nxx\ty\n長い名前です\tzzzz\n"))
+	r.Comma = '\t'
+	cp := &CSVPrinter{Sample: 2, Border: ASCIIBorder}
+	var b strings.Builder
+	if err := cp.Print(&b, r); err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"+----+---+\n" +
+		"| a  | b |\n" +
+		"| xx | y |\n" +
+		"| …  | … |\n" +
+		"+----+---+\n"
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCSVPrinterError(t *testing.T) {
+	var b strings.Builder
+	err := NewCSVPrinter().Print(&b, csv.NewReader(strings.NewReader("a,b\n\"unterminated\n")))
+	if _, ok := err.(*csv.ParseError); !ok {
+		t.Errorf("Print returned %v, want a *csv.ParseError", err)
+	}
+}
+
+func TestCSVPrinterWrap(t *testing.T) {
+	cp := &CSVPrinter{Border: ASCIIBorder, MaxWidth: 6, Wrap: true}
+	var b strings.Builder
+	if err := cp.PrintRecords(&b, [][]string{{"1", "東京都港区"}, {"2", "a\nb"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"+---+--------+\n" +
+		"| 1 | 東京都 |\n" +
+		"|   | 港区   |\n" +
+		"| 2 | a      |\n" +
+		"|   | b      |\n" +
+		"+---+--------+\n"
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
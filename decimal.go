@@ -0,0 +1,99 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "strings"
+
+// A decimalCell is a cell of a column aligned on the decimal point.
+type decimalCell struct {
+	symbol string // currency symbol, for AlignCurrency
+	whole  string // up to the decimal point
+	frac   string // the decimal point and what follows
+}
+
+// numeric reports whether r is part of the number of a cell, rather than
+// of its currency symbol.
+func numeric(r rune) bool {
+	return '0' <= r && r <= '9' || r == '-' || r == '+' || r == '.' || r == ','
+}
+
+// splitDecimal splits s at its decimal point or, without one, after its
+// last digit, so that "12.5%" and "3%" align their units too. With
+// currency set, the text before the number is split off as its symbol.
+func splitDecimal(s string, currency bool) decimalCell {
+	var d decimalCell
+	if currency {
+		i := strings.IndexFunc(s, numeric)
+		if i < 0 {
+			i = len(s)
+		}
+		d.symbol, s = strings.TrimRight(s[:i], " "), s[i:]
+	}
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		i = strings.LastIndexAny(s, "0123456789") + 1
+		if i == 0 {
+			i = len(s)
+		}
+	}
+	d.whole, d.frac = s[:i], s[i:]
+	return d
+}
+
+// alignDecimals returns rows with the cells of the columns aligned by
+// AlignDecimal and AlignCurrency padded to line up their symbols and
+// decimal points. The cells of each such column come out equally wide,
+// to be right-aligned under the header.
+func (t *Table) alignDecimals(rows [][]string) [][]string {
+	c := t.cond()
+	var aligned [][]string
+	for j, align := range t.align {
+		if align != AlignDecimal && align != AlignCurrency {
+			continue
+		}
+		if aligned == nil {
+			aligned = make([][]string, len(rows))
+			for i, row := range rows {
+				aligned[i] = append([]string(nil), row...)
+			}
+		}
+		cells := make([]decimalCell, len(rows))
+		var sym, whole, frac int
+		for i, row := range aligned {
+			if j >= len(row) {
+				continue
+			}
+			d := splitDecimal(row[j], align == AlignCurrency)
+			cells[i] = d
+			if w := c.StringWidth(d.symbol); w > sym {
+				sym = w
+			}
+			if w := c.StringWidth(d.whole); w > whole {
+				whole = w
+			}
+			if w := c.StringWidth(d.frac); w > frac {
+				frac = w
+			}
+		}
+		for i, row := range aligned {
+			if j >= len(row) {
+				continue
+			}
+			d := cells[i]
+			var b strings.Builder
+			if sym > 0 {
+				b.WriteString(c.PadRight(d.symbol, sym, ' '))
+				b.WriteByte(' ')
+			}
+			b.WriteString(c.PadLeft(d.whole, whole, ' '))
+			b.WriteString(c.PadRight(d.frac, frac, ' '))
+			row[j] = b.String()
+		}
+	}
+	if aligned == nil {
+		return rows
+	}
+	return aligned
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	controlNames = []string{"zero", "one", "escape"}
+	invalidNames = []string{"keep", "replace", "hex", "strict"}
+	lineNames    = []string{"whole", "longest", "each"}
+	unitNames    = []string{"default", "columns", "runes", "bytes"}
+	unknownNames = []string{"narrow", "wide"}
+)
+
+// policyName returns names[i], or i itself if it is out of range.
+func policyName(names []string, i int) string {
+	if 0 <= i && i < len(names) {
+		return names[i]
+	}
+	return strconv.Itoa(i)
+}
+
+// Describe returns the effective settings of pr as an aligned table of
+// names and values, so that a bug report or a startup log can record
+// exactly how output was measured and formatted.
+func (pr *Printer) Describe() string {
+	c := pr.cond()
+	onOff := func(on bool) string {
+		if on {
+			return "on"
+		}
+		return "off"
+	}
+	tabs := "off"
+	if c.TabStops {
+		tw := c.TabWidth
+		if tw <= 0 {
+			tw = 8
+		}
+		tabs = "every " + strconv.Itoa(tw)
+	}
+	unicode := "go-runewidth"
+	if unicodeTables[c.Unicode] != nil {
+		unicode = c.Unicode
+	}
+	unknown := policyName(unknownNames, int(c.Unknown))
+	if c.UnknownWidth != nil {
+		unknown = "func"
+	}
+	if c.OnUnknown != nil {
+		unknown += ", reported"
+	}
+	groupSep, decimalSep := ",", "."
+	if pr.GroupSeparator != "" {
+		groupSep = pr.GroupSeparator
+	}
+	if pr.DecimalSeparator != "" {
+		decimalSep = pr.DecimalSeparator
+	}
+	codePage := "none"
+	if c.CodePage != 0 {
+		codePage = strconv.Itoa(c.CodePage)
+	}
+	locale := "unset"
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			locale = v + " (" + name + ")"
+			break
+		}
+	}
+	wrap := "off"
+	switch {
+	case pr.Wrap == WrapTerminal:
+		wrap = "terminal"
+	case pr.Wrap > 0:
+		wrap = strconv.Itoa(pr.Wrap)
+	}
+	pool := "shared"
+	switch {
+	case pr.Pool == NoPool:
+		pool = "none"
+	case pr.Pool != nil:
+		pool = "custom"
+	}
+	cache := "off"
+	if c.Cache != nil {
+		cache = strconv.Itoa(c.Cache.size) + " strings"
+	}
+	rows := [][2]string{
+		{"east-asian", onOff(c.EastAsian)},
+		{"control", policyName(controlNames, int(c.Control))},
+		{"invalid-utf8", policyName(invalidNames, int(c.Invalid))},
+		{"lines", policyName(lineNames, int(c.Lines))},
+		{"units", policyName(unitNames, int(c.Units))},
+		{"unknown", unknown},
+		{"tab-stops", tabs},
+		{"escpos", onOff(c.EscPos)},
+		{"styled-tail", onOff(c.StyledTail)},
+		{"code-page", codePage},
+		{"unicode", unicode},
+		{"width-cache", cache},
+		{"locale", locale},
+		{"wrap", wrap},
+		{"accessible", onOff(pr.Accessible)},
+		{"annotations", onOff(pr.Annotations != nil)},
+		{"sorted-maps", onOff(!pr.UnsortedMaps)},
+		{"debug", onOff(pr.Debug)},
+		{"indent", strconv.Quote(pr.Indent)},
+		{"redact", onOff(pr.Redact != nil)},
+		{"max-bytes", strconv.Itoa(pr.MaxBytes)},
+		{"max-depth", strconv.Itoa(pr.MaxDepth)},
+		{"pool", pool},
+		{"separators", strconv.Quote(groupSep) + " " + strconv.Quote(decimalSep)},
+		{"features", pr.Features().String()},
+	}
+	var b strings.Builder
+	for _, row := range rows {
+		b.WriteString(c.PadRight(row[0], 14, ' '))
+		b.WriteString(row[1])
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
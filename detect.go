@@ -0,0 +1,121 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"os"
+	"strings"
+)
+
+// cjkCodesets are the legacy multibyte codesets of CJK locales. A
+// terminal using one of them shows ambiguous characters as wide.
+var cjkCodesets = map[string]bool{
+	"eucjp":     true,
+	"euckr":     true,
+	"euccn":     true,
+	"euctw":     true,
+	"sjis":      true,
+	"shiftjis":  true,
+	"cp932":     true,
+	"cp936":     true,
+	"cp949":     true,
+	"cp950":     true,
+	"cp51932":   true,
+	"big5":      true,
+	"big5hkscs": true,
+	"gbk":       true,
+	"gb2312":    true,
+	"gb18030":   true,
+	"jis":       true,
+}
+
+// cjkCodePages are the Windows console code pages of CJK locales.
+var cjkCodePages = map[int]bool{
+	932:   true, // Japanese Shift JIS
+	936:   true, // Simplified Chinese GBK
+	949:   true, // Korean Unified Hangul Code
+	950:   true, // Traditional Chinese Big5
+	51932: true, // Japanese EUC
+}
+
+// DetectEastAsian reports whether the environment calls for East Asian
+// ambiguous characters to be shown as wide.
+//
+// RUNEWIDTH_EASTASIAN, the variable honored by go-runewidth, takes
+// precedence: if it is set and not empty, the answer is whether it is "1".
+// Otherwise, on Windows the console output code page decides. Elsewhere
+// the locale named by LC_ALL, LC_CTYPE or LANG does: CJK languages and
+// legacy CJK codesets select wide, and the @cjk_wide and @cjk_narrow
+// modifiers override. TERM=kterm selects wide, while the Linux console,
+// which cannot show wide characters, selects narrow.
+func DetectEastAsian() bool {
+	if env := os.Getenv("RUNEWIDTH_EASTASIAN"); env != "" {
+		return env == "1"
+	}
+	if cp := consoleCodePage(); cp != 0 {
+		return cjkCodePages[cp]
+	}
+	if term := os.Getenv("TERM"); term == "linux" {
+		return false
+	} else if term == "kterm" || strings.HasPrefix(term, "kterm-") {
+		return true
+	}
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			return localeEastAsian(locale)
+		}
+	}
+	return false
+}
+
+// localeEastAsian reports whether a locale name of the form
+// language[_territory][.codeset][@modifier] is East Asian.
+func localeEastAsian(locale string) bool {
+	if locale == "C" || locale == "POSIX" || strings.HasPrefix(locale, "C.") {
+		return false
+	}
+	var modifier, codeset string
+	if i := strings.IndexByte(locale, '@'); i >= 0 {
+		locale, modifier = locale[:i], strings.ToLower(locale[i+1:])
+	}
+	switch modifier {
+	case "cjk_narrow":
+		return false
+	case "cjk_wide":
+		return true
+	}
+	if i := strings.IndexByte(locale, '.'); i >= 0 {
+		locale, codeset = locale[:i], strings.ToLower(locale[i+1:])
+		codeset = strings.NewReplacer("-", "", "_", "").Replace(codeset)
+	}
+	if cjkCodesets[codeset] {
+		return true
+	}
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "_-"); i >= 0 {
+		lang = lang[:i]
+	}
+	switch lang {
+	case "ja", "ko", "zh":
+		return codeset == "" || codeset == "utf8"
+	}
+	return false
+}
+
+// AutoDetect sets DefaultCondition.EastAsian and, on Windows,
+// DefaultCondition.CodePage from the environment, as is done when the
+// package is initialized, and returns the detected EastAsian value.
+// Call it after changing the environment or the console code page, or
+// to undo an override made by assigning DefaultCondition directly.
+//
+// AutoDetect modifies DefaultCondition without synchronization, so it
+// must not run concurrently with printing: call it while the program
+// initializes, from an init function or from main before starting
+// goroutines that print.
+func AutoDetect() bool {
+	DefaultCondition.CodePage = consoleCodePage()
+	DefaultCondition.EastAsian = DetectEastAsian()
+	return DefaultCondition.EastAsian
+}
@@ -0,0 +1,31 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "crypto/sha256"
+
+// RenderDigest formats according to a format specifier under the
+// DefaultCondition and returns the result with a digest of its content.
+// See Printer.RenderDigest.
+func RenderDigest(format string, a ...interface{}) (string, [32]byte) {
+	return new(Printer).RenderDigest(format, a...)
+}
+
+// RenderDigest returns pr.Sprintf(format, a...) together with the
+// SHA-256 of a canonical rendering of the same call, in which every
+// non-nil pointer prints the same and every time.Time prints as
+// "<time>". Maps are printed in sorted key order in any case, so the
+// digest changes only when the content of a report does, not when it
+// merely holds different pointers or timestamps. The canonical
+// rendering is taken before the output of pr is wrapped, rewritten or
+// post-processed.
+func (pr *Printer) RenderDigest(format string, a ...interface{}) (string, [32]byte) {
+	p := pr.newPrinter()
+	p.canonical = true
+	p.doPrintf(format, a)
+	sum := sha256.Sum256(p.buf)
+	p.free()
+	return pr.Sprintf(format, a...), sum
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+type digestRow struct {
+	Name    string
+	Updated time.Time
+}
+
+func TestRenderDigest(t *testing.T) {
+	t1 := time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	a := &digestRow{Name: "売上", Updated: t1}
+	b := &digestRow{Name: "売上", Updated: t2}
+
+	out1, sum1 := RenderDigest("%-6s %v %p %v\n", a.Name, t1, a, map[string]int{"x": 1, "y": 2})
+	out2, sum2 := RenderDigest("%-6s %v %p %v\n", b.Name, t2, b, map[string]int{"y": 2, "x": 1})
+	if out1 == out2 {
+		t.Errorf("outputs are equal: %q", out1)
+	}
+	if sum1 != sum2 {
+		t.Errorf("digests differ for %q and %q", out1, out2)
+	}
+	if want := "売上   2019-04-01 09:00:00 +0000 UTC"; out1[:len(want)] != want {
+		t.Errorf("output = %q want prefix %q", out1, want)
+	}
+
+	_, sum3 := RenderDigest("%-6s %v %p %v\n", "在庫", t1, a, map[string]int{"x": 1, "y": 2})
+	if sum3 == sum1 {
+		t.Error("digest did not change with the content")
+	}
+	_, sum4 := RenderDigest("%v %p", (*digestRow)(nil), nil)
+	_, sum5 := RenderDigest("%v %p", a, nil)
+	if sum4 == sum5 {
+		t.Error("digest does not distinguish a nil pointer")
+	}
+}
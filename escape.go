@@ -0,0 +1,411 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// seqLen returns the length of the escape sequence at the start of s,
+// or 0 if s does not start with one that c recognizes. Commands that
+// change the printed size of characters update *scale, the factor
+// applied to the width of the characters that follow.
+func (c *Condition) seqLen(s string, scale *int) int {
+	if len(s) == 0 {
+		return 0
+	}
+	if reg := registeredSequences(); reg.starts[s[0]] {
+		if n := reg.match(s); n > 0 {
+			return n
+		}
+	}
+	if c.EscPos {
+		if n := escPosLen(s, scale); n > 0 {
+			return n
+		}
+	}
+	if isEscapeStart(s[0]) {
+		return escapeLen(s)
+	}
+	return 0
+}
+
+// maySeq reports whether b may start an escape sequence that c recognizes.
+func (c *Condition) maySeq(b byte) bool {
+	return isEscapeStart(b) || c.EscPos && isEscPosStart(b) || registeredSequences().starts[b]
+}
+
+// A SequenceMatcher returns the length of the invisible sequence at the
+// start of s, or 0 if s does not start with one.
+type SequenceMatcher func(s string) int
+
+type sequenceMatcher struct {
+	prefix string
+	match  SequenceMatcher
+}
+
+// sequenceRegistry holds the registered matchers. It is never modified
+// once published, so that it can be read without locking.
+type sequenceRegistry struct {
+	starts   [256]bool // first bytes of the prefixes
+	matchers []sequenceMatcher
+	// printableStarts is set if a prefix starts with a printable ASCII
+	// character, which asciiRun must then look for.
+	printableStarts bool
+}
+
+func (reg *sequenceRegistry) match(s string) int {
+	for _, m := range reg.matchers {
+		if strings.HasPrefix(s, m.prefix) {
+			if n := m.match(s); n > 0 {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+var (
+	sequencesMu sync.Mutex // serializes RegisterSequence and UnregisterSequence
+	sequences   atomic.Value
+)
+
+func registeredSequences() *sequenceRegistry {
+	reg, _ := sequences.Load().(*sequenceRegistry)
+	if reg == nil {
+		return &emptyRegistry
+	}
+	return reg
+}
+
+var emptyRegistry sequenceRegistry
+
+// RegisterSequence registers a recognizer for sequences that occupy no
+// cells, such as proprietary terminal commands, so that padding and
+// truncation skip them like the ANSI sequences recognized by default.
+// m is only called on text starting with prefix, which must not be empty.
+// Registered sequences are recognized by every Condition and take
+// precedence over the built-in ones.
+func RegisterSequence(prefix string, m SequenceMatcher) {
+	if prefix == "" {
+		panic("wfmt: RegisterSequence with empty prefix")
+	}
+	sequencesMu.Lock()
+	defer sequencesMu.Unlock()
+	old := registeredSequences()
+	reg := &sequenceRegistry{starts: old.starts, printableStarts: old.printableStarts}
+	reg.matchers = append(reg.matchers, old.matchers...)
+	reg.matchers = append(reg.matchers, sequenceMatcher{prefix, m})
+	reg.starts[prefix[0]] = true
+	if ' ' <= prefix[0] && prefix[0] < 0x7F {
+		reg.printableStarts = true
+	}
+	sequences.Store(reg)
+}
+
+// UnregisterSequence removes the recognizers registered for prefix by
+// RegisterSequence or RegisterDelimited.
+func UnregisterSequence(prefix string) {
+	sequencesMu.Lock()
+	defer sequencesMu.Unlock()
+	old := registeredSequences()
+	i := 0
+	for i < len(old.matchers) && old.matchers[i].prefix != prefix {
+		i++
+	}
+	if i == len(old.matchers) {
+		return
+	}
+	reg := new(sequenceRegistry)
+	for _, m := range old.matchers {
+		if m.prefix == prefix {
+			continue
+		}
+		reg.matchers = append(reg.matchers, m)
+		reg.starts[m.prefix[0]] = true
+		if ' ' <= m.prefix[0] && m.prefix[0] < 0x7F {
+			reg.printableStarts = true
+		}
+	}
+	sequences.Store(reg)
+}
+
+// RegisterDelimited registers sequences that run from prefix to the
+// first following suffix, inclusive. An unterminated sequence is not
+// recognized.
+func RegisterDelimited(prefix, suffix string) {
+	RegisterSequence(prefix, func(s string) int {
+		if i := strings.Index(s[len(prefix):], suffix); i >= 0 {
+			return len(prefix) + i + len(suffix)
+		}
+		return 0
+	})
+}
+
+// TmuxPassthrough matches the DCS sequences tmux passes through to the
+// outer terminal, ESC P tmux; ... ESC \, in which every ESC of the
+// wrapped sequence is doubled. Register it with
+//
+//	RegisterSequence("\x1bPtmux;", TmuxPassthrough)
+func TmuxPassthrough(s string) int {
+	const prefix = "\x1bPtmux;"
+	if !strings.HasPrefix(s, prefix) {
+		return 0
+	}
+	for i := len(prefix); i+1 < len(s); i++ {
+		if s[i] != 0x1B {
+			continue
+		}
+		switch s[i+1] {
+		case 0x1B:
+			i++ // doubled ESC
+		case '\\':
+			return i + 2
+		}
+	}
+	return 0
+}
+
+// escapeLen returns the length of the terminal escape sequence at the
+// start of s, or 0 if s does not start with one. It recognizes ANSI
+// control sequences (CSI), such as the SGR sequences that set colors,
+// introduced by either ESC [ or the C1 control U+009B, and operating
+// system commands (OSC), such as OSC 8 hyperlinks, introduced by
+// ESC ] or U+009D.
+func escapeLen(s string) int {
+	if len(s) < 2 {
+		return 0
+	}
+	i := 0
+	switch {
+	case s[0] == 0x1B && s[1] == '[':
+		i = 2
+	case s[0] == 0xC2 && s[1] == 0x9B:
+		i = 2
+	case s[0] == 0x1B && s[1] == ']':
+		return oscLen(s, 2)
+	case s[0] == 0xC2 && s[1] == 0x9D:
+		return oscLen(s, 2)
+	default:
+		return 0
+	}
+	// Parameter bytes, then intermediate bytes, then the final byte.
+	for i < len(s) && 0x30 <= s[i] && s[i] <= 0x3F {
+		i++
+	}
+	for i < len(s) && 0x20 <= s[i] && s[i] <= 0x2F {
+		i++
+	}
+	if i < len(s) && 0x40 <= s[i] && s[i] <= 0x7E {
+		return i + 1
+	}
+	return 0
+}
+
+// oscLen returns the length of the operating system command at the
+// start of s, whose payload starts at s[i], or 0 if it is unterminated.
+// The payload ends with BEL or with the string terminator, ESC \ or U+009C.
+func oscLen(s string, i int) int {
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case 0x07:
+			return i + 1
+		case 0x1B:
+			if i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+			return 0
+		case 0xC2:
+			if i+1 < len(s) && s[i+1] == 0x9C {
+				return i + 2
+			}
+		}
+	}
+	return 0
+}
+
+// isEscapeStart reports whether c may start a sequence recognized by escapeLen.
+func isEscapeStart(c byte) bool {
+	return c == 0x1B || c == 0xC2
+}
+
+// A styleState tracks the SGR attributes and the OSC 8 hyperlink left
+// open by the escape sequences of a string, so that text cut short can
+// be closed before the output goes on.
+type styleState struct {
+	sgr  []string // SGR sequences since the last reset
+	link bool     // whether a hyperlink is open
+}
+
+// update records the effect of the escape sequence seq.
+func (st *styleState) update(seq string) {
+	var body string
+	switch {
+	case strings.HasPrefix(seq, "\x1b["):
+		body = seq[2:]
+	case strings.HasPrefix(seq, "\u009b"):
+		body = seq[len("\u009b"):]
+	case strings.HasPrefix(seq, "\x1b]8;"), strings.HasPrefix(seq, "\u009d8;"):
+		// OSC 8 ; params ; URI ST, where an empty URI closes the link.
+		i := strings.IndexByte(seq, ';') + 1
+		j := strings.IndexByte(seq[i:], ';')
+		if j < 0 {
+			return
+		}
+		uri := strings.TrimRight(seq[i+j+1:], "\a\x1b\\\u009c")
+		st.link = uri != ""
+		return
+	default:
+		return
+	}
+	if len(body) == 0 || body[len(body)-1] != 'm' {
+		return
+	}
+	switch body[:len(body)-1] {
+	case "", "0":
+		st.sgr = st.sgr[:0]
+	default:
+		st.sgr = append(st.sgr, seq)
+	}
+}
+
+// open reports whether any style or hyperlink is left open.
+func (st *styleState) open() bool {
+	return len(st.sgr) > 0 || st.link
+}
+
+// close returns the sequences that reset the style and close the link.
+func (st *styleState) close() string {
+	s := ""
+	if len(st.sgr) > 0 {
+		s += "\x1b[0m"
+	}
+	if st.link {
+		s += "\x1b]8;;\x1b\\"
+	}
+	return s
+}
+
+// ESC/POS control codes.
+const (
+	escPosESC = 0x1B
+	escPosGS  = 0x1D
+	escPosFS  = 0x1C
+	escPosSO  = 0x0E // double width for the rest of the line
+	escPosDC4 = 0x14 // cancel SO
+)
+
+// isEscPosStart reports whether b may start an ESC/POS command.
+func isEscPosStart(b byte) bool {
+	switch b {
+	case escPosESC, escPosGS, escPosFS, escPosSO, escPosDC4:
+		return true
+	}
+	return false
+}
+
+// escPosLen returns the length of the ESC/POS command at the start of s,
+// or 0 if s does not start with one. The commands that select double
+// width or character size update *scale.
+func escPosLen(s string, scale *int) int {
+	switch s[0] {
+	case escPosSO:
+		*scale = 2
+		return 1
+	case escPosDC4:
+		*scale = 1
+		return 1
+	}
+	if len(s) < 2 {
+		return 0
+	}
+	arg := func(n int) bool { return len(s) >= n }
+	switch s[0] {
+	case escPosESC:
+		switch s[1] {
+		case '@': // initialize printer
+			*scale = 1
+			return 2
+		case escPosSO:
+			*scale = 2
+			return 2
+		case escPosDC4:
+			*scale = 1
+			return 2
+		case '!': // select print mode; bit 5 is double width
+			if !arg(3) {
+				return 0
+			}
+			*scale = 1
+			if s[2]&0x20 != 0 {
+				*scale = 2
+			}
+			return 3
+		case 'E', '-', 'G', 'M', 'a', 'd', 'J', 't', 'R', '{', 'V', 'r', '3':
+			// One-byte parameter: emphasis, underline, double strike,
+			// font, justification, feeds, code table, rotation, color
+			// and line spacing.
+			if !arg(3) {
+				return 0
+			}
+			return 3
+		case '2': // default line spacing
+			return 2
+		case '$', '\\': // absolute and relative position
+			if !arg(4) {
+				return 0
+			}
+			return 4
+		case 'p': // pulse cash drawer
+			if !arg(5) {
+				return 0
+			}
+			return 5
+		}
+	case escPosGS:
+		switch s[1] {
+		case '!': // select character size; high nibble is width - 1
+			if !arg(3) {
+				return 0
+			}
+			*scale = int(s[2]>>4&7) + 1
+			return 3
+		case 'B', 'b', 'h', 'w', 'H', 'f':
+			if !arg(3) {
+				return 0
+			}
+			return 3
+		case 'V': // cut paper
+			if !arg(3) {
+				return 0
+			}
+			if s[2] == 65 || s[2] == 66 {
+				if !arg(4) {
+					return 0
+				}
+				return 4
+			}
+			return 3
+		case 'L', 'W': // left margin, print area width
+			if !arg(4) {
+				return 0
+			}
+			return 4
+		}
+	case escPosFS:
+		switch s[1] {
+		case '&', '.': // Kanji mode on and off
+			return 2
+		case '!', '-', 'W':
+			if !arg(3) {
+				return 0
+			}
+			return 3
+		}
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"reflect"
+	"sort"
+)
+
+// printCommon prints with %v the slices and maps that debug output is
+// most often made of without walking them by reflection, as printValue
+// would, and reports whether arg was one of them. The output is the
+// same: their elements have no methods to consult.
+func (p *pp) printCommon(arg interface{}, verb rune) bool {
+	if verb != 'v' || p.fmt.sharpV {
+		return false
+	}
+	switch f := arg.(type) {
+	case []string:
+		if p.openList(len(f)) {
+			for i := 0; i < len(f) && !p.full(); i++ {
+				p.nextListElement(i)
+				p.fmtString(f[i], verb)
+			}
+			p.closeList()
+		}
+	case []int:
+		if p.openList(len(f)) {
+			for i := 0; i < len(f) && !p.full(); i++ {
+				p.nextListElement(i)
+				p.fmtInteger(uint64(f[i]), signed, verb)
+			}
+			p.closeList()
+		}
+	case []float64:
+		if p.openList(len(f)) {
+			for i := 0; i < len(f) && !p.full(); i++ {
+				p.nextListElement(i)
+				p.fmtFloat(f[i], 64, verb)
+			}
+			p.closeList()
+		}
+	case map[string]string:
+		p.buf.WriteString(mapString)
+		if !p.enter(len(f)) {
+			p.buf.WriteByte(']')
+			break
+		}
+		for i, k := range p.stringKeys(f, nil) {
+			if p.full() {
+				break
+			}
+			p.nextListElement(i)
+			p.fmtString(k, verb)
+			p.buf.WriteByte(':')
+			p.fmtString(f[k], verb)
+		}
+		p.closeList()
+	case map[string]interface{}:
+		p.buf.WriteString(mapString)
+		if !p.enter(len(f)) {
+			p.buf.WriteByte(']')
+			break
+		}
+		for i, k := range p.stringKeys(nil, f) {
+			if p.full() {
+				break
+			}
+			p.nextListElement(i)
+			p.fmtString(k, verb)
+			p.buf.WriteByte(':')
+			p.printElement(f[k], verb)
+		}
+		p.closeList()
+	default:
+		return false
+	}
+	return true
+}
+
+// openList writes the opening bracket of a list of n elements printed
+// with %v and reports whether they are to be printed, as enter does.
+func (p *pp) openList(n int) bool {
+	p.buf.WriteByte('[')
+	if !p.enter(n) {
+		p.buf.WriteByte(']')
+		return false
+	}
+	return true
+}
+
+// nextListElement writes the space before the element i of a list.
+func (p *pp) nextListElement(i int) {
+	if i > 0 {
+		p.buf.WriteByte(' ')
+	}
+}
+
+// closeList writes the closing bracket of a list opened by openList or
+// of a map entered with enter.
+func (p *pp) closeList() {
+	p.nest--
+	p.buf.WriteByte(']')
+}
+
+// stringKeys returns the keys of m or, if m is nil, of mi, sorted unless
+// p prints maps in iteration order.
+func (p *pp) stringKeys(m map[string]string, mi map[string]interface{}) []string {
+	var keys []string
+	if m != nil {
+		keys = make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+	} else {
+		keys = make([]string, 0, len(mi))
+		for k := range mi {
+			keys = append(keys, k)
+		}
+	}
+	if !p.unsorted || p.canonical {
+		sort.Strings(keys)
+	}
+	return keys
+}
+
+// printElement prints v, an element of a map[string]interface{}, as
+// printValue prints the value of an interface nested in another value.
+func (p *pp) printElement(v interface{}, verb rune) {
+	switch f := v.(type) {
+	case nil:
+		p.buf.WriteString(nilAngleString)
+	case string:
+		p.fmtString(f, verb)
+	case int:
+		p.fmtInteger(uint64(f), signed, verb)
+	case float64:
+		p.fmtFloat(f, 64, verb)
+	case bool:
+		p.fmtBool(f, verb)
+	default:
+		p.printValue(reflect.ValueOf(v), verb, 1)
+	}
+}
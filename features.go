@@ -0,0 +1,183 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"errors"
+	"strings"
+)
+
+// A FeatureSet is a set of the extensions wfmt makes to the fmt format
+// language and to width measurement. Libraries that ship format strings
+// can check that the Printer they are given enables the features their
+// output relies on; see Printer.Require.
+type FeatureSet uint64
+
+// The features. Those marked as always enabled are part of every
+// Printer; the others depend on its options and Condition.
+const (
+	FeatureDisplayWidth  FeatureSet = 1 << iota // widths and precisions count cells; always enabled
+	FeatureEscapes                              // ANSI and OSC sequences occupy no cells; always enabled
+	FeatureStyleClose                           // truncation closes open styles; always enabled
+	FeatureEastAsian                            // ambiguous characters are wide
+	FeatureControlEscape                        // control characters are printed as escapes
+	FeatureEscPos                               // ESC/POS commands occupy no cells
+	FeatureTabStops                             // tabs advance to tab stops
+	FeatureCodePage                             // widths follow a CJK console code page
+	FeatureUnicodeTables                        // widths follow bundled Unicode tables
+	FeatureSequences                            // registered sequences occupy no cells
+	FeatureWrap                                 // output is soft-wrapped
+	FeatureAccessible                           // output is rewritten for screen readers
+	FeatureAnnotations                          // field layouts are reported
+	FeatureInvalidUTF8                          // invalid UTF-8 is replaced, escaped or rejected
+	FeatureTextBytes                            // the %a verb prints text with binary escaped; always enabled
+	FeatureMultiLine                            // widths apply to the lines of multi-line strings
+	FeatureWidthUnits                           // widths may count bytes, runes or columns; always enabled
+	FeatureUnknownWidth                         // characters missing from the width data are measured by policy
+	FeatureCenter                               // the ^ flag centers operands; always enabled
+	FeatureFill                                 // the ' flag sets the pad rune; always enabled
+	FeatureEllipsis                             // the > flag marks text cut by the precision; always enabled
+	FeatureGrouping                             // the , flag groups digits by thousands; always enabled
+	FeatureUnderscores                          // the _ flag groups integer digits as in Go literals; always enabled
+	FeatureSIPrefix                             // the %h verb prints numbers with SI prefixes; always enabled
+	FeatureDuration                             // the %D verb prints rounded durations; always enabled
+	FeatureTimeLayout                           // %{layout}t formats times; always enabled
+	FeatureJSON                                 // the %j verb prints JSON; always enabled
+	FeatureMarshalers                           // registered verbs print operands in other encodings
+	FeatureHexdump                              // the %H verb prints bytes as hexdump -C does; always enabled
+	FeatureEngineering                          // the %n verb prints floats in engineering notation; always enabled
+	FeatureRadix                                // the %r verb prints integers in any base; always enabled
+)
+
+var featureNames = []string{
+	"width",
+	"escapes",
+	"style-close",
+	"east-asian",
+	"control-escape",
+	"escpos",
+	"tab-stops",
+	"code-page",
+	"unicode-tables",
+	"sequences",
+	"wrap",
+	"accessible",
+	"annotations",
+	"invalid-utf8",
+	"text-bytes",
+	"multi-line",
+	"width-units",
+	"unknown-width",
+	"center",
+	"fill",
+	"ellipsis",
+	"grouping",
+	"underscores",
+	"si-prefix",
+	"duration",
+	"time-layout",
+	"json",
+	"marshalers",
+	"hexdump",
+	"engineering",
+	"radix",
+}
+
+// SupportedFeatures returns every feature this version of the package
+// implements.
+func SupportedFeatures() FeatureSet {
+	return 1<<uint(len(featureNames)) - 1
+}
+
+// Has reports whether fs includes all of the features of f.
+func (fs FeatureSet) Has(f FeatureSet) bool {
+	return fs&f == f
+}
+
+// String returns the names of the features in fs separated by commas,
+// as accepted by ParseFeatures.
+func (fs FeatureSet) String() string {
+	var names []string
+	for i, name := range featureNames {
+		if fs&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseFeatures returns the FeatureSet named by a comma-separated list
+// of feature names, such as "width,wrap". Unknown names are reported
+// in the error, which allows a library to detect a newer feature than
+// the package it is built with provides.
+func ParseFeatures(s string) (FeatureSet, error) {
+	var fs FeatureSet
+	var unknown []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for i, n := range featureNames {
+			if n == name {
+				fs |= 1 << uint(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fs, errors.New("wfmt: unknown features " + strings.Join(unknown, ","))
+	}
+	return fs, nil
+}
+
+// Features returns the features enabled by pr.
+func (pr *Printer) Features() FeatureSet {
+	c := pr.cond()
+	fs := FeatureDisplayWidth | FeatureEscapes | FeatureStyleClose | FeatureTextBytes | FeatureWidthUnits | FeatureCenter | FeatureFill | FeatureEllipsis | FeatureGrouping | FeatureUnderscores | FeatureSIPrefix | FeatureDuration | FeatureTimeLayout | FeatureJSON | FeatureHexdump | FeatureEngineering | FeatureRadix
+	set := func(f FeatureSet, on bool) {
+		if on {
+			fs |= f
+		}
+	}
+	set(FeatureEastAsian, c.EastAsian)
+	set(FeatureControlEscape, c.Control == ControlEscape)
+	set(FeatureInvalidUTF8, c.Invalid != InvalidKeep)
+	set(FeatureMultiLine, c.Lines != LinesWhole)
+	set(FeatureUnknownWidth, c.Unknown != UnknownNarrow || c.UnknownWidth != nil)
+	set(FeatureEscPos, c.EscPos)
+	set(FeatureTabStops, c.TabStops)
+	set(FeatureCodePage, cjkCodePages[c.CodePage])
+	set(FeatureUnicodeTables, unicodeTables[c.Unicode] != nil)
+	set(FeatureSequences, len(registeredSequences().matchers) > 0)
+	set(FeatureMarshalers, len(registeredMarshalers()) > 0)
+	set(FeatureWrap, pr.Wrap != 0)
+	set(FeatureAccessible, pr.Accessible)
+	set(FeatureAnnotations, pr.Annotations != nil)
+	return fs
+}
+
+// A FeatureError reports features a Printer does not enable.
+type FeatureError struct {
+	Missing FeatureSet
+}
+
+func (e *FeatureError) Error() string {
+	return "wfmt: features not enabled: " + e.Missing.String()
+}
+
+// Require returns a *FeatureError if pr does not enable all of the
+// features of fs.
+func (pr *Printer) Require(fs FeatureSet) error {
+	if missing := fs &^ pr.Features(); missing != 0 {
+		return &FeatureError{Missing: missing}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A MarkerStyle selects how footnote markers are written.
+type MarkerStyle int
+
+const (
+	// SuperscriptMarkers writes markers as superscript digits: ¹ ² ³.
+	SuperscriptMarkers MarkerStyle = iota
+	// BracketMarkers writes markers as bracketed numbers: [1] [2] [3].
+	BracketMarkers
+)
+
+var superscripts = [10]string{"⁰", "¹", "²", "³", "⁴", "⁵", "⁶", "⁷", "⁸", "⁹"}
+
+// marker returns the marker for footnote number n.
+func (s MarkerStyle) marker(n int) string {
+	digits := strconv.Itoa(n)
+	if s == BracketMarkers {
+		return "[" + digits + "]"
+	}
+	var b strings.Builder
+	for i := 0; i < len(digits); i++ {
+		b.WriteString(superscripts[digits[i]-'0'])
+	}
+	return b.String()
+}
+
+// Footnotes collects the notes attached to report cells. Each distinct
+// note is numbered in order of first use, and Mark appends its marker to
+// the annotated cell. Once the report body is written, WriteTo renders
+// the notes as a block.
+//
+// Markers are measured like any other text, so the superscript digits,
+// which are East Asian ambiguous, count as wide when the Condition says so.
+// Use MarkerWidth to reserve room for markers when sizing columns.
+type Footnotes struct {
+	// Style selects the marker style.
+	Style MarkerStyle
+	// Condition measures markers; DefaultCondition if nil.
+	Condition *Condition
+
+	notes []string
+	index map[string]int
+}
+
+func (f *Footnotes) cond() *Condition {
+	if f.Condition != nil {
+		return f.Condition
+	}
+	return DefaultCondition
+}
+
+// Marker returns the marker for note, numbering the note if it has not
+// been seen before.
+func (f *Footnotes) Marker(note string) string {
+	n, ok := f.index[note]
+	if !ok {
+		if f.index == nil {
+			f.index = make(map[string]int)
+		}
+		f.notes = append(f.notes, note)
+		n = len(f.notes)
+		f.index[note] = n
+	}
+	return f.Style.marker(n)
+}
+
+// Mark returns cell followed by the marker for note.
+func (f *Footnotes) Mark(cell, note string) string {
+	return cell + f.Marker(note)
+}
+
+// Markf returns cell followed by the marker for the note formatted
+// according to a format specifier.
+func (f *Footnotes) Markf(cell, format string, a ...interface{}) string {
+	return f.Mark(cell, Sprintf(format, a...))
+}
+
+// Len returns the number of notes collected.
+func (f *Footnotes) Len() int {
+	return len(f.notes)
+}
+
+// MarkerWidth returns the width in cells of the widest marker assigned
+// so far. Adding it to the width of unmarked cells keeps marked and
+// unmarked cells of a column aligned.
+func (f *Footnotes) MarkerWidth() int {
+	w := 0
+	for n := 1; n <= len(f.notes); n++ {
+		if mw := f.cond().StringWidth(f.Style.marker(n)); mw > w {
+			w = mw
+		}
+	}
+	return w
+}
+
+// WriteTo writes the footnote block to w, one note per line, with the
+// markers right-aligned. Lines after the first of a multi-line note are
+// indented to the start of the note text.
+func (f *Footnotes) WriteTo(w io.Writer) (n int64, err error) {
+	mw := f.MarkerWidth()
+	indent := strings.Repeat(" ", mw+1)
+	p := newPrinter()
+	defer p.free()
+	for i, note := range f.notes {
+		marker := f.Style.marker(i + 1)
+		p.buf.WriteString(strings.Repeat(" ", mw-f.cond().StringWidth(marker)))
+		p.buf.WriteString(marker)
+		p.buf.WriteByte(' ')
+		p.buf.WriteString(strings.Replace(note, "\n", "\n"+indent, -1))
+		p.buf.WriteByte('\n')
+	}
+	nw, err := w.Write(p.buf)
+	return int64(nw), err
+}
+
+// String returns the footnote block as written by WriteTo.
+func (f *Footnotes) String() string {
+	var b strings.Builder
+	f.WriteTo(&b)
+	return b.String()
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestFootnotes(t *testing.T) {
+	var f Footnotes
+	cells := []string{
+		f.Mark("1,200", "未監査"),
+		"980",
+		f.Markf("3,400", "restated in %d", 2019),
+		f.Mark("75", "未監査"),
+	}
+	want := []string{"1,200¹", "980", "3,400²", "75¹"}
+	for i := range cells {
+		if cells[i] != want[i] {
+			t.Errorf("cell %d = %q want %q", i, cells[i], want[i])
+		}
+	}
+	if f.Len() != 2 || f.MarkerWidth() != 1 {
+		t.Errorf("Len, MarkerWidth = %d, %d want 2, 1", f.Len(), f.MarkerWidth())
+	}
+	if got, want := Sprintf("%*s%*s|", 5, "980", f.MarkerWidth(), ""), "  980 |"; got != want {
+		t.Errorf("padded cell = %q want %q", got, want)
+	}
+	if got, want := f.String(), "¹ 未監査\n² restated in 2019\n"; got != want {
+		t.Errorf("block = %q want %q", got, want)
+	}
+}
+
+func TestFootnotesBrackets(t *testing.T) {
+	f := Footnotes{Style: BracketMarkers}
+	for i := 0; i < 10; i++ {
+		f.Marker(Sprint("note ", i))
+	}
+	f.Marker("two\nlines")
+	if f.MarkerWidth() != 4 {
+		t.Errorf("MarkerWidth() = %d want 4", f.MarkerWidth())
+	}
+	want := " [1] note 0\n" +
+		" [2] note 1\n" +
+		" [3] note 2\n" +
+		" [4] note 3\n" +
+		" [5] note 4\n" +
+		" [6] note 5\n" +
+		" [7] note 6\n" +
+		" [8] note 7\n" +
+		" [9] note 8\n" +
+		"[10] note 9\n" +
+		"[11] two\n" +
+		"     lines\n"
+	if got := f.String(); got != want {
+		t.Errorf("block =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -5,15 +5,19 @@
 package wfmt
 
 import (
+	"math"
 	"strconv"
+	"strings"
+	"time"
 	"unicode/utf8"
-
-	"github.com/mattn/go-runewidth"
 )
 
 const (
 	ldigits = "0123456789abcdefx"
 	udigits = "0123456789ABCDEFX"
+
+	radixDigits  = "0123456789abcdefghijklmnopqrstuvwxyz"
+	uradixDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 )
 
 const (
@@ -30,24 +34,41 @@ type fmtFlags struct {
 	sharp       bool
 	space       bool
 	zero        bool
+	center      bool
+	fill        rune // pad rune set with the ' flag, or 0 for the default
+	ellipsis    bool // mark text cut by the precision
+	group       bool // group the digits of decimal numbers by thousands
+	underscore  bool // group the digits of integers with underscores
 
 	// For the formats %+v %#v, we set the plusV/sharpV flags
 	// and clear the plus/sharp flags since %+v and %#v are in effect
 	// different, flagless formats set at the top level.
 	plusV  bool
 	sharpV bool
+
+	// unit, if not UnitDefault, overrides the units of cond for this verb.
+	unit WidthUnit
 }
 
 // A fmt is the raw formatter used by Printf etc.
 // It prints into a buffer that must be set up separately.
 type fmt struct {
-	buf *buffer
+	buf  *buffer
+	cond *Condition // rules for measuring display width
 
 	fmtFlags
 
 	wid  int // width
 	prec int // precision
 
+	// groupSep and decimalSep are the separators of numbers printed
+	// with the , flag; "," and "." if empty.
+	groupSep, decimalSep string
+
+	// sink, if not nil, takes the output in chunks while long encodings
+	// are formatted.
+	sink *sink
+
 	// intbuf is large enough to store %b of an int64 with a sign and
 	// avoids padding at the end of the struct on 32 bit architectures.
 	intbuf [68]byte
@@ -55,18 +76,57 @@ type fmt struct {
 
 func (f *fmt) clearflags() {
 	f.fmtFlags = fmtFlags{}
+	f.wid = 0
+	f.prec = 0
 }
 
-func (f *fmt) init(buf *buffer) {
+func (f *fmt) init(buf *buffer, cond *Condition) {
 	f.buf = buf
+	f.cond = cond
+	f.groupSep, f.decimalSep = "", ""
+	f.sink = nil
 	f.clearflags()
 }
 
+// fmtGrouped formats a number with format, unpadded, replaces its
+// decimal point with dec, if not empty, groups the digits of its
+// integral part by n with sep and pads the result. The digits of an
+// integer may be hexadecimal. Zero padding is not grouped and gives way
+// to spaces.
+func (f *fmt) fmtGrouped(sep, dec string, n int, integer bool, format func()) {
+	flags := f.fmtFlags
+	f.widPresent, f.zero, f.group, f.underscore = false, false, false, false
+	start := len(*f.buf)
+	format()
+	num := string((*f.buf)[start:])
+	if dec != "" && dec != "." {
+		num = strings.Replace(num, ".", dec, 1)
+	}
+	num = groupLeading(num, sep, n, integer)
+	*f.buf = (*f.buf)[:start]
+	f.fmtFlags = flags
+	f.zero = false
+	f.padString(num)
+	f.fmtFlags = flags
+}
+
+// groupSeparator returns the separator of thousands for the , flag.
+func (f *fmt) groupSeparator() string {
+	if f.groupSep == "" {
+		return ","
+	}
+	return f.groupSep
+}
+
 // writePadding generates n bytes of padding.
 func (f *fmt) writePadding(n int) {
 	if n <= 0 { // No padding bytes needed.
 		return
 	}
+	if f.fill != 0 {
+		f.writeFill(n)
+		return
+	}
 	buf := *f.buf
 	oldLen := len(buf)
 	newLen := oldLen + n
@@ -88,17 +148,109 @@ func (f *fmt) writePadding(n int) {
 	*f.buf = buf[:newLen]
 }
 
-// pad appends b to f.buf, padded on left (!f.minus) or right (f.minus).
+// writeFill generates n units of padding with the fill rune: as many
+// fill runes as fit, followed by spaces for what a wide fill rune
+// cannot cover.
+func (f *fmt) writeFill(n int) {
+	var w int
+	switch f.units() {
+	case UnitBytes:
+		w = utf8.RuneLen(f.fill)
+	case UnitRunes:
+		w = 1
+	default:
+		w = f.cond.RuneWidth(f.fill)
+	}
+	fill := f.fill
+	if w <= 0 {
+		fill, w = ' ', 1
+	}
+	for ; n >= w; n -= w {
+		f.buf.WriteRune(fill)
+	}
+	for ; n > 0; n-- {
+		f.buf.WriteByte(' ')
+	}
+}
+
+// units returns the units counted by the width and precision.
+func (f *fmt) units() WidthUnit {
+	if f.unit != UnitDefault {
+		return f.unit
+	}
+	return f.cond.Units
+}
+
+// measure returns the width of s in the units of the verb.
+func (f *fmt) measure(s string) int {
+	u := f.units()
+	if u == UnitDefault || u == UnitColumns {
+		return f.cond.StringWidth(s)
+	}
+	n, scale := 0, 1
+	for i := 0; i < len(s); {
+		if e := f.cond.seqLen(s[i:], &scale); e > 0 {
+			i += e
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		if u == UnitBytes {
+			n += size
+		} else {
+			n++
+		}
+		i += size
+	}
+	return n
+}
+
+// advance returns the length in bytes of the character at the start of
+// s, a grapheme cluster when counting columns and otherwise a rune, and
+// what it counts towards the precision.
+func (f *fmt) advance(s string, scale int) (size, count int) {
+	switch f.units() {
+	case UnitColumns:
+		size = f.cond.clusterLen(s)
+		return size, scale * f.cond.clusterWidth(s[:size])
+	case UnitBytes:
+		_, size = utf8.DecodeRuneInString(s)
+		return size, size
+	}
+	size = 1
+	if s[0] >= utf8.RuneSelf {
+		_, size = utf8.DecodeRuneInString(s)
+	}
+	return size, 1
+}
+
+// writeCentered writes the padding around text whose width falls short
+// of the field by width, with the odd cell, if any, on the right.
+func (f *fmt) writeCentered(width int, write func()) {
+	left := width / 2
+	if left < 0 {
+		left = 0
+	}
+	f.writePadding(left)
+	write()
+	f.writePadding(width - left)
+}
+
+// pad appends b to f.buf, padded on left (!f.minus) or right (f.minus),
+// or on both sides (f.center).
 func (f *fmt) pad(b []byte) {
 	if !f.widPresent || f.wid == 0 {
 		f.buf.Write(b)
 		return
 	}
 	var width int
-	if string(b) == "\t" {
+	if string(b) == "\t" && !f.cond.TabStops {
 		width = f.wid - utf8.RuneCount(b)
 	} else {
-		width = f.wid - runewidth.StringWidth(string(b))
+		width = f.wid - f.measure(bytesString(b))
+	}
+	if f.center {
+		f.writeCentered(width, func() { f.buf.Write(b) })
+		return
 	}
 	if !f.minus {
 		// left padding
@@ -111,7 +263,8 @@ func (f *fmt) pad(b []byte) {
 	}
 }
 
-// padString appends s to f.buf, padded on left (!f.minus) or right (f.minus).
+// padString appends s to f.buf, padded on left (!f.minus) or right (f.minus),
+// or on both sides (f.center).
 func (f *fmt) padString(s string) {
 	if !f.widPresent || f.wid == 0 {
 		f.buf.WriteString(s)
@@ -120,10 +273,14 @@ func (f *fmt) padString(s string) {
 	var width int
 	if s == "`\t`" {
 		width = f.wid - utf8.RuneCountInString(s)
-	} else if s == "\t" {
+	} else if s == "\t" && !f.cond.TabStops {
 		width = f.wid - utf8.RuneCountInString(s)
 	} else {
-		width = f.wid - runewidth.StringWidth(s)
+		width = f.wid - f.measure(s)
+	}
+	if f.center {
+		f.writeCentered(width, func() { f.buf.WriteString(s) })
+		return
 	}
 	if !f.minus {
 		// left padding
@@ -206,6 +363,19 @@ func (f *fmt) fmtUnicode(u uint64) {
 
 // fmtInteger formats signed and unsigned integers.
 func (f *fmt) fmtInteger(u uint64, base int, isSigned bool, verb rune, digits string) {
+	if f.underscore {
+		// Group as in Go literals: 4 digits in binary and hexadecimal.
+		n := 3
+		if base == 2 || base == 16 {
+			n = 4
+		}
+		f.fmtGrouped("_", "", n, true, func() { f.fmtInteger(u, base, isSigned, verb, digits) })
+		return
+	}
+	if f.group && base == 10 {
+		f.fmtGrouped(f.groupSeparator(), "", 3, true, func() { f.fmtInteger(u, base, isSigned, verb, digits) })
+		return
+	}
 	negative := isSigned && int64(u) < 0
 	if negative {
 		u = -u
@@ -277,7 +447,13 @@ func (f *fmt) fmtInteger(u uint64, base int, isSigned bool, verb rune, digits st
 			u >>= 1
 		}
 	default:
-		panic("fmt: unknown base; can't happen")
+		// Any other base, for %r.
+		b := uint64(base)
+		for u >= b {
+			i--
+			buf[i] = digits[u%b]
+			u /= b
+		}
 	}
 	i--
 	buf[i] = digits[u]
@@ -335,26 +511,93 @@ func (f *fmt) fmtInteger(u uint64, base int, isSigned bool, verb rune, digits st
 }
 
 // truncate truncates the string s to the specified precision, if present.
+// Escape sequences are not counted and are never split, and a color or
+// hyperlink left open by the part kept is closed.
 func (f *fmt) truncateString(s string) string {
-	if f.precPresent {
-		n := f.prec
-		for i := range s {
-			n--
-			if n < 0 {
-				return s[:i]
+	if !f.precPresent {
+		return s
+	}
+	if !f.ellipsis {
+		return f.cut(s, f.prec, "")
+	}
+	if f.precLen(s) <= f.prec {
+		return s
+	}
+	tail := f.cond.Ellipsis
+	if tail == "" {
+		tail = ellipsis
+	}
+	n := f.prec - f.precLen(tail)
+	if n < 0 {
+		n, tail = f.prec, ""
+	}
+	return f.cut(s, n, tail)
+}
+
+// cut returns s cut to n units of precision, with tail appended if
+// anything is removed.
+func (f *fmt) cut(s string, n int, tail string) string {
+	var st styleState
+	scale := 1
+	for i := 0; i < len(s); {
+		if f.cond.maySeq(s[i]) {
+			if e := f.cond.seqLen(s[i:], &scale); e > 0 {
+				st.update(s[i : i+e])
+				i += e
+				continue
 			}
 		}
+		size, count := f.advance(s[i:], scale)
+		n -= count
+		if n < 0 {
+			if f.cond.StyledTail {
+				return s[:i] + tail + st.close()
+			}
+			return s[:i] + st.close() + tail
+		}
+		i += size
 	}
 	return s
 }
 
+// precLen returns the length of s in the units counted by the precision.
+func (f *fmt) precLen(s string) int {
+	n, scale := 0, 1
+	for i := 0; i < len(s); {
+		if e := f.cond.seqLen(s[i:], &scale); e > 0 {
+			i += e
+			continue
+		}
+		size, count := f.advance(s[i:], scale)
+		n += count
+		i += size
+	}
+	return n
+}
+
 // truncate truncates the byte slice b as a string of the specified precision, if present.
+// Escape sequences are not counted and are never split, and a color or
+// hyperlink left open by the part kept is closed.
 func (f *fmt) truncate(b []byte) []byte {
+	if u := f.units(); f.precPresent && (u == UnitColumns || u == UnitBytes || f.ellipsis) {
+		return []byte(f.truncateString(string(b)))
+	}
 	if f.precPresent {
-		n := f.prec
+		var st styleState
+		n, scale := f.prec, 1
 		for i := 0; i < len(b); {
+			if f.cond.maySeq(b[i]) {
+				if e := f.cond.seqLen(string(b[i:]), &scale); e > 0 {
+					st.update(string(b[i : i+e]))
+					i += e
+					continue
+				}
+			}
 			n--
 			if n < 0 {
+				if st.open() {
+					return append(b[:i:i], st.close()...)
+				}
 				return b[:i]
 			}
 			wid := 1
@@ -369,16 +612,69 @@ func (f *fmt) truncate(b []byte) []byte {
 
 // fmtS formats a string.
 func (f *fmt) fmtS(s string) {
-	s = f.truncateString(s)
-	f.padString(s)
+	f.padOperand(f.truncateString(s))
 }
 
 // fmtBs formats the byte slice b as if it was formatted as string with fmtS.
 func (f *fmt) fmtBs(b []byte) {
 	b = f.truncate(b)
+	if f.cond.Control == ControlEscape || f.cond.Invalid != InvalidKeep || f.cond.Lines != LinesWhole || f.sharp {
+		f.padOperand(string(b))
+		return
+	}
 	f.pad(b)
 }
 
+// padOperand applies the invalid UTF-8 and control character policies
+// of f.cond to the string operand s and appends it to f.buf, padded.
+func (f *fmt) padOperand(s string) {
+	if f.cond.Invalid != InvalidKeep {
+		s = f.cond.fixUTF8(s)
+	}
+	if f.cond.Control == ControlEscape {
+		s = f.cond.escapeControls(s)
+	}
+	if (f.sharp || f.cond.Lines != LinesWhole) && f.widPresent && strings.IndexByte(s, '\n') >= 0 {
+		lines := f.cond.Lines
+		if f.sharp {
+			// %#Ns pads every line whatever the policy.
+			lines = LinesEach
+		}
+		f.padLines(s, lines)
+		return
+	}
+	f.padString(s)
+}
+
+// padLines appends the multi-line string s to f.buf, padded according
+// to the line policy lines.
+func (f *fmt) padLines(s string, lines LinePolicy) {
+	if lines == LinesEach {
+		for i, line := range strings.Split(s, "\n") {
+			if i > 0 {
+				f.buf.WriteByte('\n')
+			}
+			f.padString(line)
+		}
+		return
+	}
+	width := 0
+	for _, line := range strings.Split(s, "\n") {
+		if w := f.measure(line); w > width {
+			width = w
+		}
+	}
+	if f.center {
+		f.writeCentered(f.wid-width, func() { f.buf.WriteString(s) })
+	} else if !f.minus {
+		f.writePadding(f.wid - width)
+		f.buf.WriteString(s)
+	} else {
+		f.buf.WriteString(s)
+		f.writePadding(f.wid - width)
+	}
+}
+
 // fmtSbx formats a string or byte slice as a hexadecimal encoding of its bytes.
 func (f *fmt) fmtSbx(s string, b []byte, digits string) {
 	length := len(b)
@@ -411,9 +707,18 @@ func (f *fmt) fmtSbx(s string, b []byte, digits string) {
 		return
 	}
 	// Handle padding to the left.
-	if f.widPresent && f.wid > width && !f.minus {
-		f.writePadding(f.wid - width)
+	padding := 0
+	if f.widPresent && f.wid > width {
+		padding = f.wid - width
 	}
+	left := padding
+	if f.minus {
+		left = 0
+	}
+	if f.center {
+		left = padding / 2
+	}
+	f.writePadding(left)
 	// Write the encoding directly into the output buffer.
 	buf := *f.buf
 	if f.sharp {
@@ -437,12 +742,13 @@ func (f *fmt) fmtSbx(s string, b []byte, digits string) {
 		}
 		// Encode each byte as two hexadecimal digits.
 		buf = append(buf, digits[c>>4], digits[c&0xF])
+		if f.sink != nil && len(buf) >= streamChunk {
+			buf = f.sink.flush(buf)
+		}
 	}
 	*f.buf = buf
 	// Handle padding to the right.
-	if f.widPresent && f.wid > width && f.minus {
-		f.writePadding(f.wid - width)
-	}
+	f.writePadding(padding - left)
 }
 
 // fmtSx formats a string as a hexadecimal encoding of its bytes.
@@ -472,6 +778,98 @@ func (f *fmt) fmtQ(s string) {
 	}
 }
 
+// fmtA formats a string or byte slice that is usually text but may be
+// binary, such as a message key: valid UTF-8 is printed as it is, while
+// invalid bytes and control characters are printed as Go escapes and
+// backslashes are doubled, so the output is unambiguous. The precision,
+// if present, is the maximum width in cells, and an escape is never cut.
+func (f *fmt) fmtA(s string) {
+	buf := make(buffer, 0, len(s)+8)
+	width := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		var unit string
+		switch {
+		case r == utf8.RuneError && size == 1:
+			unit = `\x` + string(ldigits[s[i]>>4]) + string(ldigits[s[i]&0xF])
+		case r == '\\':
+			unit = `\\`
+		case isControl(r) || r == '\t' || r == '\n':
+			unit = controlEscape(r)
+		default:
+			unit = s[i : i+size]
+		}
+		w := f.cond.StringWidth(unit)
+		if f.precPresent && width+w > f.prec {
+			break
+		}
+		buf.WriteString(unit)
+		width += w
+		i += size
+	}
+	f.padString(string(buf))
+}
+
+// fmtHexdump formats the bytes of s in the canonical layout of
+// hexdump -C: a line for every 16 bytes holding their offset, their
+// values in hexadecimal in two groups of 8 and the bytes themselves,
+// with those other than printable ASCII shown as dots. The precision,
+// if present, is the number of bytes to dump, and a width pads every
+// line.
+func (f *fmt) fmtHexdump(s string) {
+	if f.precPresent && f.prec < len(s) {
+		s = s[:f.prec]
+	}
+	// Unpadded lines are written directly into the output.
+	padded := f.widPresent
+	buf := *f.buf
+	if padded {
+		buf = make(buffer, 0, (len(s)+15)/16*79)
+	}
+	for off := 0; off < len(s); off += 16 {
+		if off > 0 {
+			buf.WriteByte('\n')
+		}
+		line := s[off:]
+		if len(line) > 16 {
+			line = line[:16]
+		}
+		for shift := 28; shift >= 0; shift -= 4 {
+			buf.WriteByte(ldigits[off>>uint(shift)&0xF])
+		}
+		buf.WriteByte(' ')
+		for i := 0; i < 16; i++ {
+			if i == 8 {
+				buf.WriteByte(' ')
+			}
+			if i < len(line) {
+				buf.WriteByte(' ')
+				buf.WriteByte(ldigits[line[i]>>4])
+				buf.WriteByte(ldigits[line[i]&0xF])
+			} else {
+				buf.WriteString("   ")
+			}
+		}
+		buf.WriteString("  |")
+		for i := 0; i < len(line); i++ {
+			if c := line[i]; ' ' <= c && c <= '~' {
+				buf.WriteByte(c)
+			} else {
+				buf.WriteByte('.')
+			}
+		}
+		buf.WriteByte('|')
+		if !padded && f.sink != nil && len(buf) >= streamChunk {
+			buf = f.sink.flush(buf)
+		}
+	}
+	if !padded {
+		*f.buf = buf
+		return
+	}
+	f.padLines(string(buf), LinesEach)
+}
+
 // fmtC formats an integer as a Unicode character.
 // If the character is not valid Unicode, it will print '\ufffd'.
 func (f *fmt) fmtC(c uint64) {
@@ -499,15 +897,231 @@ func (f *fmt) fmtQc(c uint64) {
 	}
 }
 
+// siLarge and siSmall are the SI prefixes of the positive and negative
+// powers of 1000.
+var (
+	siLarge = []string{"k", "M", "G", "T", "P", "E", "Z", "Y", "R", "Q"}
+	siSmall = []string{"m", "µ", "n", "p", "f", "a", "z", "y", "r", "q"}
+)
+
+// fmtSI formats v with an SI prefix, as in 1.2k, 3.4M or 5.6µ, with as
+// many decimals as the precision, 1 by default. An integer below 1000
+// is printed without decimals. Values beyond the range of the prefixes,
+// Q and q, are printed in exponent form, as in 1.0e+33. Zero padding is
+// not supported.
+func (f *fmt) fmtSI(v float64, integer bool) {
+	prec := 1
+	if f.precPresent {
+		prec = f.prec
+	}
+	abs := math.Abs(v)
+	prefix := ""
+	exp := false
+	if !math.IsInf(v, 0) && !math.IsNaN(v) && abs != 0 {
+		// Scale abs to [1, 1000), counting the powers of 1000 in i.
+		i := 0
+		for abs >= 1000 {
+			abs /= 1000
+			i++
+		}
+		for abs < 1 && !integer {
+			abs *= 1000
+			i--
+		}
+		if i != 0 {
+			integer = false
+		}
+		// Rounding may carry to the next prefix, as for 999.96 and
+		// 999.96k, or from a small prefix to none, as for 0.99996.
+		p := prec
+		if integer {
+			p = 0
+		}
+		if roundsTo1000(abs, p) {
+			abs /= 1000
+			i++
+			integer = false
+		}
+		switch {
+		case i > len(siLarge) || -i > len(siSmall):
+			abs, exp = math.Abs(v), true
+		case i > 0:
+			prefix = siLarge[i-1]
+		case i < 0:
+			prefix = siSmall[-i-1]
+		}
+	}
+	if integer {
+		prec = 0
+	}
+	num := f.intbuf[:0]
+	switch {
+	case math.Signbit(v) && !math.IsNaN(v):
+		num = append(num, '-')
+	case f.plus:
+		num = append(num, '+')
+	case f.space:
+		num = append(num, ' ')
+	}
+	if exp {
+		num = strconv.AppendFloat(num, abs, 'e', prec, 64)
+	} else {
+		num = strconv.AppendFloat(num, abs, 'f', prec, 64)
+	}
+	num = append(num, prefix...)
+	oldZero := f.zero
+	f.zero = false
+	f.pad(num)
+	f.zero = oldZero
+}
+
+// appendEngineering appends v to dst in engineering notation, like %e
+// but with an exponent that is a multiple of 3 and from 1 to 3 digits
+// before the decimal point, as in 12.34e+03. The verb N writes E for e.
+// prec is the number of digits after the decimal point, or -1 for as
+// few as represent v exactly.
+func appendEngineering(dst []byte, v float64, verb rune, prec, size int) []byte {
+	e := byte('e')
+	if verb == 'N' {
+		e = 'E'
+	}
+	if v == 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return strconv.AppendFloat(dst, v, e, prec, size)
+	}
+	var tmp [40]byte
+	digits := prec
+	if prec >= 0 {
+		// Ask for the extra digits the shift moves before the point.
+		_, exp := splitExponent(strconv.AppendFloat(tmp[:0], v, 'e', -1, size))
+		digits += mod3(exp)
+	}
+	mant, exp := splitExponent(strconv.AppendFloat(tmp[:0], v, 'e', digits, size))
+	if mant[0] == '-' {
+		dst = append(dst, '-')
+		mant = mant[1:]
+	}
+	// Gather the digits without the decimal point.
+	var dbuf [40]byte
+	d := append(dbuf[:0], mant[0])
+	if len(mant) > 2 {
+		d = append(d, mant[2:]...)
+	}
+	shift := mod3(exp)
+	for len(d) < 1+shift {
+		d = append(d, '0')
+	}
+	frac := d[1+shift:]
+	// Rounding up to a power of ten may have moved the exponent, leaving
+	// zeros beyond the precision.
+	if prec >= 0 && len(frac) > prec {
+		frac = frac[:prec]
+	}
+	dst = append(dst, d[:1+shift]...)
+	if len(frac) > 0 {
+		dst = append(dst, '.')
+		dst = append(dst, frac...)
+	}
+	dst = append(dst, e)
+	exp -= shift
+	if exp < 0 {
+		dst = append(dst, '-')
+		exp = -exp
+	} else {
+		dst = append(dst, '+')
+	}
+	if exp < 10 {
+		dst = append(dst, '0')
+	}
+	return strconv.AppendInt(dst, int64(exp), 10)
+}
+
+// splitExponent splits a number formatted with the verb e into its
+// mantissa and exponent.
+func splitExponent(num []byte) ([]byte, int) {
+	i := len(num) - 1
+	for num[i] != 'e' {
+		i--
+	}
+	exp := 0
+	for _, c := range num[i+2:] {
+		exp = exp*10 + int(c-'0')
+	}
+	if num[i+1] == '-' {
+		exp = -exp
+	}
+	return num[:i], exp
+}
+
+// mod3 returns n modulo 3, from 0 to 2 whatever the sign of n.
+func mod3(n int) int {
+	return (n%3 + 3) % 3
+}
+
+// durationUnits are the units of fmtDuration, largest first.
+var durationUnits = []time.Duration{time.Hour, time.Minute, time.Second, time.Millisecond, time.Microsecond, time.Nanosecond}
+
+// fmtDuration formats d to as many units as the precision, 2 by default,
+// rounding the last, as in 1h3m or 1.5s. Units below a second are
+// written as a fraction of the largest unit shown, as time.Duration's
+// String method does.
+func (f *fmt) fmtDuration(d time.Duration) {
+	prec := 2
+	if f.precPresent && f.prec > 0 {
+		prec = f.prec
+	}
+	abs := d
+	if abs < 0 {
+		abs = -abs
+	}
+	largest := len(durationUnits) - 1
+	for i, u := range durationUnits {
+		if abs >= u {
+			largest = i
+			break
+		}
+	}
+	last := largest + prec - 1
+	if last >= len(durationUnits) {
+		last = len(durationUnits) - 1
+	}
+	s := d.Round(durationUnits[last]).String()
+	// Drop the zero units that rounding leaves, as in 1h3m0s.
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	if f.plus && d >= 0 {
+		s = "+" + s
+	}
+	f.padString(s)
+}
+
+// roundsTo1000 reports whether v printed with prec decimals is 1000.
+func roundsTo1000(v float64, prec int) bool {
+	s := strconv.FormatFloat(v, 'f', prec, 64)
+	return len(s) >= 4 && s[:4] == "1000"
+}
+
 // fmtFloat formats a float64. It assumes that verb is a valid format specifier
 // for strconv.AppendFloat and therefore fits into a byte.
 func (f *fmt) fmtFloat(v float64, size int, verb rune, prec int) {
+	if f.group && verb != 'b' && verb != 'x' && verb != 'X' {
+		f.fmtGrouped(f.groupSeparator(), f.decimalSep, 3, false, func() { f.fmtFloat(v, size, verb, prec) })
+		return
+	}
 	// Explicit precision in format specifier overrules default precision.
 	if f.precPresent {
 		prec = f.prec
 	}
 	// Format number, reserving space for leading + sign if needed.
-	num := strconv.AppendFloat(f.intbuf[:1], v, byte(verb), prec, size)
+	var num []byte
+	if verb == 'n' || verb == 'N' {
+		num = appendEngineering(f.intbuf[:1], v, verb, prec, size)
+	} else {
+		num = strconv.AppendFloat(f.intbuf[:1], v, byte(verb), prec, size)
+	}
 	if num[1] == '-' || num[1] == '+' {
 		num = num[1:]
 	} else {
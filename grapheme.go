@@ -0,0 +1,123 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "strings"
+
+// A GraphemeIterator walks a string one grapheme cluster at a time, the
+// way the package measures, pads and truncates it. Escape sequences
+// recognized by the Condition are returned as units of their own, so
+// that the units concatenated give back the whole string.
+//
+//	g := wfmt.Graphemes(s)
+//	for g.Next() {
+//		fmt.Println(g.Str(), g.Width())
+//	}
+type GraphemeIterator struct {
+	c          *Condition
+	s          string
+	start, end int
+	width      int
+	col, scale int
+	seq        bool
+}
+
+// Graphemes returns an iterator over the grapheme clusters of s under
+// the DefaultCondition.
+func Graphemes(s string) *GraphemeIterator {
+	return DefaultCondition.Graphemes(s)
+}
+
+// Graphemes returns an iterator over the grapheme clusters of s.
+func (c *Condition) Graphemes(s string) *GraphemeIterator {
+	return &GraphemeIterator{c: c, s: s, scale: 1}
+}
+
+// Next advances to the next cluster and reports whether there is one.
+func (g *GraphemeIterator) Next() bool {
+	g.start = g.end
+	if g.start >= len(g.s) {
+		g.width, g.seq = 0, false
+		return false
+	}
+	rest := g.s[g.start:]
+	if n := g.c.seqLen(rest, &g.scale); n > 0 {
+		g.end += n
+		g.width, g.seq = 0, true
+		return true
+	}
+	n := g.c.clusterLen(rest)
+	g.end += n
+	g.seq = false
+	if rest[0] == '\t' && g.c.TabStops {
+		g.width = g.c.nextTabStop(g.col) - g.col
+	} else {
+		g.width = g.scale * g.c.clusterWidth(rest[:n])
+	}
+	g.col += g.width
+	return true
+}
+
+// Str returns the current cluster.
+func (g *GraphemeIterator) Str() string {
+	return g.s[g.start:g.end]
+}
+
+// Width returns the number of cells the current cluster occupies.
+func (g *GraphemeIterator) Width() int {
+	return g.width
+}
+
+// Positions returns the byte offsets in the string of the start and
+// end of the current cluster.
+func (g *GraphemeIterator) Positions() (start, end int) {
+	return g.start, g.end
+}
+
+// Column returns the cell at which the next cluster starts, that is,
+// the total width of the clusters returned so far.
+func (g *GraphemeIterator) Column() int {
+	return g.col
+}
+
+// IsSequence reports whether the current unit is an escape sequence,
+// which occupies no cells, rather than a grapheme cluster.
+func (g *GraphemeIterator) IsSequence() bool {
+	return g.seq
+}
+
+// FindColumns returns the display columns of the non-overlapping
+// matches of substr in s, each as a pair of start and end columns, so
+// that a match can be underlined or colored at its place on the screen.
+// A match beginning or ending within a grapheme cluster covers the
+// whole cluster. An empty substr matches nothing.
+func (c *Condition) FindColumns(s, substr string) [][]int {
+	if substr == "" {
+		return nil
+	}
+	var cols [][]int
+	g := c.Graphemes(s)
+	for i := 0; ; {
+		j := strings.Index(s[i:], substr)
+		if j < 0 {
+			break
+		}
+		start, end := i+j, i+j+len(substr)
+		for g.end <= start && g.Next() {
+		}
+		from := g.col - g.width
+		for g.end < end && g.Next() {
+		}
+		cols = append(cols, []int{from, g.col})
+		i = end
+	}
+	return cols
+}
+
+// FindColumns returns the display columns of the matches of substr in s
+// under the DefaultCondition. See Condition.FindColumns.
+func FindColumns(s, substr string) [][]int {
+	return DefaultCondition.FindColumns(s, substr)
+}
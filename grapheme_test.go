@@ -0,0 +1,79 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestGraphemes(t *testing.T) {
+	type unit struct {
+		Str   string
+		Width int
+		Seq   bool
+	}
+	s := "é日\x1b[1m👍🏽\x1b[0m🇯🇵a"
+	want := []unit{
+		{"é", 1, false},
+		{"日", 2, false},
+		{"\x1b[1m", 0, true},
+		{"👍🏽", 2, false},
+		{"\x1b[0m", 0, true},
+		{"🇯🇵", 2, false},
+		{"a", 1, false},
+	}
+	var got []unit
+	joined := ""
+	g := (&Condition{}).Graphemes(s)
+	for g.Next() {
+		got = append(got, unit{g.Str(), g.Width(), g.IsSequence()})
+		joined += g.Str()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("units = %+v\nwant %+v", got, want)
+	}
+	if joined != s {
+		t.Errorf("joined units = %+q want %+q", joined, s)
+	}
+	if g.Column() != (&Condition{}).StringWidth(s) {
+		t.Errorf("Column() = %d want StringWidth %d", g.Column(), (&Condition{}).StringWidth(s))
+	}
+}
+
+func TestGraphemesTabStops(t *testing.T) {
+	g := (&Condition{TabStops: true, TabWidth: 4}).Graphemes("ab\tc")
+	var widths []int
+	for g.Next() {
+		widths = append(widths, g.Width())
+	}
+	if want := []int{1, 1, 2, 1}; !reflect.DeepEqual(widths, want) {
+		t.Errorf("widths = %v want %v", widths, want)
+	}
+}
+
+var findColumnsTests = []struct {
+	s, substr string
+	out       [][]int
+}{
+	{"abcabc", "bc", [][]int{{1, 3}, {4, 6}}},
+	{"日本語の日本", "日本", [][]int{{0, 4}, {8, 12}}},
+	{"\x1b[1m警告\x1b[0m: disk", "disk", [][]int{{6, 10}}},
+	{"cafe\u0301 cafe", "e", [][]int{{3, 4}, {8, 9}}},
+	{"aaaa", "aa", [][]int{{0, 2}, {2, 4}}},
+	{"abc", "x", nil},
+	{"abc", "", nil},
+}
+
+func TestFindColumns(t *testing.T) {
+	c := &Condition{}
+	for _, tt := range findColumnsTests {
+		if got := c.FindColumns(tt.s, tt.substr); !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("FindColumns(%+q, %+q) = %v want %v", tt.s, tt.substr, got, tt.out)
+		}
+	}
+}
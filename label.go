@@ -0,0 +1,126 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A LabelField declares a text field of a label template, such as a ZPL
+// ^FD or TSPL TEXT field, and its width in half-width cells of the
+// printer's fixed-pitch font.
+type LabelField struct {
+	Name  string
+	Width int
+}
+
+// A FieldOverflowError reports text too wide for a label field.
+type FieldOverflowError struct {
+	Field string // name of the field
+	Width int    // width of the text in cells
+	Max   int    // width of the field
+}
+
+func (e *FieldOverflowError) Error() string {
+	return "wfmt: label field " + strconv.Quote(e.Field) + " needs " +
+		strconv.Itoa(e.Width) + " cells, has " + strconv.Itoa(e.Max)
+}
+
+// A LabelLayout fits formatted text to the fields of a fixed-grid label
+// before it is embedded into a ZPL or TSPL template, so that a CJK
+// address is not silently clipped by the printer. Text is measured
+// with wide characters counted as two cells.
+type LabelLayout struct {
+	// Condition measures text; DefaultCondition if nil.
+	Condition *Condition
+	// Strict makes Setf reject text too wide for its field instead of
+	// truncating it.
+	Strict bool
+	// Tail marks truncated text; "…" if empty. Label fonts often lack
+	// the ellipsis, so "..." or "~" may be preferable.
+	Tail string
+
+	widths map[string]int
+	values map[string]string
+}
+
+// NewLabelLayout returns a LabelLayout with the given fields, which start
+// out empty.
+func NewLabelLayout(fields ...LabelField) *LabelLayout {
+	l := &LabelLayout{
+		widths: make(map[string]int, len(fields)),
+		values: make(map[string]string, len(fields)),
+	}
+	for _, f := range fields {
+		l.widths[f.Name] = f.Width
+		l.values[f.Name] = ""
+	}
+	return l
+}
+
+func (l *LabelLayout) cond() *Condition {
+	if l.Condition != nil {
+		return l.Condition
+	}
+	return DefaultCondition
+}
+
+// Setf sets the named field to text formatted according to a format
+// specifier. Text wider than the field is truncated with Tail and a
+// *FieldOverflowError is returned; in Strict mode the field is left
+// unchanged instead. Setting an undeclared field panics.
+func (l *LabelLayout) Setf(name, format string, a ...interface{}) error {
+	max, ok := l.widths[name]
+	if !ok {
+		panic("wfmt: undeclared label field " + strconv.Quote(name))
+	}
+	pr := Printer{Condition: l.cond()}
+	s := pr.Sprintf(format, a...)
+	w := l.cond().StringWidth(s)
+	if w <= max {
+		l.values[name] = s
+		return nil
+	}
+	if !l.Strict {
+		tail := l.Tail
+		if tail == "" {
+			tail = ellipsis
+		}
+		l.values[name] = l.cond().Truncate(s, max, tail)
+	}
+	return &FieldOverflowError{Field: name, Width: w, Max: max}
+}
+
+// Value returns the text of the named field.
+func (l *LabelLayout) Value(name string) string {
+	return l.values[name]
+}
+
+// Values returns the text of every field, keyed by name, for use with
+// text/template or a similar template engine.
+func (l *LabelLayout) Values() map[string]string {
+	m := make(map[string]string, len(l.values))
+	for k, v := range l.values {
+		m[k] = v
+	}
+	return m
+}
+
+// Fill replaces every {name} placeholder of tmpl with the text of the
+// named field. Placeholders naming undeclared fields are left as they are.
+func (l *LabelLayout) Fill(tmpl string) string {
+	names := make([]string, 0, len(l.values))
+	for name := range l.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	oldnew := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		oldnew = append(oldnew, "{"+name+"}", l.values[name])
+	}
+	return strings.NewReplacer(oldnew...).Replace(tmpl)
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestLabelLayout(t *testing.T) {
+	l := NewLabelLayout(LabelField{"name", 10}, LabelField{"city", 8})
+	l.Condition = &Condition{}
+	if err := l.Setf("name", "%s様", "山田"); err != nil {
+		t.Errorf("Setf(name) = %v", err)
+	}
+	err := l.Setf("city", "%s", "東京都千代田区")
+	if e, ok := err.(*FieldOverflowError); !ok || e.Field != "city" || e.Width != 14 || e.Max != 8 {
+		t.Errorf("Setf(city) = %#v want overflow of 14 cells into 8", err)
+	}
+	if got, want := l.Value("city"), "東京都…"; got != want {
+		t.Errorf("truncated city = %q want %q", got, want)
+	}
+	got := l.Fill("^FO50,50^FD{name}^FS^FO50,100^FD{city}^FS{zip}")
+	if want := "^FO50,50^FD山田様^FS^FO50,100^FD東京都…^FS{zip}"; got != want {
+		t.Errorf("Fill = %q want %q", got, want)
+	}
+
+	l.Strict = true
+	if err := l.Setf("name", "%s", "とても長いお名前です"); err == nil {
+		t.Error("strict Setf of overlong text succeeded")
+	}
+	if got, want := l.Value("name"), "山田様"; got != want {
+		t.Errorf("strict Setf changed field to %q want %q", got, want)
+	}
+}
+
+func TestLabelLayoutStyledTail(t *testing.T) {
+	l := NewLabelLayout(LabelField{"name", 4})
+	l.Condition = &Condition{}
+	l.Setf("name", "\x1b[1m%s", "abcdef")
+	if got, want := l.Value("name"), "\x1b[1mabc\x1b[0m…"; got != want {
+		t.Errorf("Value = %q want %q", got, want)
+	}
+	l.Condition.StyledTail = true
+	l.Setf("name", "\x1b[1m%s", "abcdef")
+	if got, want := l.Value("name"), "\x1b[1mabc…\x1b[0m"; got != want {
+		t.Errorf("StyledTail Value = %q want %q", got, want)
+	}
+}
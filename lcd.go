@@ -0,0 +1,138 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "strings"
+
+// An LCDProfile describes a fixed-grid text display, such as an HD44780
+// character LCD or a teletext page.
+type LCDProfile struct {
+	Name    string
+	Columns int
+	Rows    int
+	// Wide reports whether the controller shows wide characters, such
+	// as CJK ideographs, in two cells. If not, they are shown as Fallback.
+	Wide bool
+	// Fallback replaces characters the display cannot show; '?' if zero.
+	Fallback rune
+}
+
+// Common display profiles.
+var (
+	LCD16x2  = LCDProfile{Name: "16x2", Columns: 16, Rows: 2}
+	LCD20x4  = LCDProfile{Name: "20x4", Columns: 20, Rows: 4}
+	LCD16x4  = LCDProfile{Name: "16x4 CJK", Columns: 16, Rows: 4, Wide: true} // ST7920 and similar
+	Teletext = LCDProfile{Name: "teletext", Columns: 40, Rows: 24}
+)
+
+// lcdCondition measures text on a character display. Codes 0 to 7
+// select the user-defined characters of HD44780 controllers, so control
+// characters occupy a cell.
+var lcdCondition = &Condition{Control: ControlOne}
+
+// fit replaces the characters the display cannot show.
+func (p LCDProfile) fit(s string) string {
+	if p.Wide {
+		return s
+	}
+	fallback := p.Fallback
+	if fallback == 0 {
+		fallback = '?'
+	}
+	return strings.Map(func(r rune) rune {
+		if lcdCondition.RuneWidth(r) > 1 {
+			return fallback
+		}
+		return r
+	}, s)
+}
+
+// pad pads s with spaces to the width of the display, so that writing
+// it overwrites a whole row.
+func (p LCDProfile) pad(s string) string {
+	if w := lcdCondition.StringWidth(s); w < p.Columns {
+		s += strings.Repeat(" ", p.Columns-w)
+	}
+	return s
+}
+
+// Linesf formats according to a format specifier and returns the result
+// wrapped to the width of the display, one padded row per line.
+func (p LCDProfile) Linesf(format string, a ...interface{}) []string {
+	pr := Printer{Condition: lcdCondition}
+	s := p.fit(pr.Sprintf(format, p.fitArgs(a)...))
+	lines := strings.Split(lcdCondition.Wrap(s, p.Columns), "\n")
+	for i, line := range lines {
+		lines[i] = p.pad(line)
+	}
+	return lines
+}
+
+// fitArgs replaces wide characters in string operands before they are
+// formatted, so that padding is computed on what the display shows.
+func (p LCDProfile) fitArgs(a []interface{}) []interface{} {
+	if p.Wide {
+		return a
+	}
+	fitted := make([]interface{}, len(a))
+	for i, arg := range a {
+		if s, ok := arg.(string); ok {
+			arg = p.fit(s)
+		}
+		fitted[i] = arg
+	}
+	return fitted
+}
+
+// Pagef formats according to a format specifier and returns the result
+// as screens of the display: Linesf split into pages of Rows rows. The
+// last page is filled with blank rows.
+func (p LCDProfile) Pagef(format string, a ...interface{}) [][]string {
+	lines := p.Linesf(format, a...)
+	var pages [][]string
+	for i := 0; i < len(lines); i += p.Rows {
+		page := make([]string, p.Rows)
+		for j := range page {
+			if i+j < len(lines) {
+				page[j] = lines[i+j]
+			} else {
+				page[j] = p.pad("")
+			}
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// Scrollf is like Pagef but returns the screens of a message scrolling
+// up one row at a time.
+func (p LCDProfile) Scrollf(format string, a ...interface{}) [][]string {
+	lines := p.Linesf(format, a...)
+	if len(lines) <= p.Rows {
+		return p.Pagef(format, a...)
+	}
+	var frames [][]string
+	for i := 0; i+p.Rows <= len(lines); i++ {
+		frames = append(frames, lines[i:i+p.Rows:i+p.Rows])
+	}
+	return frames
+}
+
+// Marquee returns the frames of s scrolling left across one row, one
+// character at a time, followed by a gap of three spaces before it
+// repeats. Text that fits the row is returned as a single frame.
+func (p LCDProfile) Marquee(s string) []string {
+	s = p.fit(s)
+	if lcdCondition.StringWidth(s) <= p.Columns {
+		return []string{p.pad(s)}
+	}
+	loop := s + "   "
+	var frames []string
+	for i := 0; i < len(loop); i += lcdCondition.clusterLen(loop[i:]) {
+		frame := lcdCondition.Truncate(loop[i:]+loop, p.Columns, "")
+		frames = append(frames, p.pad(frame))
+	}
+	return frames
+}
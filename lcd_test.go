@@ -0,0 +1,51 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestLCDPagef(t *testing.T) {
+	got := LCD16x2.Pagef("Temp %-5s %3d%%\nDoor open since %s", "高", 42, "noon")
+	want := [][]string{
+		{"Temp ?      42% ", "Door open since "},
+		{"noon            ", "                "},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Pagef = %q want %q", got, want)
+	}
+	got = LCD16x4.Pagef("%-6s|", "温度")
+	want = [][]string{{"温度  |         ", "                ", "                ", "                "}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CJK Pagef = %q want %q", got, want)
+	}
+}
+
+func TestLCDScrollf(t *testing.T) {
+	got := LCD16x2.Scrollf("one\ntwo\nthree")
+	want := [][]string{
+		{"one             ", "two             "},
+		{"two             ", "three           "},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Scrollf = %q want %q", got, want)
+	}
+}
+
+func TestLCDMarquee(t *testing.T) {
+	p := LCDProfile{Columns: 4, Rows: 1}
+	if got, want := p.Marquee("hi"), []string{"hi  "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Marquee of short text = %q want %q", got, want)
+	}
+	got := p.Marquee("hello")
+	want := []string{"hell", "ello", "llo ", "lo  ", "o   ", "   h", "  he", " hel"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Marquee = %q want %q", got, want)
+	}
+}
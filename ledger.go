@@ -0,0 +1,88 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// A Ledger writes fixed-layout debit/credit ledger lines: a date, a
+// description truncated with an ellipsis to fit its column, right-aligned
+// debit and credit amounts, and the running balance.
+type Ledger struct {
+	// Column widths in cells.
+	DateWidth   int
+	DescWidth   int
+	AmountWidth int
+
+	// DateLayout formats dates as in time.Time.Format.
+	DateLayout string
+	// Decimals is the number of decimals shown for amounts.
+	Decimals int
+	// Separator, if not empty, groups integral digits by thousands.
+	Separator string
+	// Labels are the column headings written by Header: date,
+	// description, debit, credit and balance.
+	Labels [5]string
+
+	// Balance is the running balance. Set it to the opening balance
+	// before writing the first entry.
+	Balance float64
+
+	out io.Writer
+}
+
+// NewLedger returns a Ledger writing to w with a 10-cell date column,
+// a 30-cell description and 12-cell amounts with two decimals.
+func NewLedger(w io.Writer) *Ledger {
+	return &Ledger{
+		DateWidth:   10,
+		DescWidth:   30,
+		AmountWidth: 12,
+		DateLayout:  "2006-01-02",
+		Decimals:    2,
+		Separator:   ",",
+		Labels:      [5]string{"Date", "Description", "Debit", "Credit", "Balance"},
+		out:         w,
+	}
+}
+
+// line writes one ledger line from its five cells.
+func (l *Ledger) line(date, desc, debit, credit, balance string) error {
+	desc = DefaultCondition.Truncate(desc, l.DescWidth, ellipsis)
+	_, err := Fprintf(l.out, "%-*s  %-*s  %*s  %*s  %*s\n",
+		l.DateWidth, date, l.DescWidth, desc,
+		l.AmountWidth, debit, l.AmountWidth, credit, l.AmountWidth, balance)
+	return err
+}
+
+// Header writes the column headings followed by a rule.
+func (l *Ledger) Header() error {
+	lb := l.Labels
+	if err := l.line(lb[0], lb[1], lb[2], lb[3], lb[4]); err != nil {
+		return err
+	}
+	width := l.DateWidth + l.DescWidth + 3*l.AmountWidth + 4*2
+	_, err := io.WriteString(l.out, strings.Repeat("-", width)+"\n")
+	return err
+}
+
+// Entry writes a ledger line and updates the balance, which grows by
+// debit and shrinks by credit. Zero amounts are left blank.
+func (l *Ledger) Entry(date time.Time, desc string, debit, credit float64) error {
+	l.Balance += debit - credit
+	return l.line(date.Format(l.DateLayout), desc, l.amount(debit, true), l.amount(credit, true), l.amount(l.Balance, false))
+}
+
+// amount formats v, or returns "" if v is zero and blank is set.
+func (l *Ledger) amount(v float64, blank bool) string {
+	if v == 0 && blank {
+		return ""
+	}
+	whole, frac := splitAmount(v, l.Decimals, l.Separator)
+	return whole + frac
+}
@@ -0,0 +1,36 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestLedger(t *testing.T) {
+	var b strings.Builder
+	l := NewLedger(&b)
+	l.DescWidth = 12
+	l.AmountWidth = 9
+	l.Balance = 1000
+	day := func(d int) time.Time { return time.Date(2019, 8, d, 0, 0, 0, 0, time.UTC) }
+	l.Header()
+	l.Entry(day(1), "売上 (請求書 #1024)", 2500, 0)
+	l.Entry(day(2), "Rent", 0, 3200.5)
+	want := "" +
+		"Date        Description       Debit     Credit    Balance\n" +
+		"---------------------------------------------------------\n" +
+		"2019-08-01  売上 (請求…    2,500.00              3,500.00\n" +
+		"2019-08-02  Rent                      3,200.50     299.50\n"
+	if got := b.String(); got != want {
+		t.Errorf("ledger =\n%s\nwant\n%s", got, want)
+	}
+	if l.Balance != 299.5 {
+		t.Errorf("Balance = %v want 299.5", l.Balance)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "sort"
+
+// indexInterval is the least number of bytes between the checkpoints of
+// a LineIndex.
+const indexInterval = 256
+
+// A checkpoint is a cluster boundary from which a line can be measured
+// without scanning it from the start.
+type checkpoint struct {
+	off, col, scale int
+}
+
+// A LineIndex maps between the byte offsets and the display columns of
+// a long line, such as a line of a log viewer. It records checkpoints as
+// it measures the line once, so that each query scans only the few
+// hundred bytes after the nearest checkpoint.
+type LineIndex struct {
+	c      *Condition
+	s      string
+	points []checkpoint
+	width  int
+}
+
+// NewLineIndex returns a LineIndex for s under the DefaultCondition.
+func NewLineIndex(s string) *LineIndex {
+	return DefaultCondition.NewLineIndex(s)
+}
+
+// NewLineIndex returns a LineIndex for s.
+func (c *Condition) NewLineIndex(s string) *LineIndex {
+	x := &LineIndex{c: c, s: s, points: []checkpoint{{0, 0, 1}}}
+	g := c.Graphemes(s)
+	last := 0
+	for g.Next() {
+		if g.end-last >= indexInterval && g.end < len(s) {
+			x.points = append(x.points, checkpoint{g.end, g.col, g.scale})
+			last = g.end
+		}
+	}
+	x.width = g.col
+	return x
+}
+
+// iter returns an iterator resuming at p.
+func (x *LineIndex) iter(p checkpoint) *GraphemeIterator {
+	return &GraphemeIterator{c: x.c, s: x.s, start: p.off, end: p.off, col: p.col, scale: p.scale}
+}
+
+// Width returns the number of cells occupied by the line.
+func (x *LineIndex) Width() int {
+	return x.width
+}
+
+// ColumnAt returns the column at which the grapheme cluster containing
+// the byte at offset off starts, or the width of the line if off is
+// past its end.
+func (x *LineIndex) ColumnAt(off int) int {
+	if off < 0 {
+		off = 0
+	}
+	i := sort.Search(len(x.points), func(i int) bool { return x.points[i].off > off }) - 1
+	g := x.iter(x.points[i])
+	for g.Next() {
+		if g.end > off {
+			return g.col - g.width
+		}
+	}
+	return x.width
+}
+
+// OffsetAt returns the byte offset of the first grapheme cluster or
+// escape sequence starting at column col or later, or the length of the
+// line if there is none.
+func (x *LineIndex) OffsetAt(col int) int {
+	return x.find(col, func(g *GraphemeIterator) bool {
+		return g.col-g.width >= col
+	})
+}
+
+// find returns the byte offset of the first unit at or after column col
+// for which ok reports true, or the length of the line.
+func (x *LineIndex) find(col int, ok func(g *GraphemeIterator) bool) int {
+	i := sort.Search(len(x.points), func(i int) bool { return x.points[i].col >= col }) - 1
+	if i < 0 {
+		i = 0
+	}
+	g := x.iter(x.points[i])
+	for g.Next() {
+		if ok(g) {
+			return g.start
+		}
+	}
+	return len(x.s)
+}
+
+// Slice returns the part of the line occupying columns from up to to.
+// Wide characters straddling either column are left out, and so are
+// escape sequences at column to.
+func (x *LineIndex) Slice(from, to int) string {
+	if to <= from {
+		return ""
+	}
+	end := x.find(to, func(g *GraphemeIterator) bool {
+		return g.col > to || g.width == 0 && g.col >= to
+	})
+	return x.s[x.OffsetAt(from):end]
+}
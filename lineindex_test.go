@@ -0,0 +1,61 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestLineIndex(t *testing.T) {
+	c := &Condition{}
+	s := strings.Repeat("ab\x1b[1m日本\x1b[0mcafé ", 100)
+	x := c.NewLineIndex(s)
+	if x.Width() != c.StringWidth(s) {
+		t.Fatalf("Width() = %d want %d", x.Width(), c.StringWidth(s))
+	}
+	// Compare every offset and column against a scan from the start.
+	g := c.Graphemes(s)
+	for g.Next() {
+		start, end := g.Positions()
+		col := g.Column() - g.Width()
+		for off := start; off < end; off++ {
+			if got := x.ColumnAt(off); got != col {
+				t.Fatalf("ColumnAt(%d) = %d want %d", off, got, col)
+			}
+		}
+		if g.Width() > 0 {
+			if got := x.OffsetAt(col); got > start || c.StringWidth(s[:got]) != col {
+				t.Fatalf("OffsetAt(%d) = %d want at most %d", col, got, start)
+			}
+		}
+	}
+	if got := x.ColumnAt(len(s)); got != x.Width() {
+		t.Errorf("ColumnAt(len) = %d want %d", got, x.Width())
+	}
+}
+
+var lineSliceTests = []struct {
+	from, to int
+	out      string
+}{
+	{0, 3, "ab\x1b[1m"},
+	{0, 4, "ab\x1b[1m日"},
+	{2, 6, "\x1b[1m日本"},
+	{3, 7, "本\x1b[0mc"},
+	{5, 5, ""},
+	{9, 20, "é"},
+}
+
+func TestLineIndexSlice(t *testing.T) {
+	x := (&Condition{}).NewLineIndex("ab\x1b[1m日本\x1b[0mcafé")
+	for _, tt := range lineSliceTests {
+		if got := x.Slice(tt.from, tt.to); got != tt.out {
+			t.Errorf("Slice(%d, %d) = %+q want %+q", tt.from, tt.to, got, tt.out)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build ignore
+// +build ignore
+
+// Maketables generates the width tables for one Unicode version from the
+// Unicode Character Database files EastAsianWidth.txt and emoji-data.txt.
+//
+//	go run maketables.go -version 15.0.0
+//
+// writes tables15.0.0.go, and
+//
+//	go run maketables.go -runewidth
+//
+// writes tablesrunewidth.go, the lookup table of the Basic Multilingual
+// Plane used when no Unicode version is selected, from the go-runewidth
+// package the module requires. The files are downloaded from unicode.org unless
+// -data names a local directory holding them. emoji-data.txt is optional:
+// it is only published with the UCD from Unicode 13.0 onwards, and since
+// Unicode 9.0 EastAsianWidth.txt already marks emoji presentation
+// characters as wide.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+var (
+	version = flag.String("version", "", "Unicode version to generate, such as 15.0.0")
+	baseURL = flag.String("url", "https://www.unicode.org/Public", "base URL of the Unicode Character Database")
+	dataDir = flag.String("data", "", "read the UCD files from this directory instead of downloading them")
+	output  = flag.String("output", "", "output file (default tables<version>.go)")
+	rwidth  = flag.Bool("runewidth", false, "generate the lookup table of the go-runewidth widths")
+)
+
+// The width classes of widthTrie, as declared in width.go.
+const (
+	classNarrow uint8 = iota
+	classZero
+	classWide
+	classAmbiguous
+)
+
+// trieBlockBits is trieBlockBits of width.go.
+const trieBlockBits = 7
+
+// defaultWide lists the blocks whose unlisted code points default to
+// East_Asian_Width W, as documented in the header of EastAsianWidth.txt.
+var defaultWide = [][2]rune{
+	{0x3400, 0x4DBF},
+	{0x4E00, 0x9FFF},
+	{0xF900, 0xFAFF},
+	{0x20000, 0x2FFFD},
+	{0x30000, 0x3FFFD},
+}
+
+type runeSet map[rune]bool
+
+func (s runeSet) addRange(first, last rune) {
+	for r := first; r <= last; r++ {
+		s[r] = true
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("maketables: ")
+	flag.Parse()
+	if *rwidth {
+		name := *output
+		if name == "" {
+			name = "tablesrunewidth.go"
+		}
+		if err := ioutil.WriteFile(name, generateRunewidth(), 0644); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *version == "" || strings.Count(*version, ".") != 2 {
+		log.Fatal("-version must be a full Unicode version such as 15.0.0")
+	}
+
+	wide, ambiguous, zero, listed := runeSet{}, runeSet{}, runeSet{}, runeSet{}
+	eaw, err := open("EastAsianWidth.txt", *version+"/ucd/EastAsianWidth.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	parse(eaw, func(first, last rune, prop, comment string) {
+		listed.addRange(first, last)
+		switch prop {
+		case "W", "F":
+			wide.addRange(first, last)
+		case "A":
+			ambiguous.addRange(first, last)
+		}
+		// The comment starts with the General_Category.
+		switch gc := strings.Fields(comment + " ")[0]; gc {
+		case "Mn", "Me", "Cf":
+			zero.addRange(first, last)
+		}
+	})
+	eaw.Close()
+	for _, b := range defaultWide {
+		for r := b[0]; r <= b[1]; r++ {
+			if !listed[r] {
+				wide[r] = true
+			}
+		}
+	}
+
+	emoji, err := open("emoji-data.txt", *version+"/ucd/emoji/emoji-data.txt")
+	switch {
+	case os.IsNotExist(err):
+		log.Printf("no emoji-data.txt for Unicode %s; using EastAsianWidth.txt only", *version)
+	case err != nil:
+		log.Fatal(err)
+	default:
+		parse(emoji, func(first, last rune, prop, comment string) {
+			if prop == "Emoji_Presentation" {
+				wide.addRange(first, last)
+			}
+		})
+		emoji.Close()
+	}
+
+	// Zero width takes precedence: combining marks are often ambiguous.
+	for r := range zero {
+		delete(wide, r)
+		delete(ambiguous, r)
+	}
+	for r := range wide {
+		delete(ambiguous, r)
+	}
+
+	name := *output
+	if name == "" {
+		name = "tables" + *version + ".go"
+	}
+	if err := ioutil.WriteFile(name, generate(*version, wide, ambiguous, zero), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// open returns the named UCD file, from -data or downloaded from path
+// below -url.
+func open(name, path string) (io.ReadCloser, error) {
+	if *dataDir != "" {
+		return os.Open(filepath.Join(*dataDir, name))
+	}
+	url := *baseURL + "/" + path
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, &os.PathError{Op: "get", Path: url, Err: os.ErrNotExist}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("get %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// parse calls f for every data line of a UCD file of the form
+// "first..last ; property # comment".
+func parse(r io.Reader, f func(first, last rune, prop, comment string)) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line, comment := s.Text(), ""
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line, comment = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 {
+			continue
+		}
+		rng := strings.TrimSpace(fields[0])
+		lo, hi := rng, rng
+		if i := strings.Index(rng, ".."); i >= 0 {
+			lo, hi = rng[:i], rng[i+2:]
+		}
+		first, err1 := strconv.ParseUint(lo, 16, 32)
+		last, err2 := strconv.ParseUint(hi, 16, 32)
+		if err1 != nil || err2 != nil {
+			log.Fatalf("bad range %q", rng)
+		}
+		f(rune(first), rune(last), strings.TrimSpace(fields[1]), comment)
+	}
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ranges returns s as sorted, merged intervals.
+func ranges(s runeSet) [][2]rune {
+	rs := make([]rune, 0, len(s))
+	for r := range s {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i] < rs[j] })
+	var out [][2]rune
+	for _, r := range rs {
+		if n := len(out); n > 0 && out[n-1][1] == r-1 {
+			out[n-1][1] = r
+		} else {
+			out = append(out, [2]rune{r, r})
+		}
+	}
+	return out
+}
+
+func generate(version string, wide, ambiguous, zero runeSet) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by \"go run maketables.go -version %s\"; DO NOT EDIT.\n\n", version)
+	fmt.Fprintf(&b, "package wfmt\n\n")
+	fmt.Fprintf(&b, "func init() {\n\tregisterUnicode(&widthTables{\n\t\tversion: %q,\n", version)
+	for _, t := range []struct {
+		name string
+		set  runeSet
+	}{{"zero", zero}, {"wide", wide}, {"ambiguous", ambiguous}} {
+		fmt.Fprintf(&b, "\t\t%s: table{", t.name)
+		for i, r := range ranges(t.set) {
+			if i%4 == 0 {
+				b.WriteString("\n")
+			} else {
+				b.WriteString(" ")
+			}
+			fmt.Fprintf(&b, "{0x%04X, 0x%04X},", r[0], r[1])
+		}
+		b.WriteString("\n},\n")
+	}
+	// Zero width takes precedence over wide, and wide over ambiguous,
+	// as in the lookups of widthTables.runeWidth.
+	var classes [0x10000]uint8
+	for _, c := range []struct {
+		set   runeSet
+		class uint8
+	}{{ambiguous, classAmbiguous}, {wide, classWide}, {zero, classZero}} {
+		for r := range c.set {
+			if r <= 0xFFFF {
+				classes[r] = c.class
+			}
+		}
+	}
+	b.WriteString("bmp: ")
+	writeTrie(&b, &classes)
+	b.WriteString(",\n")
+	b.WriteString("\t})\n}\n")
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return src
+}
+
+// generateRunewidth returns the source of the lookup table of the widths
+// go-runewidth gives the Basic Multilingual Plane, with and without
+// EastAsianWidth.
+func generateRunewidth() []byte {
+	narrow := &runewidth.Condition{StrictEmojiNeutral: true}
+	eastAsian := &runewidth.Condition{EastAsianWidth: true, StrictEmojiNeutral: true}
+	var classes [0x10000]uint8
+	for r := rune(0); r <= 0xFFFF; r++ {
+		switch n, e := narrow.RuneWidth(r), eastAsian.RuneWidth(r); {
+		case n == 0 && e == 0:
+			classes[r] = classZero
+		case n == 1 && e == 1:
+			classes[r] = classNarrow
+		case n == 2 && e == 2:
+			classes[r] = classWide
+		case n == 1 && e == 2:
+			classes[r] = classAmbiguous
+		default:
+			log.Fatalf("U+%04X: go-runewidth widths %d and %d fit no class", r, n, e)
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by \"go run maketables.go -runewidth\"; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package wfmt\n\n")
+	fmt.Fprintf(&b, "// runewidthBMP holds the widths go-runewidth gives the Basic\n")
+	fmt.Fprintf(&b, "// Multilingual Plane.\n")
+	b.WriteString("var runewidthBMP = ")
+	writeTrie(&b, &classes)
+	b.WriteString("\n")
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return src
+}
+
+// writeTrie writes a widthTrie literal holding classes to b. Blocks of
+// classes that are alike are stored once.
+func writeTrie(b *bytes.Buffer, classes *[0x10000]uint8) {
+	var index []uint16
+	var blocks []byte
+	seen := map[string]uint16{}
+	for i := 0; i < len(classes)>>trieBlockBits; i++ {
+		block := classes[i<<trieBlockBits : (i+1)<<trieBlockBits]
+		n, ok := seen[string(block)]
+		if !ok {
+			n = uint16(len(blocks) >> trieBlockBits)
+			seen[string(block)] = n
+			blocks = append(blocks, block...)
+		}
+		index = append(index, n)
+	}
+	b.WriteString("&widthTrie{\nindex: [...]uint16{")
+	for i, n := range index {
+		if i%16 == 0 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(b, "%d,", n)
+	}
+	b.WriteString("\n},\nblocks: \"\" +")
+	for i, c := range blocks {
+		if i%32 == 0 {
+			b.WriteString("\n\"")
+		}
+		fmt.Fprintf(b, "\\x%02x", c)
+		if i%32 == 31 || i == len(blocks)-1 {
+			b.WriteString("\"")
+			if i != len(blocks)-1 {
+				b.WriteString(" +")
+			}
+		}
+	}
+	b.WriteString(",\n}")
+}
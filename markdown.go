@@ -0,0 +1,87 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "strings"
+
+// MarkdownFlags control the Markdown written by Table.Markdown.
+type MarkdownFlags uint
+
+const (
+	// MarkdownAlign writes the alignment of each column as colons in the
+	// delimiter row, as in |:---|---:|:---:|.
+	MarkdownAlign MarkdownFlags = 1 << iota
+	// MarkdownEscape escapes the pipe characters in cells, so that text
+	// such as "東京|大阪" stays in one cell.
+	MarkdownEscape
+)
+
+// minMarkdownWidth is the width of the narrowest Markdown column, enough
+// for the alignment colons and a hyphen between them.
+const minMarkdownWidth = 3
+
+// Markdown returns t as a GitHub-flavored Markdown table whose source is
+// padded to display width, so that it reads as a table before it is
+// rendered too. A table without a header gets an empty one, since
+// Markdown requires it. Its Border is not used, and since a Markdown row
+// is a single line, the lines of a cell are joined by <br> tags rather
+// than wrapped.
+func (t *Table) Markdown(flags MarkdownFlags) string {
+	m := &Table{
+		Condition: t.Condition,
+		Border:    MarkdownBorder,
+		Width:     t.Width,
+		Tail:      t.Tail,
+		align:     t.align,
+		max:       t.max,
+	}
+	escape := func(row []string) []string {
+		esc := make([]string, len(row))
+		for j, cell := range row {
+			if flags&MarkdownEscape != 0 {
+				cell = strings.Replace(cell, "|", `\|`, -1)
+			}
+			esc[j] = strings.Replace(cell, "\n", "<br>", -1)
+		}
+		return esc
+	}
+	m.header = escape(t.header)
+	for _, row := range t.alignDecimals(t.rows) {
+		m.rows = append(m.rows, escape(row))
+	}
+
+	cols := m.columns(m.rows)
+	for j, w := range cols {
+		if w < minMarkdownWidth {
+			cols[j] = minMarkdownWidth
+		}
+	}
+	var b strings.Builder
+	m.line(&b, m.header, cols)
+	b.WriteByte('|')
+	for j, w := range cols {
+		align := AlignLeft
+		if j < len(t.align) {
+			align = t.align[j]
+		}
+		left, right := "-", "-"
+		if flags&MarkdownAlign != 0 {
+			switch align {
+			case AlignLeft:
+				left = ":"
+			case AlignRight, AlignDecimal, AlignCurrency:
+				right = ":"
+			case AlignCenter:
+				left, right = ":", ":"
+			}
+		}
+		b.WriteString(left + strings.Repeat("-", w) + right + "|")
+	}
+	b.WriteByte('\n')
+	for _, row := range m.rows {
+		m.line(&b, row, cols)
+	}
+	return b.String()
+}
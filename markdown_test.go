@@ -0,0 +1,52 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestTableMarkdown(t *testing.T) {
+	tab := NewTable("都市", "人口", "備考")
+	tab.Align(1, AlignRight)
+	tab.Align(2, AlignCenter)
+	tab.Row("東京", 1400, "東京|大阪")
+	tab.Row("NYC", 880, "")
+
+	tests := []struct {
+		flags MarkdownFlags
+		want  string
+	}{
+		{0, "" +
+			"| 都市 | 人口 |   備考    |\n" +
+			"|------|------|-----------|\n" +
+			"| 東京 | 1400 | 東京|大阪 |\n" +
+			"| NYC  |  880 |           |\n"},
+		{MarkdownAlign | MarkdownEscape, "" +
+			"| 都市 | 人口 |    備考    |\n" +
+			"|:-----|-----:|:----------:|\n" +
+			"| 東京 | 1400 | 東京\\|大阪 |\n" +
+			"| NYC  |  880 |            |\n"},
+	}
+	for _, tt := range tests {
+		if got := tab.Markdown(tt.flags); got != tt.want {
+			t.Errorf("Markdown(%d):\n%s\nwant\n%s", tt.flags, got, tt.want)
+		}
+	}
+
+	// A table without a header gets an empty one, at least three cells
+	// wide.
+	tab = &Table{}
+	tab.Row("a", "b")
+	want := "" +
+		"|     |     |\n" +
+		"|-----|-----|\n" +
+		"| a   | b   |\n"
+	if got := tab.Markdown(0); got != want {
+		t.Errorf("Markdown without header:\n%s\nwant\n%s", got, want)
+	}
+}
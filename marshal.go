@@ -0,0 +1,64 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A MarshalFunc returns an encoding of v, such as YAML or TOML, for
+// printing with the verb it is registered for.
+type MarshalFunc func(v interface{}) ([]byte, error)
+
+// builtinVerbs are the verbs wfmt defines, which cannot be registered.
+const builtinVerbs = "%DEFGHNORTUXabcdefghjnopqrstvwx"
+
+var (
+	marshalersMu sync.Mutex // serializes RegisterMarshaler
+	marshalers   atomic.Value
+)
+
+func registeredMarshalers() map[rune]MarshalFunc {
+	m, _ := marshalers.Load().(map[rune]MarshalFunc)
+	return m
+}
+
+// marshaler returns the MarshalFunc registered for verb, or nil.
+func marshaler(verb rune) MarshalFunc {
+	return registeredMarshalers()[verb]
+}
+
+// RegisterMarshaler registers m to print the operands of verb, so that
+// an encoding wfmt does not depend on can be used inline in format
+// strings. For instance, with a YAML package,
+//
+//	wfmt.RegisterMarshaler('y', yaml.Marshal)
+//
+// makes %y print operands as YAML. The output of m is padded and
+// truncated like a string, with a single trailing newline removed; if m
+// fails, the operand is printed as %!y(ERROR=message). Operands that
+// implement Formatter format themselves instead. A verb wfmt defines,
+// such as %v or %j, cannot be registered. Registering a verb again
+// replaces its MarshalFunc, and a nil m removes it.
+func RegisterMarshaler(verb rune, m MarshalFunc) {
+	if strings.ContainsRune(builtinVerbs, verb) {
+		panic("wfmt: RegisterMarshaler with built-in verb %" + string(verb))
+	}
+	marshalersMu.Lock()
+	defer marshalersMu.Unlock()
+	old := registeredMarshalers()
+	reg := make(map[rune]MarshalFunc, len(old)+1)
+	for v, f := range old {
+		reg[v] = f
+	}
+	if m != nil {
+		reg[verb] = m
+	} else {
+		delete(reg, verb)
+	}
+	marshalers.Store(reg)
+}
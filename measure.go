@@ -0,0 +1,54 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"unsafe"
+)
+
+// Measure returns the number of columns the output of Sprintf would
+// occupy under the DefaultCondition. See Printer.Measure.
+func Measure(format string, a ...interface{}) (columns int, err error) {
+	var pr Printer
+	return pr.Measure(format, a...)
+}
+
+// Measure returns the number of columns that the output of pr.Sprintf
+// would occupy, that is, the width of its widest line before it is
+// wrapped or rewritten for accessibility, so that a layout can be planned
+// before committing to a column budget. The output is formatted into a
+// reused buffer and never converted to a string. If the format or the
+// operands are bad, as when Sprintf would print "%!d(string=hi)", the
+// error describes the first problem.
+func (pr *Printer) Measure(format string, a ...interface{}) (columns int, err error) {
+	p := pr.newPrinter()
+	p.doPrintf(format, a)
+	c := pr.cond()
+	for b := []byte(p.buf); len(b) > 0; {
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, b = b[:i], b[i+1:]
+		} else {
+			b = nil
+		}
+		if w := c.StringWidth(bytesString(line)); w > columns {
+			columns = w
+		}
+	}
+	if p.badAt >= 0 {
+		err = errors.New("wfmt: bad format: " + strconv.Quote(string(p.buf[p.badAt:])))
+	}
+	p.free()
+	return columns, err
+}
+
+// bytesString returns the bytes of b as a string without copying them.
+// The string must not be used after b is modified.
+func bytesString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A MergeIterator produces one document per record of a mail or report
+// merge; see Merge. Like bufio.Scanner, it is advanced with Next, and Err
+// reports why it stopped.
+type MergeIterator struct {
+	pr      *Printer
+	format  string // format with names replaced by argument indexes
+	names   []string
+	records []map[string]interface{}
+	i       int
+	doc     string
+	err     error
+}
+
+// Merge returns an iterator formatting one document per record with
+// pr.Sprintf. Each verb of format names the field of the record it
+// prints in place of an argument index, as in "%-20[name]s" or
+// "%[price]*[amount]d"; "%%" is a literal percent sign. Validation is
+// strict: the iteration stops with an error at a verb that does not
+// name its field, at a record lacking a field that format names, and at
+// a record whose values the verbs cannot print, as when Sprintf would
+// print "%!d(string=hi)".
+func (pr *Printer) Merge(format string, records []map[string]interface{}) *MergeIterator {
+	m := &MergeIterator{pr: pr, records: records}
+	m.format, m.names, m.err = parseNamed(format)
+	return m
+}
+
+// Merge returns an iterator formatting one document per record with
+// Sprintf. See Printer.Merge.
+func Merge(format string, records []map[string]interface{}) *MergeIterator {
+	return new(Printer).Merge(format, records)
+}
+
+// parseNamed returns format with each [name] replaced by the index of
+// name in names.
+func parseNamed(format string) (string, []string, error) {
+	var b strings.Builder
+	var names []string
+	index := make(map[string]int)
+	for i := 0; i < len(format); {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			i++
+			continue
+		}
+		b.WriteByte('%')
+		i++
+		named := false // whether the last directive of the verb was [name]
+	spec:
+		for {
+			if i >= len(format) {
+				return "", nil, errors.New("wfmt: missing verb at end of " + strconv.Quote(format))
+			}
+			c := format[i]
+			switch {
+			case c == '[':
+				end := strings.IndexByte(format[i:], ']')
+				if end < 0 {
+					return "", nil, errors.New("wfmt: unterminated field name in " + strconv.Quote(format))
+				}
+				name := format[i+1 : i+end]
+				if !isFieldName(name) {
+					return "", nil, errors.New("wfmt: bad field name " + strconv.Quote(name))
+				}
+				n, ok := index[name]
+				if !ok {
+					n = len(names)
+					index[name] = n
+					names = append(names, name)
+				}
+				b.WriteString("[" + strconv.Itoa(n+1) + "]")
+				i += end + 1
+				named = true
+				continue
+			case c == '{':
+				// A time layout, copied as it is.
+				end := strings.IndexByte(format[i:], '}')
+				if end < 0 {
+					return "", nil, errors.New("wfmt: unterminated time layout in " + strconv.Quote(format))
+				}
+				b.WriteString(format[i : i+end+1])
+				i += end + 1
+				continue
+			case c == '*':
+				if !named {
+					return "", nil, errors.New("wfmt: * without a field name in " + strconv.Quote(format))
+				}
+				named = false
+			case c == '\'' && i+1 < len(format):
+				// The fill flag and its rune.
+				_, size := utf8.DecodeRuneInString(format[i+1:])
+				b.WriteString(format[i : i+1+size])
+				i += 1 + size
+				named = false
+				continue
+			case strings.IndexByte("+-# =~|^>,_0123456789.", c) >= 0:
+				named = false
+			default:
+				if c != '%' && !named {
+					return "", nil, errors.New("wfmt: verb without a field name in " + strconv.Quote(format))
+				}
+				b.WriteByte(c)
+				i++
+				break spec
+			}
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), names, nil
+}
+
+// isFieldName reports whether s is a valid field name: letters, digits
+// and underscores, not all digits.
+func isFieldName(s string) bool {
+	digits := true
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			digits = false
+		default:
+			return false
+		}
+	}
+	return s != "" && !digits
+}
+
+// Next formats the document of the next record and reports whether it
+// succeeded. It returns false at the end of the records or on an error.
+func (m *MergeIterator) Next() bool {
+	if m.err != nil || m.i >= len(m.records) {
+		return false
+	}
+	rec := m.records[m.i]
+	args := make([]interface{}, len(m.names))
+	for j, name := range m.names {
+		v, ok := rec[name]
+		if !ok {
+			m.err = errors.New("wfmt: record " + strconv.Itoa(m.i) + " lacks field " + strconv.Quote(name))
+			return false
+		}
+		args[j] = v
+	}
+	p := m.pr.newPrinter()
+	p.doPrintf(m.format, args)
+	if p.badAt >= 0 {
+		m.err = errors.New("wfmt: record " + strconv.Itoa(m.i) + ": bad format: " + strconv.Quote(string(p.buf[p.badAt:])))
+		p.free()
+		return false
+	}
+	m.doc = string(m.pr.output(p, nil))
+	p.free()
+	m.i++
+	return true
+}
+
+// Document returns the document formatted by the last call to Next.
+func (m *MergeIterator) Document() string {
+	return m.doc
+}
+
+// Index returns the index of the record of the current document.
+func (m *MergeIterator) Index() int {
+	return m.i - 1
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (m *MergeIterator) Err() error {
+	return m.err
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestMerge(t *testing.T) {
+	records := []map[string]interface{}{
+		{"name": "山田太郎", "total": 1200, "w": 6},
+		{"name": "Ann", "total": 35, "w": 6, "note": "unused"},
+	}
+	m := (&Printer{Condition: &Condition{}}).Merge("%-'.10[name]s|%[w]*[total]d|%%|%^5[name]s", records)
+	var docs []string
+	for m.Next() {
+		docs = append(docs, m.Document())
+	}
+	if err := m.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	want := []string{"山田太郎..|  1200|%|山田太郎", "Ann.......|    35|%| Ann "}
+	if !reflect.DeepEqual(docs, want) {
+		t.Errorf("documents = %q want %q", docs, want)
+	}
+}
+
+var mergeErrorTests = []struct {
+	format string
+	record map[string]interface{}
+	err    string
+}{
+	{"%s", nil, `wfmt: verb without a field name in "%s"`},
+	{"%[1]s", nil, `wfmt: bad field name "1"`},
+	{"%*[a]d", nil, `wfmt: * without a field name in "%*[a]d"`},
+	{"%[a", nil, `wfmt: unterminated field name in "%[a"`},
+	{"%[a]{15:04t", nil, `wfmt: unterminated time layout in "%[a]{15:04t"`},
+	{"%[a]", nil, `wfmt: missing verb at end of "%[a]"`},
+	{"%[a]s %[b]s", map[string]interface{}{"a": 1}, `wfmt: record 0 lacks field "b"`},
+	{"%[a]d", map[string]interface{}{"a": "hi"}, `wfmt: record 0: bad format: "%!d(string=hi)"`},
+}
+
+func TestMergeTimeLayout(t *testing.T) {
+	when := time.Date(2019, 3, 4, 15, 4, 5, 0, time.UTC)
+	m := Merge("%[who]s at %-7[when]{15:04}t|", []map[string]interface{}{{"who": "山田", "when": when}})
+	if !m.Next() {
+		t.Fatalf("Next() failed: %v", m.Err())
+	}
+	if got, want := m.Document(), "山田 at 15:04  |"; got != want {
+		t.Errorf("Document() = %q want %q", got, want)
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	for _, tt := range mergeErrorTests {
+		m := Merge(tt.format, []map[string]interface{}{tt.record})
+		if m.Next() {
+			t.Errorf("Merge(%q).Next() succeeded with %q", tt.format, m.Document())
+			continue
+		}
+		if err := m.Err(); err == nil || err.Error() != tt.err {
+			t.Errorf("Merge(%q).Err() = %v want %s", tt.format, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime/quotedprintable"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxHeaderLine is the longest line of a header containing encoded-words
+// that RFC 2047 allows.
+const maxHeaderLine = 76
+
+// needsEncoding reports whether s cannot appear in a header as it is.
+func needsEncoding(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if b := s[i]; b >= utf8.RuneSelf || b < ' ' && b != '\t' || b == 0x7f {
+			return true
+		}
+	}
+	return strings.Contains(s, "=?")
+}
+
+// EncodeHeader returns an email header line, without the final line
+// break, giving name the value s. A value that is not plain ASCII is
+// written as UTF-8 MIME encoded-words (=?UTF-8?B?...?=), folded so that
+// no line exceeds 76 bytes. Words are split only between grapheme
+// clusters, so that a mail client never shows half a character.
+func EncodeHeader(name, s string) string {
+	if !needsEncoding(s) {
+		return name + ": " + s
+	}
+	const prefix, suffix = "=?UTF-8?B?", "?="
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteString(":")
+	room := maxHeaderLine - len(name) - 2 // after the colon and a space
+	for len(s) > 0 {
+		max := (room - len(prefix) - len(suffix)) / 4 * 3
+		n := 0
+		for n < len(s) {
+			cl := DefaultCondition.clusterLen(s[n:])
+			if n+cl > max && n > 0 {
+				break
+			}
+			n += cl
+		}
+		if b.Len() > len(name)+1 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(" ")
+		b.WriteString(prefix)
+		b.WriteString(base64.StdEncoding.EncodeToString([]byte(s[:n])))
+		b.WriteString(suffix)
+		s = s[n:]
+		room = maxHeaderLine - 1 // after the folding space
+	}
+	return b.String()
+}
+
+// Headerf formats according to a format specifier and returns the
+// result as a header line given by EncodeHeader.
+func Headerf(name, format string, a ...interface{}) string {
+	return EncodeHeader(name, Sprintf(format, a...))
+}
+
+// QuotedPrintable returns s encoded as a quoted-printable email body,
+// with CRLF line breaks and lines folded at 76 bytes.
+func QuotedPrintable(s string) string {
+	var b bytes.Buffer
+	w := quotedprintable.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.String()
+}
+
+// QuotedPrintablef formats according to a format specifier and returns
+// the result encoded by QuotedPrintable.
+func QuotedPrintablef(format string, a ...interface{}) string {
+	return QuotedPrintable(Sprintf(format, a...))
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"mime"
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+var headerTests = []string{
+	"Monthly report",
+	"月次報告書",
+	strings.Repeat("売上集計と在庫一覧 ", 8),
+	strings.Repeat("👨‍👩‍👧", 10),
+}
+
+func TestEncodeHeader(t *testing.T) {
+	dec := new(mime.WordDecoder)
+	for _, s := range headerTests {
+		h := EncodeHeader("Subject", s)
+		for _, line := range strings.Split(h, "\r\n") {
+			if len(line) > 76 {
+				t.Errorf("EncodeHeader(%q) has a line of %d bytes: %q", s, len(line), line)
+			}
+		}
+		value := strings.TrimPrefix(h, "Subject: ")
+		got, err := dec.DecodeHeader(strings.Replace(value, "\r\n", "", -1))
+		if err != nil || got != s {
+			t.Errorf("EncodeHeader(%q) = %q, decodes to %q, %v", s, h, got, err)
+		}
+		if !strings.HasPrefix(value, "=?") {
+			continue
+		}
+		// Each encoded-word decodes to whole grapheme clusters.
+		for _, word := range strings.Fields(value) {
+			w, err := dec.Decode(word)
+			if err != nil {
+				t.Errorf("Decode(%q): %v", word, err)
+			} else if strings.HasPrefix(w, "\u200d") {
+				t.Errorf("EncodeHeader(%q) splits a cluster: word %q", s, w)
+			}
+		}
+	}
+}
+
+func TestHeaderf(t *testing.T) {
+	if got, want := Headerf("Subject", "%s: %d", "Report", 3), "Subject: Report: 3"; got != want {
+		t.Errorf("Headerf = %q want %q", got, want)
+	}
+	if got, want := Headerf("Subject", "%s", "日本"), "Subject: =?UTF-8?B?5pel5pys?="; got != want {
+		t.Errorf("Headerf = %q want %q", got, want)
+	}
+}
+
+func TestQuotedPrintable(t *testing.T) {
+	got := QuotedPrintablef("%-6s|\n", "日本")
+	if want := "=E6=97=A5=E6=9C=AC  |\r\n"; got != want {
+		t.Errorf("QuotedPrintablef = %q want %q", got, want)
+	}
+	long := QuotedPrintable(strings.Repeat("報告", 20))
+	for _, line := range strings.Split(long, "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("QuotedPrintable line of %d bytes: %q", len(line), line)
+		}
+	}
+}
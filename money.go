@@ -0,0 +1,167 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// fullwidthSymbols maps fullwidth currency signs to their usual forms.
+var fullwidthSymbols = strings.NewReplacer(
+	"＄", "$",
+	"￠", "¢",
+	"￡", "£",
+	"￥", "¥",
+	"￦", "₩",
+)
+
+// A MoneyColumn lays out a column of amounts of money. Currency symbols
+// are left-aligned in a sub-column as wide as the widest symbol, so a
+// fullwidth ￥ and a narrow $ take the same room, and the amounts are
+// right-aligned with their decimal points lined up. Every cell of the
+// column has the same display width.
+type MoneyColumn struct {
+	// Condition measures symbols; DefaultCondition if nil.
+	Condition *Condition
+	// Normalize replaces fullwidth currency signs such as ￥ and ＄
+	// with their usual forms.
+	Normalize bool
+	// Separator, if not empty, groups the integral digits by thousands.
+	Separator string
+
+	cells []moneyCell
+}
+
+type moneyCell struct {
+	symbol string
+	whole  string // sign and integral digits
+	frac   string // decimal point and fraction, or empty
+}
+
+func (c *MoneyColumn) cond() *Condition {
+	if c.Condition != nil {
+		return c.Condition
+	}
+	return DefaultCondition
+}
+
+// Add appends amount in the currency shown as symbol, rounded to the
+// given number of decimals. It returns the index of the new cell.
+func (c *MoneyColumn) Add(symbol string, amount float64, decimals int) int {
+	if c.Normalize {
+		symbol = fullwidthSymbols.Replace(symbol)
+	}
+	whole, frac := splitAmount(amount, decimals, c.Separator)
+	c.cells = append(c.cells, moneyCell{symbol: symbol, whole: whole, frac: frac})
+	return len(c.cells) - 1
+}
+
+// splitAmount formats amount with the given number of decimals and
+// returns its sign and integral digits, grouped by sep, and its decimal
+// point and fraction, if any.
+func splitAmount(amount float64, decimals int, sep string) (whole, frac string) {
+	s := strconv.FormatFloat(amount, 'f', decimals, 64)
+	whole = s
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i:]
+	}
+	return groupThousands(whole, sep), frac
+}
+
+// groupThousands inserts sep between groups of three integral digits,
+// after any sign.
+func groupThousands(digits, sep string) string {
+	if sep == "" {
+		return digits
+	}
+	sign := ""
+	if digits != "" && (digits[0] == '-' || digits[0] == '+') {
+		sign, digits = digits[:1], digits[1:]
+	}
+	return sign + groupDigits(digits, sep, 3)
+}
+
+// groupDigits inserts sep between groups of n digits, counted from the
+// right.
+func groupDigits(digits, sep string, n int) string {
+	if sep == "" || len(digits) <= n {
+		return digits
+	}
+	var b strings.Builder
+	head := len(digits) % n
+	if head == 0 {
+		head = n
+	}
+	b.WriteString(digits[:head])
+	for i := head; i < len(digits); i += n {
+		b.WriteString(sep)
+		b.WriteString(digits[i : i+n])
+	}
+	return b.String()
+}
+
+// Len returns the number of cells in the column.
+func (c *MoneyColumn) Len() int {
+	return len(c.cells)
+}
+
+// moneyWidths are the display widths of the sub-columns of a
+// MoneyColumn: symbol, sign and integral digits, and fraction.
+type moneyWidths struct {
+	sym, whole, frac int
+}
+
+// widths measures the sub-columns of the column.
+func (c *MoneyColumn) widths() (w moneyWidths) {
+	cond := c.cond()
+	for _, cell := range c.cells {
+		if n := cond.StringWidth(cell.symbol); n > w.sym {
+			w.sym = n
+		}
+		if n := cond.StringWidth(cell.whole); n > w.whole {
+			w.whole = n
+		}
+		if n := cond.StringWidth(cell.frac); n > w.frac {
+			w.frac = n
+		}
+	}
+	return w
+}
+
+// Width returns the display width of every cell of the column.
+func (c *MoneyColumn) Width() int {
+	w := c.widths()
+	if w.sym > 0 {
+		w.sym++ // space between symbol and amount
+	}
+	return w.sym + w.whole + w.frac
+}
+
+// Cell returns the ith cell, padded to the width of the column.
+func (c *MoneyColumn) Cell(i int) string {
+	return c.cell(i, c.widths())
+}
+
+// cell returns the ith cell padded to the sub-column widths w.
+func (c *MoneyColumn) cell(i int, w moneyWidths) string {
+	cond := c.cond()
+	cell := c.cells[i]
+	amount := cond.PadLeft(cell.whole, w.whole, ' ') + cond.PadRight(cell.frac, w.frac, ' ')
+	if w.sym == 0 {
+		return amount
+	}
+	return cond.PadRight(cell.symbol, w.sym+1, ' ') + amount
+}
+
+// Cells returns all cells of the column, padded to the same width.
+func (c *MoneyColumn) Cells() []string {
+	w := c.widths()
+	cells := make([]string, len(c.cells))
+	for i := range c.cells {
+		cells[i] = c.cell(i, w)
+	}
+	return cells
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestMoneyColumn(t *testing.T) {
+	c := MoneyColumn{Separator: ","}
+	c.Add("$", 1234.5, 2)
+	c.Add("￥", 1200, 0)
+	c.Add("€", -12.25, 2)
+	c.Add("", 1234567, 0)
+	want := []string{
+		"$      1,234.50",
+		"￥     1,200   ",
+		"€        -12.25",
+		"   1,234,567   ",
+	}
+	if got := c.Cells(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Cells() =\n%q\nwant\n%q", got, want)
+	}
+	if c.Width() != 15 {
+		t.Errorf("Width() = %d want 15", c.Width())
+	}
+}
+
+func TestMoneyColumnNormalize(t *testing.T) {
+	c := MoneyColumn{Normalize: true}
+	c.Add("＄", 5, 2)
+	c.Add("￥", 500, 0)
+	want := []string{"$   5.00", "¥ 500   "}
+	if got := c.Cells(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Cells() = %q want %q", got, want)
+	}
+}
+
+func TestMoneyColumnMultibyteSeparator(t *testing.T) {
+	c := MoneyColumn{Separator: "\u202f"}
+	c.Add("€", 1234567.5, 2)
+	c.Add("€", 12, 2)
+	want := []string{"€ 1\u202f234\u202f567.50", "€        12.00"}
+	if got := c.Cells(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Cells() = %q want %q", got, want)
+	}
+	if got := c.Cell(1); got != want[1] {
+		t.Errorf("Cell(1) = %q want %q", got, want[1])
+	}
+}
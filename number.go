@@ -0,0 +1,116 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "strings"
+
+// NumberFlags are the flags of a numeric directive, for rendering numbers
+// exactly as Printf would without going through a format string.
+type NumberFlags struct {
+	// Width, if positive, is the minimum width of the number in cells.
+	Width int
+	// Minus pads with spaces on the right rather than the left.
+	Minus bool
+	// Plus always prints a sign.
+	Plus bool
+	// Space leaves a space for the sign of a positive number.
+	Space bool
+	// Zero pads with leading zeros after the sign rather than spaces.
+	// It is ignored with Minus or Separator.
+	Zero bool
+	// Sharp selects the alternate format, as the # flag does: a 0b, 0 or
+	// 0x prefix for integers, and a decimal point for floats.
+	Sharp bool
+	// Separator, if not empty, groups the integral digits of decimal
+	// numbers by thousands.
+	Separator string
+}
+
+// appendNumber appends to dst the number written by format using a fmt
+// set up with the flags of nf. If grouped, the leading digits of the
+// number are grouped by nf.Separator before it is padded. The number is
+// formatted in a pooled pp, so that the fmt does not escape to the heap.
+func (nf NumberFlags) appendNumber(dst []byte, grouped bool, format func(f *fmt)) []byte {
+	p := newPrinter()
+	f := &p.fmt
+	f.minus, f.plus, f.space, f.sharp = nf.Minus, nf.Plus, nf.Space, nf.Sharp
+	if !grouped || nf.Separator == "" {
+		f.zero = nf.Zero && !nf.Minus
+		f.wid, f.widPresent = nf.Width, nf.Width > 0
+		format(f)
+	} else {
+		format(f)
+		num := groupLeading(string(p.buf), nf.Separator, 3, false)
+		p.buf = p.buf[:0]
+		f.wid, f.widPresent = nf.Width, nf.Width > 0
+		f.padString(num)
+	}
+	dst = append(dst, p.buf...)
+	p.free()
+	return dst
+}
+
+// groupLeading groups by sep, n at a time, the run of digits after the
+// sign and any 0b, 0o or 0x prefix at the start of num. The digits are
+// hexadecimal if hex is set.
+func groupLeading(num, sep string, n int, hex bool) string {
+	i := 0
+	if i < len(num) && (num[i] == '-' || num[i] == '+' || num[i] == ' ') {
+		i++
+	}
+	if i+1 < len(num) && num[i] == '0' && strings.IndexByte("bBoOxX", num[i+1]) >= 0 {
+		i += 2
+	}
+	j := i
+	for j < len(num) && ('0' <= num[j] && num[j] <= '9' || hex && strings.IndexByte("abcdefABCDEF", num[j]) >= 0) {
+		j++
+	}
+	return num[:i] + groupDigits(num[i:j], sep, n) + num[j:]
+}
+
+// integerVerb returns the verb formatting integers in base.
+func integerVerb(base int) rune {
+	switch base {
+	case 2:
+		return 'b'
+	case 8:
+		return 'o'
+	case 10:
+		return 'd'
+	case 16:
+		return 'x'
+	}
+	panic("wfmt: illegal AppendInt/AppendUint base")
+}
+
+// AppendInt appends to dst the integer i in the given base, which must be
+// 2, 8, 10 or 16, formatted as %d, %x, %o or %b would with the flags of
+// nf, and returns the extended buffer.
+func AppendInt(dst []byte, i int64, base int, nf NumberFlags) []byte {
+	verb := integerVerb(base)
+	return nf.appendNumber(dst, base == 10, func(f *fmt) {
+		f.fmtInteger(uint64(i), base, signed, verb, ldigits)
+	})
+}
+
+// AppendUint is like AppendInt for unsigned integers.
+func AppendUint(dst []byte, u uint64, base int, nf NumberFlags) []byte {
+	verb := integerVerb(base)
+	return nf.appendNumber(dst, base == 10, func(f *fmt) {
+		f.fmtInteger(u, base, unsigned, verb, ldigits)
+	})
+}
+
+// AppendFloat appends to dst the floating-point number v, formatted as
+// Printf would with the verb verb, the precision prec and the flags of
+// nf, and returns the extended buffer. The verb, prec and bitSize
+// arguments are the fmt, prec and bitSize of strconv.AppendFloat: a precision of -1 uses the
+// smallest number of digits necessary to represent v exactly.
+func AppendFloat(dst []byte, v float64, verb byte, prec, bitSize int, nf NumberFlags) []byte {
+	grouped := verb == 'f' || verb == 'g' || verb == 'G'
+	return nf.appendNumber(dst, grouped, func(f *fmt) {
+		f.fmtFloat(v, bitSize, rune(verb), prec)
+	})
+}
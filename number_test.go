@@ -0,0 +1,115 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+var appendIntTests = []struct {
+	i    int64
+	base int
+	nf   NumberFlags
+	out  string
+}{
+	{42, 10, NumberFlags{}, "42"},
+	{-42, 10, NumberFlags{Width: 6}, "   -42"},
+	{-42, 10, NumberFlags{Width: 6, Zero: true}, "-00042"},
+	{42, 10, NumberFlags{Width: 6, Minus: true, Plus: true}, "+42   "},
+	{42, 10, NumberFlags{Space: true}, " 42"},
+	{255, 16, NumberFlags{Sharp: true}, "0xff"},
+	{5, 2, NumberFlags{Width: 8, Zero: true}, "00000101"},
+	{8, 8, NumberFlags{Sharp: true}, "010"},
+	{1234567, 10, NumberFlags{Separator: ","}, "1,234,567"},
+	{-1234567, 10, NumberFlags{Width: 12, Separator: ","}, "  -1,234,567"},
+	{1234567, 16, NumberFlags{Separator: ","}, "12d687"},
+}
+
+func TestAppendInt(t *testing.T) {
+	for _, tt := range appendIntTests {
+		got := string(AppendInt([]byte("x="), tt.i, tt.base, tt.nf))
+		if got != "x="+tt.out {
+			t.Errorf("AppendInt(%d, %d, %+v) = %q want %q", tt.i, tt.base, tt.nf, got, "x="+tt.out)
+		}
+	}
+}
+
+func TestAppendUint(t *testing.T) {
+	got := string(AppendUint(nil, 1<<64-1, 10, NumberFlags{Separator: "_"}))
+	if want := "18_446_744_073_709_551_615"; got != want {
+		t.Errorf("AppendUint = %q want %q", got, want)
+	}
+}
+
+var appendFloatTests = []struct {
+	v    float64
+	verb byte
+	prec int
+	nf   NumberFlags
+	out  string
+}{
+	{3.25, 'f', 2, NumberFlags{}, "3.25"},
+	{-3.25, 'f', 1, NumberFlags{Width: 8, Zero: true}, "-00003.2"},
+	{3.25, 'e', -1, NumberFlags{Plus: true}, "+3.25e+00"},
+	{2, 'g', -1, NumberFlags{Sharp: true}, "2.00000"},
+	{1234567.5, 'f', 1, NumberFlags{Width: 12, Separator: ","}, " 1,234,567.5"},
+	{-1234567.5, 'f', 1, NumberFlags{Width: 12, Minus: true, Separator: " "}, "-1 234 567.5"},
+}
+
+func TestAppendFloat(t *testing.T) {
+	for _, tt := range appendFloatTests {
+		got := string(AppendFloat(nil, tt.v, tt.verb, tt.prec, 64, tt.nf))
+		if got != tt.out {
+			t.Errorf("AppendFloat(%g, %c, %d, %+v) = %q want %q", tt.v, tt.verb, tt.prec, tt.nf, got, tt.out)
+		}
+		// The same number through Sprintf.
+		if tt.nf.Separator != "" || tt.prec < 0 {
+			continue
+		}
+		format := "%"
+		if tt.nf.Plus {
+			format += "+"
+		}
+		if tt.nf.Zero {
+			format += "0"
+		}
+		if tt.nf.Sharp {
+			format += "#"
+		}
+		if tt.nf.Width > 0 {
+			format += Sprint(tt.nf.Width)
+		}
+		format += "." + Sprint(tt.prec) + string(tt.verb)
+		if want := Sprintf(format, tt.v); got != want {
+			t.Errorf("AppendFloat(%g, %c, %d, %+v) = %q; Sprintf(%q) = %q", tt.v, tt.verb, tt.prec, tt.nf, got, format, want)
+		}
+	}
+}
+
+// Formatting a single number or string with a width allocates nothing
+// once the buffer has room for it.
+func TestAppendAllocs(t *testing.T) {
+	buf := make([]byte, 0, 64)
+	s := "日本"
+	tests := []struct {
+		name string
+		f    func()
+	}{
+		{"AppendInt", func() { buf = AppendInt(buf[:0], -123456, 10, NumberFlags{Width: 10}) }},
+		{"AppendUint", func() { buf = AppendUint(buf[:0], 0xbeef, 16, NumberFlags{Width: 8, Zero: true}) }},
+		{"AppendFloat", func() { buf = AppendFloat(buf[:0], 3.25, 'f', 2, 64, NumberFlags{Width: 10, Minus: true}) }},
+		{"Appendf %d", func() { buf = Appendf(buf[:0], "%10d", 123456) }},
+		{"Appendf %f", func() { buf = Appendf(buf[:0], "%^10.2f", 3.25) }},
+		{"Appendf %s", func() { buf = Appendf(buf[:0], "%-10s", s) }},
+		{"Appendf %q", func() { buf = Appendf(buf[:0], "%10q", s) }},
+	}
+	for _, tt := range tests {
+		if n := testing.AllocsPerRun(100, tt.f); n > 0 {
+			t.Errorf("%s allocates %v times per call", tt.name, n)
+		}
+	}
+}
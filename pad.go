@@ -0,0 +1,48 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+// PadLeft returns s right-aligned in a field of width cells, padded on
+// the left with fill. A wide fill, such as '　', is repeated half as
+// often, and a space makes up an odd cell. s is returned unchanged if
+// it is already at least width cells wide.
+func (c *Condition) PadLeft(s string, width int, fill rune) string {
+	return c.fill(fill, width-c.StringWidth(s)) + s
+}
+
+// PadRight returns s left-aligned in a field of width cells, padded on
+// the right with fill, as described for PadLeft.
+func (c *Condition) PadRight(s string, width int, fill rune) string {
+	return s + c.fill(fill, width-c.StringWidth(s))
+}
+
+// Center returns s centered in a field of width cells, padded on both
+// sides with fill, as described for PadLeft. When the padding cannot be
+// split evenly the extra cell goes to the right.
+func (c *Condition) Center(s string, width int, fill rune) string {
+	pad := width - c.StringWidth(s)
+	if pad <= 0 {
+		return s
+	}
+	return c.fill(fill, pad/2) + s + c.fill(fill, pad-pad/2)
+}
+
+// PadLeft returns s right-aligned in a field of width cells under the
+// DefaultCondition. See Condition.PadLeft.
+func PadLeft(s string, width int, fill rune) string {
+	return DefaultCondition.PadLeft(s, width, fill)
+}
+
+// PadRight returns s left-aligned in a field of width cells under the
+// DefaultCondition. See Condition.PadRight.
+func PadRight(s string, width int, fill rune) string {
+	return DefaultCondition.PadRight(s, width, fill)
+}
+
+// Center returns s centered in a field of width cells under the
+// DefaultCondition. See Condition.Center.
+func Center(s string, width int, fill rune) string {
+	return DefaultCondition.Center(s, width, fill)
+}
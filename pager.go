@@ -0,0 +1,130 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// defaultPager is run when $PAGER is unset.
+const defaultPager = "less"
+
+// A Pager collects formatted output and shows it when closed. If Out is a
+// terminal and the output is taller than the terminal, it is piped through
+// the user's pager, as git log does; otherwise it is written to Out directly.
+//
+// The zero value writes to standard output and honors $PAGER.
+type Pager struct {
+	// Out is the destination. If nil, os.Stdout is used.
+	Out *os.File
+	// Command is the pager command line. If empty, $PAGER is used,
+	// falling back to "less". A command of "cat" disables paging.
+	Command string
+
+	buf buffer
+}
+
+// NewPager returns a Pager writing to standard output.
+func NewPager() *Pager {
+	return &Pager{Out: os.Stdout}
+}
+
+// Write appends b to the output held by the pager.
+func (p *Pager) Write(b []byte) (n int, err error) {
+	p.buf.Write(b)
+	return len(b), nil
+}
+
+// WriteString appends s to the output held by the pager.
+func (p *Pager) WriteString(s string) (n int, err error) {
+	p.buf.WriteString(s)
+	return len(s), nil
+}
+
+// Close shows the collected output, paging it if necessary, and waits
+// for the pager to exit. If the pager cannot be started the output is
+// written to Out directly.
+func (p *Pager) Close() error {
+	out := p.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	b := p.buf
+	p.buf = nil
+
+	cmd := p.command()
+	cols, rows, ok := terminalSize(out.Fd())
+	if !ok || cmd == "" || cmd == "cat" || displayLines(b, cols) < rows {
+		_, err := out.Write(b)
+		return err
+	}
+
+	c := pagerCommand(cmd)
+	if c == nil {
+		_, err := out.Write(b)
+		return err
+	}
+	c.Stdin = bytes.NewReader(b)
+	c.Stdout = out
+	c.Stderr = os.Stderr
+	c.Env = os.Environ()
+	if os.Getenv("LESS") == "" {
+		// Quit if one screen, keep colors, and leave the screen alone on exit.
+		c.Env = append(c.Env, "LESS=FRX")
+	}
+	if err := c.Start(); err != nil {
+		_, err = out.Write(b)
+		return err
+	}
+	return c.Wait()
+}
+
+// command returns the pager command line to run.
+func (p *Pager) command() string {
+	if p.Command != "" {
+		return strings.TrimSpace(p.Command)
+	}
+	if cmd, ok := os.LookupEnv("PAGER"); ok {
+		return strings.TrimSpace(cmd)
+	}
+	return defaultPager
+}
+
+// pagerCommand returns the command that runs the pager command line cmd,
+// or nil if cmd is blank.
+func pagerCommand(cmd string) *exec.Cmd {
+	args := strings.Fields(cmd)
+	if len(args) == 0 {
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		return exec.Command(args[0], args[1:]...)
+	}
+	return exec.Command("sh", "-c", cmd)
+}
+
+// displayLines returns the number of terminal rows b occupies when shown
+// on a terminal cols cells wide, counting lines that wrap.
+func displayLines(b []byte, cols int) (n int) {
+	for len(b) > 0 {
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, b = b[:i], b[i+1:]
+		} else {
+			b = nil
+		}
+		n++
+		if cols > 0 {
+			if w := stringWidth(string(line)); w > cols {
+				n += (w - 1) / cols
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,36 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestPagerNotTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	p := &Pager{Out: w, Command: "false"}
+	for i := 0; i < 100; i++ {
+		Fprintf(p, "%-6s|%3d\n", "行", i)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(b), 100*len("行    |  0\n"); got != want {
+		t.Errorf("got %d bytes, want %d", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"math"
+	"strings"
+)
+
+// A PlotStyle selects the characters a Plot is drawn with.
+type PlotStyle int
+
+const (
+	// BlockPlot draws a bar per value with the block elements ▁ to █,
+	// which give eight levels per row.
+	BlockPlot PlotStyle = iota
+	// BraillePlot draws a line with Braille dots, two values per cell
+	// and four levels per row.
+	BraillePlot
+)
+
+// blocks are the block elements from empty to full.
+var blocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// brailleDots are the dot bits of a Braille cell, by column and by row
+// from the top.
+var brailleDots = [2][4]rune{
+	{0x01, 0x02, 0x04, 0x40},
+	{0x08, 0x10, 0x20, 0x80},
+}
+
+// A Plot renders a small numeric series as a text chart with its
+// maximum and minimum labeled on a left axis. The whole chart fits in
+// Width cells; when the series has more values than fit, consecutive
+// values are averaged.
+//
+// Block elements and box drawing characters are East Asian ambiguous,
+// so under an East Asian Condition they take two cells and fewer values
+// fit in the same width. Braille patterns are always narrow.
+type Plot struct {
+	Style PlotStyle
+	// Width is the width of the chart in cells, including the labels.
+	// If zero, the chart is as wide as the series needs.
+	Width int
+	// Height is the number of rows; 4 if zero.
+	Height int
+	// Format formats the labels; "%.4g" if empty.
+	Format string
+	// Condition measures text; DefaultCondition if nil.
+	Condition *Condition
+}
+
+func (p *Plot) cond() *Condition {
+	if p.Condition != nil {
+		return p.Condition
+	}
+	return DefaultCondition
+}
+
+// Lines returns the rows of the chart of series.
+func (p *Plot) Lines(series []float64) []string {
+	c := p.cond()
+	height := p.Height
+	if height <= 0 {
+		height = 4
+	}
+	format := p.Format
+	if format == "" {
+		format = "%.4g"
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range series {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	if len(series) == 0 {
+		lo, hi = 0, 0
+	}
+	top, bottom := Sprintf(format, hi), Sprintf(format, lo)
+	lw := c.StringWidth(top)
+	if w := c.StringWidth(bottom); w > lw {
+		lw = w
+	}
+
+	// Work out how many values fit.
+	perCell, cell := 1, blocks[len(blocks)-1]
+	if p.Style == BraillePlot {
+		perCell, cell = 2, 0x2800
+	}
+	cw := c.RuneWidth(cell)
+	n := len(series)
+	if p.Width > 0 {
+		room := p.Width - lw - c.StringWidth("┤")
+		if fit := room / cw * perCell; fit < n {
+			n = fit
+		}
+		if n < 0 {
+			n = 0
+		}
+	}
+	values := resample(series, n)
+
+	// levels is the number of distinct heights the chart can show.
+	levels := height * (len(blocks) - 1)
+	if p.Style == BraillePlot {
+		levels = height * 4
+	}
+	level := func(v float64) int {
+		if hi == lo {
+			return 0
+		}
+		return int(math.Round((v - lo) / (hi - lo) * float64(levels-1)))
+	}
+
+	rows := make([]string, height)
+	for r := range rows {
+		fromBottom := height - 1 - r
+		var b strings.Builder
+		label, axis := "", "│"
+		switch r {
+		case 0:
+			label, axis = top, "┤"
+		case height - 1:
+			label, axis = bottom, "┤"
+		}
+		b.WriteString(Sprintf("%*s%s", lw, label, axis))
+		if p.Style == BraillePlot {
+			for i := 0; i < len(values); i += 2 {
+				dots := rune(0x2800)
+				for col := 0; col < 2 && i+col < len(values); col++ {
+					if d := level(values[i+col]) - 4*fromBottom; 0 <= d && d < 4 {
+						dots |= brailleDots[col][3-d]
+					}
+				}
+				b.WriteRune(dots)
+			}
+		} else {
+			for _, v := range values {
+				fill := level(v) + 1 - (len(blocks)-1)*fromBottom
+				if fill < 0 {
+					fill = 0
+				} else if fill > len(blocks)-1 {
+					fill = len(blocks) - 1
+				}
+				b.WriteRune(blocks[fill])
+			}
+		}
+		rows[r] = b.String()
+	}
+	return rows
+}
+
+// Render returns the chart of series as lines ending in newlines.
+func (p *Plot) Render(series []float64) string {
+	return strings.Join(p.Lines(series), "\n") + "\n"
+}
+
+// resample returns n values summarizing series, each the mean of a run
+// of consecutive values. It returns series itself if n is not smaller.
+func resample(series []float64, n int) []float64 {
+	if n >= len(series) {
+		return series
+	}
+	out := make([]float64, n)
+	for i := range out {
+		start, end := i*len(series)/n, (i+1)*len(series)/n
+		sum := 0.0
+		for _, v := range series[start:end] {
+			sum += v
+		}
+		out[i] = sum / float64(end-start)
+	}
+	return out
+}
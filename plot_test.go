@@ -0,0 +1,45 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestBlockPlot(t *testing.T) {
+	p := &Plot{Height: 2, Condition: &Condition{}}
+	got := p.Lines([]float64{0, 5, 10, 15})
+	want := []string{
+		"15┤  ▃█",
+		" 0┤▁▆██",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines = %q want %q", got, want)
+	}
+}
+
+func TestBraillePlot(t *testing.T) {
+	p := &Plot{Style: BraillePlot, Height: 1, Condition: &Condition{}}
+	got := p.Lines([]float64{0, 1, 2, 3})
+	want := []string{"3┤⡠⠊"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines = %q want %q", got, want)
+	}
+}
+
+func TestPlotWidth(t *testing.T) {
+	series := []float64{1, 3, 1, 3, 1, 3, 1, 3}
+	p := &Plot{Width: 6, Height: 1, Condition: &Condition{}}
+	if got, want := p.Render(series), "3┤▅▅▅▅\n"; got != want {
+		t.Errorf("Render = %q want %q", got, want)
+	}
+	p.Condition = &Condition{EastAsian: true}
+	if got, want := p.Render(series), "3┤▅\n"; got != want {
+		t.Errorf("East Asian Render = %q want %q", got, want)
+	}
+}
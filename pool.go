@@ -0,0 +1,46 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+// A BufferPool supplies the buffers in which a Printer formats its
+// output, in place of the pool wfmt keeps itself, for programs that
+// manage their memory in arenas or pools of their own.
+//
+// Get returns a buffer to format into, which may be nil or hold stale
+// bytes; only its capacity is used. Put takes back a buffer returned by
+// Get once the call is done with it, possibly grown and holding the
+// output. A BufferPool must be safe for concurrent use if its Printer
+// is.
+type BufferPool interface {
+	Get() []byte
+	Put(b []byte)
+}
+
+// NoPool, used as Printer.Pool, formats each call in a buffer of its
+// own, which is left to the garbage collector, so that no buffer outlives
+// the call that grew it.
+var NoPool BufferPool = noPool{}
+
+type noPool struct{}
+
+func (noPool) Get() []byte  { return nil }
+func (noPool) Put(b []byte) {}
+
+// usePool makes p format into a buffer from pool until it is freed,
+// keeping its own buffer aside.
+func (p *pp) usePool(pool BufferPool) {
+	p.pool = pool
+	p.spare, p.buf = p.buf, pool.Get()[:0]
+}
+
+// releasePool returns the buffer of p to its pool, if it has one, and
+// restores the buffer of p.
+func (p *pp) releasePool() {
+	if p.pool == nil {
+		return
+	}
+	p.pool.Put(p.buf)
+	p.buf, p.spare, p.pool = p.spare, nil, nil
+}
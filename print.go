@@ -5,11 +5,20 @@
 package wfmt
 
 import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	stdfmt "fmt"
 	"io"
 	"os"
 	"reflect"
 	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/lostsnow/wfmt/fmtsort"
@@ -30,8 +39,14 @@ const (
 	extraString       = "%!(EXTRA "
 	badWidthString    = "%!(BADWIDTH)"
 	badPrecString     = "%!(BADPREC)"
+	badBaseString     = "(BADBASE)"
+	badLayoutString   = "(BADLAYOUT)"
+	badUTF8String     = "(BADUTF8="
+	textErrorString   = "(ERROR="
 	noVerbString      = "%!(NOVERB)"
 	invReflectString  = "<invalid reflect.Value>"
+
+	canonicalTimeString = "<time>"
 )
 
 // State represents the printer state passed to custom formatters.
@@ -49,6 +64,22 @@ type State interface {
 	Flag(c int) bool
 }
 
+// A ColumnState is the State passed to custom formatters, both those
+// implementing Formatter and those implementing the Formatter of package
+// fmt. Its Width and Precision are those of the directive, which wfmt
+// measures in display columns, and Pad writes a string padded and
+// truncated as the directive would print it with the verb s.
+//
+// A formatter written for package fmt that pads its output itself, as
+// with fmt.Fprintf(f, "%*s", w, s), pads by counting runes, which makes
+// text containing wide characters too wide. wfmt removes the surplus
+// padding spaces from such output, so the operand still fills the
+// width in display columns.
+type ColumnState interface {
+	State
+	Pad(s string) (n int, err error)
+}
+
 // Formatter is the interface implemented by values with a custom formatter.
 // The implementation of Format may call Sprint(f) or Fprint(f) etc.
 // to generate its output.
@@ -73,6 +104,52 @@ type GoStringer interface {
 	GoString() string
 }
 
+// TextAppender is implemented by any value that has an AppendText method,
+// which appends the textual form of the value to a buffer. Values that
+// are neither Stringers nor errors are printed with %v and %s by their
+// AppendText method, or failing that by the MarshalText method of
+// encoding.TextMarshaler, rather than as their underlying type.
+type TextAppender interface {
+	AppendText(b []byte) ([]byte, error)
+}
+
+// FormatString returns a string representing the fully qualified formatting
+// directive captured by the State, followed by the argument verb. (State does not
+// itself contain the verb.) The result has a leading percent sign followed by any
+// flags, including the width unit flags = ~ and |, the centering flag ^, the ellipsis
+// flag >, the grouping flags , and _ and the fill flag ' with its rune, the width,
+// the precision, and the time layout in braces.
+// Missing flags, width, and precision are omitted. This function allows a Formatter
+// to reconstruct the original directive triggering the call to Format.
+func FormatString(state State, verb rune) string {
+	var tmp [16]byte // Use a local buffer.
+	b := append(tmp[:0], '%')
+	for _, c := range " +-#0=~|^>,_" { // All known flags
+		if state.Flag(int(c)) { // The argument is an int for historical reasons.
+			b = append(b, byte(c))
+		}
+	}
+	p, isPP := state.(*pp)
+	if isPP && p.fmt.fill != 0 {
+		b = append(b, '\'')
+		b = append(b, string(p.fmt.fill)...)
+	}
+	if w, ok := state.Width(); ok {
+		b = strconv.AppendInt(b, int64(w), 10)
+	}
+	if prec, ok := state.Precision(); ok {
+		b = append(b, '.')
+		b = strconv.AppendInt(b, int64(prec), 10)
+	}
+	if isPP && p.layout != "" {
+		b = append(b, '{')
+		b = append(b, p.layout...)
+		b = append(b, '}')
+	}
+	b = append(b, string(verb)...)
+	return string(b)
+}
+
 // Use simple []byte instead of bytes.Buffer to avoid large dependency.
 type buffer []byte
 
@@ -126,8 +203,60 @@ type pp struct {
 	erroring bool
 	// wrapErrs is set when the format string may contain a %w verb.
 	wrapErrs bool
-	// wrappedErr records the target of the %w verb.
-	wrappedErr error
+	// wrappedErrs records the targets of the %w verb.
+	wrappedErrs []int
+	// annotate is set when the position of each formatted operand is recorded in spans.
+	annotate bool
+	spans    []fieldSpan
+	// badAt is the offset in buf of the first formatting error, or -1.
+	badAt int
+	// canonical is set when rendering for a digest, which omits pointer
+	// values and times.
+	canonical bool
+	// unsorted is set when map entries are printed in iteration order.
+	unsorted bool
+	// debug is set when bad verb diagnostics name the operand, whose
+	// index is field, and the package path of its type.
+	debug bool
+	field int
+	// layout is the time layout in braces of the current verb, as in
+	// %{15:04}t.
+	layout string
+	// indentString, if not empty, makes %#v put each element of a
+	// composite value on a line of its own, indented by indentString
+	// once for each of the indent levels of nesting.
+	indentString string
+	indent       int
+	// redact, if not nil, filters each operand before it is formatted.
+	redact func(arg interface{}) (interface{}, bool)
+	// maxBytes, if positive, is the length of buf beyond which the
+	// elements of composite values are not formatted.
+	maxBytes int
+	// maxDepth, if positive, is the number of levels of nested composite
+	// values printed; nest is the level of the value being printed.
+	maxDepth int
+	nest     int
+
+	// typed holds the operand of Sprintf1 and the like, and typedArgs
+	// points to it, so that it is passed to doPrintf without boxing.
+	typed     typed
+	typedArgs [1]interface{}
+
+	// pool, if not nil, supplied buf, and spare holds the buffer of the
+	// pp until buf is returned to pool.
+	pool  BufferPool
+	spare buffer
+
+	// sink is the writer of the Fprint functions when output is
+	// streamed to it; see stream.
+	sink sink
+}
+
+// fieldSpan records the bytes of buf holding a formatted operand.
+type fieldSpan struct {
+	arg        int
+	verb       rune
+	start, end int
 }
 
 var ppFree = sync.Pool{
@@ -147,7 +276,18 @@ func newPrinter() *pp {
 	p.panicking = false
 	p.erroring = false
 	p.wrapErrs = false
-	p.fmt.init(&p.buf)
+	p.annotate = false
+	p.spans = p.spans[:0]
+	p.badAt = -1
+	p.canonical = false
+	p.unsorted = false
+	p.debug = false
+	p.layout = ""
+	p.indentString = ""
+	p.redact = nil
+	p.maxBytes = 0
+	p.maxDepth = 0
+	p.fmt.init(&p.buf, DefaultCondition)
 	return p
 }
 
@@ -159,6 +299,7 @@ func (p *pp) free() {
 	// to place back in the pool.
 	//
 	// See https://golang.org/issue/23199
+	p.releasePool()
 	if cap(p.buf) > 64<<10 {
 		return
 	}
@@ -166,7 +307,11 @@ func (p *pp) free() {
 	p.buf = p.buf[:0]
 	p.arg = nil
 	p.value = reflect.Value{}
-	p.wrappedErr = nil
+	p.wrappedErrs = p.wrappedErrs[:0]
+	p.redact = nil
+	p.typed = typed{}
+	p.sink = sink{}
+	p.fmt.sink = nil
 	ppFree.Put(p)
 }
 
@@ -186,10 +331,61 @@ func (p *pp) Flag(b int) bool {
 		return p.fmt.space
 	case '0':
 		return p.fmt.zero
+	case '=':
+		return p.fmt.unit == UnitBytes
+	case '~':
+		return p.fmt.unit == UnitRunes
+	case '|':
+		return p.fmt.unit == UnitColumns
+	case '^':
+		return p.fmt.center
+	case '>':
+		return p.fmt.ellipsis
+	case ',':
+		return p.fmt.group
+	case '_':
+		return p.fmt.underscore
+	case '\'':
+		return p.fmt.fill != 0
 	}
 	return false
 }
 
+// Pad writes s padded and truncated according to the width, precision
+// and flags of the directive being formatted, as the verb s would.
+func (p *pp) Pad(s string) (n int, err error) {
+	start := len(p.buf)
+	p.fmt.fmtS(s)
+	return len(p.buf) - start, nil
+}
+
+// realign removes the surplus padding from the output a custom formatter
+// wrote to buf from start, if it padded to the width by counting runes
+// rather than display columns.
+func (p *pp) realign(start int) {
+	if !p.fmt.widPresent || len(p.buf) <= start {
+		return
+	}
+	out := p.buf[start:]
+	excess := p.fmt.cond.StringWidth(string(out)) - p.fmt.wid
+	if excess <= 0 {
+		return
+	}
+	if p.fmt.minus {
+		n := 0
+		for n < excess && n < len(out) && out[len(out)-1-n] == ' ' {
+			n++
+		}
+		p.buf = p.buf[:len(p.buf)-n]
+		return
+	}
+	n := 0
+	for n < excess && n < len(out) && out[n] == ' ' {
+		n++
+	}
+	p.buf = append(p.buf[:start], out[n:]...)
+}
+
 // Implement Write so we can call Fprintf on a pp (through State), for
 // recursive use in custom verbs.
 func (p *pp) Write(b []byte) (ret int, err error) {
@@ -208,10 +404,16 @@ func (p *pp) WriteString(s string) (ret int, err error) {
 
 // Fprintf formats according to a format specifier and writes to w.
 // It returns the number of bytes written and any write error encountered.
+// If w is an io.StringWriter, the output is written with WriteString,
+// as it is by Fprint and Fprintln, and w must not retain the string.
 func Fprintf(w io.Writer, format string, a ...interface{}) (n int, err error) {
+	if pr := configured(); pr != nil {
+		return pr.Fprintf(w, format, a...)
+	}
 	p := newPrinter()
+	p.stream(w)
 	p.doPrintf(format, a)
-	n, err = w.Write(p.buf)
+	n, err = p.writeOut(w, p.buf)
 	p.free()
 	return
 }
@@ -224,6 +426,9 @@ func Printf(format string, a ...interface{}) (n int, err error) {
 
 // Sprintf formats according to a format specifier and returns the resulting string.
 func Sprintf(format string, a ...interface{}) string {
+	if pr := configured(); pr != nil {
+		return pr.Sprintf(format, a...)
+	}
 	p := newPrinter()
 	p.doPrintf(format, a)
 	s := string(p.buf)
@@ -231,15 +436,60 @@ func Sprintf(format string, a ...interface{}) string {
 	return s
 }
 
+// Appendf formats according to a format specifier, appends the result to the byte
+// slice, and returns the updated slice.
+func Appendf(b []byte, format string, a ...interface{}) []byte {
+	if pr := configured(); pr != nil {
+		return pr.Appendf(b, format, a...)
+	}
+	p := newPrinter()
+	p.doPrintf(format, a)
+	b = append(b, p.buf...)
+	p.free()
+	return b
+}
+
+// ErrTooLong is returned by Bprintf when the output does not fit in the
+// buffer.
+var ErrTooLong = errors.New("wfmt: output too long for the buffer")
+
+// Bprintf formats according to a format specifier and writes the result
+// to buf, which it never grows, for formatting into preallocated records
+// without allocating. It returns the number of bytes written, the
+// output being buf[:n]. If the output is longer than buf, Bprintf writes
+// nothing and returns 0 and ErrTooLong.
+func Bprintf(buf []byte, format string, a ...interface{}) (n int, err error) {
+	if pr := configured(); pr != nil {
+		return pr.Bprintf(buf, format, a...)
+	}
+	p := newPrinter()
+	p.doPrintf(format, a)
+	n, err = bcopy(buf, p.buf)
+	p.free()
+	return
+}
+
+// bcopy copies out to buf, if it fits, for Bprintf.
+func bcopy(buf, out []byte) (n int, err error) {
+	if len(out) > len(buf) {
+		return 0, ErrTooLong
+	}
+	return copy(buf, out), nil
+}
+
 // These routines do not take a format string
 
 // Fprint formats using the default formats for its operands and writes to w.
 // Spaces are added between operands when neither is a string.
 // It returns the number of bytes written and any write error encountered.
 func Fprint(w io.Writer, a ...interface{}) (n int, err error) {
+	if pr := configured(); pr != nil {
+		return pr.Fprint(w, a...)
+	}
 	p := newPrinter()
+	p.stream(w)
 	p.doPrint(a)
-	n, err = w.Write(p.buf)
+	n, err = p.writeOut(w, p.buf)
 	p.free()
 	return
 }
@@ -254,6 +504,9 @@ func Print(a ...interface{}) (n int, err error) {
 // Sprint formats using the default formats for its operands and returns the resulting string.
 // Spaces are added between operands when neither is a string.
 func Sprint(a ...interface{}) string {
+	if pr := configured(); pr != nil {
+		return pr.Sprint(a...)
+	}
 	p := newPrinter()
 	p.doPrint(a)
 	s := string(p.buf)
@@ -261,6 +514,19 @@ func Sprint(a ...interface{}) string {
 	return s
 }
 
+// Append formats using the default formats for its operands, appends the result to
+// the byte slice, and returns the updated slice.
+func Append(b []byte, a ...interface{}) []byte {
+	if pr := configured(); pr != nil {
+		return pr.Append(b, a...)
+	}
+	p := newPrinter()
+	p.doPrint(a)
+	b = append(b, p.buf...)
+	p.free()
+	return b
+}
+
 // These routines end in 'ln', do not take a format string,
 // always add spaces between operands, and add a newline
 // after the last operand.
@@ -269,9 +535,13 @@ func Sprint(a ...interface{}) string {
 // Spaces are always added between operands and a newline is appended.
 // It returns the number of bytes written and any write error encountered.
 func Fprintln(w io.Writer, a ...interface{}) (n int, err error) {
+	if pr := configured(); pr != nil {
+		return pr.Fprintln(w, a...)
+	}
 	p := newPrinter()
+	p.stream(w)
 	p.doPrintln(a)
-	n, err = w.Write(p.buf)
+	n, err = p.writeOut(w, p.buf)
 	p.free()
 	return
 }
@@ -286,6 +556,9 @@ func Println(a ...interface{}) (n int, err error) {
 // Sprintln formats using the default formats for its operands and returns the resulting string.
 // Spaces are always added between operands and a newline is appended.
 func Sprintln(a ...interface{}) string {
+	if pr := configured(); pr != nil {
+		return pr.Sprintln(a...)
+	}
 	p := newPrinter()
 	p.doPrintln(a)
 	s := string(p.buf)
@@ -293,6 +566,20 @@ func Sprintln(a ...interface{}) string {
 	return s
 }
 
+// Appendln formats using the default formats for its operands, appends the result
+// to the byte slice, and returns the updated slice. Spaces are always added
+// between operands and a newline is appended.
+func Appendln(b []byte, a ...interface{}) []byte {
+	if pr := configured(); pr != nil {
+		return pr.Appendln(b, a...)
+	}
+	p := newPrinter()
+	p.doPrintln(a)
+	b = append(b, p.buf...)
+	p.free()
+	return b
+}
+
 // getField gets the i'th field of the struct value.
 // If the field is itself is an interface, return a value for
 // the thing inside the interface, not the interface itself.
@@ -338,16 +625,25 @@ func (p *pp) unknownType(v reflect.Value) {
 
 func (p *pp) badVerb(verb rune) {
 	p.erroring = true
+	p.markBad()
 	p.buf.WriteString(percentBangString)
 	p.buf.WriteRune(verb)
 	p.buf.WriteByte('(')
+	if p.debug {
+		p.buf.WriteString("arg#")
+		p.buf.WriteString(strconv.Itoa(p.field + 1))
+		p.buf.WriteByte(' ')
+	}
+	if t, ok := p.arg.(*typed); ok {
+		p.arg = t.value()
+	}
 	switch {
 	case p.arg != nil:
-		p.buf.WriteString(reflect.TypeOf(p.arg).String())
+		p.buf.WriteString(p.typeName(reflect.TypeOf(p.arg)))
 		p.buf.WriteByte('=')
 		p.printArg(p.arg, 'v')
 	case p.value.IsValid():
-		p.buf.WriteString(p.value.Type().String())
+		p.buf.WriteString(p.typeName(p.value.Type()))
 		p.buf.WriteByte('=')
 		p.printValue(p.value, 'v', 0)
 	default:
@@ -357,6 +653,16 @@ func (p *pp) badVerb(verb rune) {
 	p.erroring = false
 }
 
+// typeName returns the name of t for a diagnostic: qualified by the full
+// path of its package when debugging, as in example.com/mypkg.ID, and
+// otherwise by the package name, as in mypkg.ID.
+func (p *pp) typeName(t reflect.Type) string {
+	if p.debug && t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}
+
 func (p *pp) fmtBool(v bool, verb rune) {
 	switch verb {
 	case 't', 'v':
@@ -404,11 +710,42 @@ func (p *pp) fmtInteger(v uint64, isSigned bool, verb rune) {
 		}
 	case 'U':
 		p.fmt.fmtUnicode(v)
+	case 'r':
+		p.fmtRadix(v, isSigned, verb, radixDigits)
+	case 'R':
+		p.fmtRadix(v, isSigned, verb, uradixDigits)
+	case 'h':
+		if isSigned {
+			p.fmt.fmtSI(float64(int64(v)), true)
+		} else {
+			p.fmt.fmtSI(float64(v), true)
+		}
 	default:
 		p.badVerb(verb)
 	}
 }
 
+// fmtRadix formats an integer in the base given by the precision, from 2
+// to 36, or 36 if the precision is absent, as in %.36r or %.*r. Digits
+// beyond 9 are letters, in upper case for %R.
+func (p *pp) fmtRadix(v uint64, isSigned bool, verb rune, digits string) {
+	base := 36
+	if p.fmt.precPresent {
+		base = p.fmt.prec
+	}
+	if base < 2 || base > 36 {
+		p.markBad()
+		p.buf.WriteString(percentBangString)
+		p.buf.WriteRune(verb)
+		p.buf.WriteString(badBaseString)
+		return
+	}
+	prec, sharp := p.fmt.precPresent, p.fmt.sharp
+	p.fmt.precPresent, p.fmt.sharp = false, false
+	p.fmt.fmtInteger(v, base, isSigned, verb, digits)
+	p.fmt.precPresent, p.fmt.sharp = prec, sharp
+}
+
 // fmtFloat formats a float. The default precision for each verb
 // is specified as last argument in the call to fmt_float.
 func (p *pp) fmtFloat(v float64, size int, verb rune) {
@@ -421,6 +758,10 @@ func (p *pp) fmtFloat(v float64, size int, verb rune) {
 		p.fmt.fmtFloat(v, size, verb, 6)
 	case 'F':
 		p.fmt.fmtFloat(v, size, 'f', 6)
+	case 'n', 'N':
+		p.fmt.fmtFloat(v, size, verb, -1)
+	case 'h':
+		p.fmt.fmtSI(v, false)
 	default:
 		p.badVerb(verb)
 	}
@@ -433,7 +774,7 @@ func (p *pp) fmtComplex(v complex128, size int, verb rune) {
 	// Make sure any unsupported verbs are found before the
 	// calls to fmtFloat to not generate an incorrect error string.
 	switch verb {
-	case 'v', 'b', 'g', 'G', 'x', 'X', 'f', 'F', 'e', 'E':
+	case 'v', 'b', 'g', 'G', 'x', 'X', 'f', 'F', 'e', 'E', 'n', 'N':
 		oldPlus := p.fmt.plus
 		p.buf.WriteByte('(')
 		p.fmtFloat(real(v), size/2, verb)
@@ -447,7 +788,26 @@ func (p *pp) fmtComplex(v complex128, size int, verb rune) {
 	}
 }
 
+// badUTF8 reports whether v, a string operand formatted with verb, is
+// invalid UTF-8 rejected by the InvalidStrict policy, and if so writes
+// an error such as %!s(BADUTF8="\xff").
+func (p *pp) badUTF8(v string, verb rune) bool {
+	if p.fmt.cond.Invalid != InvalidStrict || utf8.ValidString(v) {
+		return false
+	}
+	p.markBad()
+	p.buf.WriteString(percentBangString)
+	p.buf.WriteRune(verb)
+	p.buf.WriteString(badUTF8String)
+	p.buf.WriteString(strconv.Quote(v))
+	p.buf.WriteByte(')')
+	return true
+}
+
 func (p *pp) fmtString(v string, verb rune) {
+	if (verb == 's' || verb == 'v' && !p.fmt.sharpV) && p.badUTF8(v, verb) {
+		return
+	}
 	switch verb {
 	case 'v':
 		if p.fmt.sharpV {
@@ -463,6 +823,10 @@ func (p *pp) fmtString(v string, verb rune) {
 		p.fmt.fmtSx(v, udigits)
 	case 'q':
 		p.fmt.fmtQ(v)
+	case 'a':
+		p.fmt.fmtA(v)
+	case 'H':
+		p.fmt.fmtHexdump(v)
 	default:
 		p.badVerb(verb)
 	}
@@ -479,6 +843,9 @@ func (p *pp) fmtBytes(v []byte, verb rune, typeString string) {
 			}
 			p.buf.WriteByte('{')
 			for i, c := range v {
+				if p.full() {
+					break
+				}
 				if i > 0 {
 					p.buf.WriteString(commaSpaceString)
 				}
@@ -488,6 +855,9 @@ func (p *pp) fmtBytes(v []byte, verb rune, typeString string) {
 		} else {
 			p.buf.WriteByte('[')
 			for i, c := range v {
+				if p.full() {
+					break
+				}
 				if i > 0 {
 					p.buf.WriteByte(' ')
 				}
@@ -496,6 +866,9 @@ func (p *pp) fmtBytes(v []byte, verb rune, typeString string) {
 			p.buf.WriteByte(']')
 		}
 	case 's':
+		if p.badUTF8(string(v), verb) {
+			return
+		}
 		p.fmt.fmtBs(v)
 	case 'x':
 		p.fmt.fmtBx(v, ldigits)
@@ -503,6 +876,10 @@ func (p *pp) fmtBytes(v []byte, verb rune, typeString string) {
 		p.fmt.fmtBx(v, udigits)
 	case 'q':
 		p.fmt.fmtQ(string(v))
+	case 'a':
+		p.fmt.fmtA(string(v))
+	case 'H':
+		p.fmt.fmtHexdump(string(v))
 	default:
 		p.printValue(reflect.ValueOf(v), verb, 0)
 	}
@@ -517,6 +894,10 @@ func (p *pp) fmtPointer(value reflect.Value, verb rune) {
 		p.badVerb(verb)
 		return
 	}
+	if p.canonical && u != 0 {
+		// Every non-nil pointer looks the same in a canonical rendering.
+		u = 1
+	}
 
 	switch verb {
 	case 'v':
@@ -566,6 +947,7 @@ func (p *pp) catchPanic(arg interface{}, verb rune, method string) {
 		// For this output we want default behavior.
 		p.fmt.clearflags()
 
+		p.markBad()
 		p.buf.WriteString(percentBangString)
 		p.buf.WriteRune(verb)
 		p.buf.WriteString(panicString)
@@ -574,27 +956,141 @@ func (p *pp) catchPanic(arg interface{}, verb rune, method string) {
 		p.panicking = true
 		p.printArg(err, 'v')
 		p.panicking = false
+		if p.debug {
+			p.writePanicStack()
+		}
 		p.buf.WriteByte(')')
 
 		p.fmt.fmtFlags = oldFlags
 	}
 }
 
+// wfmtPrefix starts the names of the functions of this package.
+var wfmtPrefix = reflect.TypeOf(pp{}).PkgPath() + "."
+
+// writePanicStack writes the stack of the panic being recovered by
+// catchPanic, trimmed to the frames between the panic and the method
+// called by wfmt, each as a function name and a position on lines of
+// their own.
+func (p *pp) writePanicStack() {
+	var pcs [64]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs[:])])
+	inPanic := false
+	for {
+		frame, more := frames.Next()
+		fn := frame.Function
+		switch {
+		case strings.HasPrefix(fn, "runtime."):
+			inPanic = true
+		case !inPanic:
+			// catchPanic and its callers in the runtime.
+		case strings.HasPrefix(fn, wfmtPrefix):
+			// The frame that called the method.
+			return
+		default:
+			p.buf.WriteString("\n\t")
+			p.buf.WriteString(fn)
+			p.buf.WriteString("\n\t\t")
+			p.buf.WriteString(frame.File)
+			p.buf.WriteByte(':')
+			p.buf.WriteString(strconv.Itoa(frame.Line))
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// isFormatter reports whether arg formats itself, implementing either
+// Formatter or the Formatter of package fmt.
+func isFormatter(arg interface{}) bool {
+	switch arg.(type) {
+	case Formatter, stdfmt.Formatter:
+		return true
+	}
+	return false
+}
+
+// fmtText formats the text returned by the method of a TextAppender or
+// encoding.TextMarshaler, or the error it returned.
+func (p *pp) fmtText(text []byte, err error, verb rune, method string) {
+	if err == nil {
+		p.fmt.fmtBs(text)
+		return
+	}
+	p.badOperand(verb, method+" method: "+err.Error())
+}
+
+// badOperand writes an error such as %!j(ERROR=msg) in place of an
+// operand whose text could not be produced.
+func (p *pp) badOperand(verb rune, msg string) {
+	p.markBad()
+	p.buf.WriteString(percentBangString)
+	p.buf.WriteRune(verb)
+	p.buf.WriteString(textErrorString)
+	p.buf.WriteString(msg)
+	p.buf.WriteByte(')')
+}
+
+// fmtJSON formats arg as JSON, indented if the # flag is given, without
+// escaping HTML characters.
+func (p *pp) fmtJSON(arg interface{}) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if p.fmt.sharpV || p.fmt.sharp {
+		enc.SetIndent("", "  ")
+	}
+	err := enc.Encode(arg)
+	p.fmtMarshaled('j', b.Bytes(), err)
+}
+
+// fmtMarshaled formats the encoding of an operand produced for verb,
+// without its trailing newline, or the error that prevented it.
+func (p *pp) fmtMarshaled(verb rune, b []byte, err error) {
+	if err != nil {
+		p.badOperand(verb, err.Error())
+		return
+	}
+	p.fmt.fmtBs(bytes.TrimSuffix(b, []byte{'\n'}))
+}
+
 func (p *pp) handleMethods(verb rune) (handled bool) {
 	if p.erroring {
 		return
 	}
+	if p.canonical {
+		switch p.arg.(type) {
+		case time.Time, *time.Time:
+			p.fmt.fmtS(canonicalTimeString)
+			return true
+		}
+	}
+	if verb == 't' && p.layout != "" {
+		switch t := p.arg.(type) {
+		case time.Time:
+			p.fmt.fmtS(t.Format(p.layout))
+			return true
+		case *time.Time:
+			if t != nil {
+				p.fmt.fmtS(t.Format(p.layout))
+				return true
+			}
+		}
+	}
+	if verb == 'D' {
+		if d, ok := p.arg.(time.Duration); ok {
+			p.fmt.fmtDuration(d)
+			return true
+		}
+	}
 	if verb == 'w' {
-		// It is invalid to use %w other than with Errorf, more than once,
-		// or with a non-error arg.
-		err, ok := p.arg.(error)
-		if !ok || !p.wrapErrs || p.wrappedErr != nil {
-			p.wrappedErr = nil
-			p.wrapErrs = false
+		// It is invalid to use %w other than with Errorf or with a non-error arg.
+		_, ok := p.arg.(error)
+		if !ok || !p.wrapErrs {
 			p.badVerb(verb)
 			return true
 		}
-		p.wrappedErr = err
 		// If the arg is a Formatter, pass 'v' as the verb to it.
 		verb = 'v'
 	}
@@ -603,7 +1099,17 @@ func (p *pp) handleMethods(verb rune) (handled bool) {
 	if formatter, ok := p.arg.(Formatter); ok {
 		handled = true
 		defer p.catchPanic(p.arg, verb, "Format")
+		start := len(p.buf)
+		formatter.Format(p, verb)
+		p.realign(start)
+		return
+	}
+	if formatter, ok := p.arg.(stdfmt.Formatter); ok {
+		handled = true
+		defer p.catchPanic(p.arg, verb, "Format")
+		start := len(p.buf)
 		formatter.Format(p, verb)
+		p.realign(start)
 		return
 	}
 
@@ -639,11 +1145,47 @@ func (p *pp) handleMethods(verb rune) (handled bool) {
 				p.fmtString(v.String(), verb)
 				return
 			}
+			if verb != 'v' && verb != 's' {
+				break
+			}
+			switch v := p.arg.(type) {
+			case TextAppender:
+				handled = true
+				defer p.catchPanic(p.arg, verb, "AppendText")
+				text, err := v.AppendText(nil)
+				p.fmtText(text, err, verb, "AppendText")
+				return
+
+			case encoding.TextMarshaler:
+				handled = true
+				defer p.catchPanic(p.arg, verb, "MarshalText")
+				text, err := v.MarshalText()
+				p.fmtText(text, err, verb, "MarshalText")
+				return
+			}
 		}
 	}
 	return false
 }
 
+// mapEntries returns the entries of the map f, sorted by key unless
+// sorting is turned off. A canonical rendering is always sorted.
+func (p *pp) mapEntries(f reflect.Value) *fmtsort.SortedMap {
+	if !p.unsorted || p.canonical {
+		return fmtsort.Sort(f)
+	}
+	m := &fmtsort.SortedMap{
+		Key:   make([]reflect.Value, 0, f.Len()),
+		Value: make([]reflect.Value, 0, f.Len()),
+	}
+	iter := f.MapRange()
+	for iter.Next() {
+		m.Key = append(m.Key, iter.Key())
+		m.Value = append(m.Value, iter.Value())
+	}
+	return m
+}
+
 func (p *pp) printArg(arg interface{}, verb rune) {
 	p.arg = arg
 	p.value = reflect.Value{}
@@ -652,12 +1194,29 @@ func (p *pp) printArg(arg interface{}, verb rune) {
 		switch verb {
 		case 'T', 'v':
 			p.fmt.padString(nilAngleString)
+		case 'j':
+			p.fmtJSON(nil)
 		default:
+			if m := marshaler(verb); m != nil {
+				b, err := m(nil)
+				p.fmtMarshaled(verb, b, err)
+				return
+			}
 			p.badVerb(verb)
 		}
 		return
 	}
 
+	// A typed operand is boxed only for the verbs that need its type.
+	if t, ok := arg.(*typed); ok {
+		if verb != 'T' && verb != 'p' && verb != 'j' && marshaler(verb) == nil {
+			t.print(p, verb)
+			return
+		}
+		arg = t.value()
+		p.arg = arg
+	}
+
 	// Special processing considerations.
 	// %T (the value's type) and %p (its address) are special; we always do them first.
 	switch verb {
@@ -667,6 +1226,17 @@ func (p *pp) printArg(arg interface{}, verb rune) {
 	case 'p':
 		p.fmtPointer(reflect.ValueOf(arg), 'p')
 		return
+	case 'j':
+		if !isFormatter(arg) {
+			p.fmtJSON(arg)
+			return
+		}
+	default:
+		if m := marshaler(verb); m != nil && !isFormatter(arg) {
+			b, err := m(arg)
+			p.fmtMarshaled(verb, b, err)
+			return
+		}
 	}
 
 	// Some types can be done without reflection.
@@ -718,6 +1288,9 @@ func (p *pp) printArg(arg interface{}, verb rune) {
 		}
 		p.printValue(f, verb, 0)
 	default:
+		if p.printCommon(f, verb) {
+			return
+		}
 		// If the type is not simple, it might have methods.
 		if !p.handleMethods(verb) {
 			// Need to use reflection, since the type had no
@@ -775,50 +1348,79 @@ func (p *pp) printValue(value reflect.Value, verb rune, depth int) {
 				p.buf.WriteString(nilParenString)
 				return
 			}
-			p.buf.WriteByte('{')
+			p.openBlock()
 		} else {
 			p.buf.WriteString(mapString)
 		}
-		sorted := fmtsort.Sort(f)
+		if !p.enter(f.Len()) {
+			if p.fmt.sharpV {
+				p.closeBlock(0)
+			} else {
+				p.buf.WriteByte(']')
+			}
+			return
+		}
+		sorted := p.mapEntries(f)
 		for i, key := range sorted.Key {
-			if i > 0 {
-				if p.fmt.sharpV {
-					p.buf.WriteString(commaSpaceString)
-				} else {
-					p.buf.WriteByte(' ')
-				}
+			if p.full() {
+				break
+			}
+			if p.fmt.sharpV {
+				p.nextElement(i)
+			} else if i > 0 {
+				p.buf.WriteByte(' ')
 			}
 			p.printValue(key, verb, depth+1)
 			p.buf.WriteByte(':')
+			if p.pretty() {
+				p.buf.WriteByte(' ')
+			}
 			p.printValue(sorted.Value[i], verb, depth+1)
 		}
+		p.nest--
 		if p.fmt.sharpV {
-			p.buf.WriteByte('}')
+			p.closeBlock(len(sorted.Key))
 		} else {
 			p.buf.WriteByte(']')
 		}
 	case reflect.Struct:
 		if p.fmt.sharpV {
 			p.buf.WriteString(f.Type().String())
+			p.openBlock()
+		} else {
+			p.buf.WriteByte('{')
+		}
+		if !p.enter(f.NumField()) {
+			if p.fmt.sharpV {
+				p.closeBlock(0)
+			} else {
+				p.buf.WriteByte('}')
+			}
+			return
 		}
-		p.buf.WriteByte('{')
 		for i := 0; i < f.NumField(); i++ {
-			if i > 0 {
-				if p.fmt.sharpV {
-					p.buf.WriteString(commaSpaceString)
-				} else {
-					p.buf.WriteByte(' ')
-				}
+			if p.fmt.sharpV {
+				p.nextElement(i)
+			} else if i > 0 {
+				p.buf.WriteByte(' ')
 			}
 			if p.fmt.plusV || p.fmt.sharpV {
 				if name := f.Type().Field(i).Name; name != "" {
 					p.buf.WriteString(name)
 					p.buf.WriteByte(':')
+					if p.pretty() {
+						p.buf.WriteByte(' ')
+					}
 				}
 			}
 			p.printValue(getField(f, i), verb, depth+1)
 		}
-		p.buf.WriteByte('}')
+		p.nest--
+		if p.fmt.sharpV {
+			p.closeBlock(f.NumField())
+		} else {
+			p.buf.WriteByte('}')
+		}
 	case reflect.Interface:
 		value := f.Elem()
 		if !value.IsValid() {
@@ -833,7 +1435,7 @@ func (p *pp) printValue(value reflect.Value, verb rune, depth int) {
 		}
 	case reflect.Array, reflect.Slice:
 		switch verb {
-		case 's', 'q', 'x', 'X':
+		case 's', 'q', 'x', 'X', 'H':
 			// Handle byte and uint8 slices and arrays special for the above verbs.
 			t := f.Type()
 			if t.Elem().Kind() == reflect.Uint8 {
@@ -861,22 +1463,30 @@ func (p *pp) printValue(value reflect.Value, verb rune, depth int) {
 				p.buf.WriteString(nilParenString)
 				return
 			}
-			p.buf.WriteByte('{')
-			for i := 0; i < f.Len(); i++ {
-				if i > 0 {
-					p.buf.WriteString(commaSpaceString)
-				}
+			p.openBlock()
+			if !p.enter(f.Len()) {
+				p.closeBlock(0)
+				return
+			}
+			for i := 0; i < f.Len() && !p.full(); i++ {
+				p.nextElement(i)
 				p.printValue(f.Index(i), verb, depth+1)
 			}
-			p.buf.WriteByte('}')
+			p.nest--
+			p.closeBlock(f.Len())
 		} else {
 			p.buf.WriteByte('[')
-			for i := 0; i < f.Len(); i++ {
+			if !p.enter(f.Len()) {
+				p.buf.WriteByte(']')
+				return
+			}
+			for i := 0; i < f.Len() && !p.full(); i++ {
 				if i > 0 {
 					p.buf.WriteByte(' ')
 				}
 				p.printValue(f.Index(i), verb, depth+1)
 			}
+			p.nest--
 			p.buf.WriteByte(']')
 		}
 	case reflect.Ptr:
@@ -898,6 +1508,78 @@ func (p *pp) printValue(value reflect.Value, verb rune, depth int) {
 	}
 }
 
+// enter starts printing the n elements of a composite value. If they are
+// nested deeper than the maximum depth, it writes an ellipsis in their
+// place and reports false; otherwise the nesting level is to be
+// decremented after them.
+func (p *pp) enter(n int) bool {
+	if p.maxDepth > 0 && p.nest >= p.maxDepth && n > 0 {
+		mark := p.fmt.cond.Ellipsis
+		if mark == "" {
+			mark = ellipsis
+		}
+		p.buf.WriteString(mark)
+		return false
+	}
+	p.nest++
+	return true
+}
+
+// full reports whether buf is longer than the output is allowed to be,
+// so that the rest of a composite value can be skipped.
+func (p *pp) full() bool {
+	return p.maxBytes > 0 && len(p.buf) > p.maxBytes
+}
+
+// pretty reports whether composite values are printed across multiple
+// lines, as they are by %#v under a Printer with an Indent.
+func (p *pp) pretty() bool {
+	return p.fmt.sharpV && p.indentString != ""
+}
+
+// openBlock writes the opening brace of the elements of a composite
+// value printed in Go syntax.
+func (p *pp) openBlock() {
+	p.buf.WriteByte('{')
+	p.indent++
+}
+
+// nextElement writes what precedes the ith element of a composite value
+// printed in Go syntax: a comma after the previous element and, if
+// pretty, a newline and the indentation.
+func (p *pp) nextElement(i int) {
+	if !p.pretty() {
+		if i > 0 {
+			p.buf.WriteString(commaSpaceString)
+		}
+		return
+	}
+	if i > 0 {
+		p.buf.WriteByte(',')
+	}
+	p.newline(p.indent)
+}
+
+// closeBlock writes the closing brace of a composite value of n elements
+// printed in Go syntax. If pretty, the last of the elements is followed
+// by a comma and the brace is on a line of its own, as in gofmt output.
+func (p *pp) closeBlock(n int) {
+	p.indent--
+	if p.pretty() && n > 0 {
+		p.buf.WriteByte(',')
+		p.newline(p.indent)
+	}
+	p.buf.WriteByte('}')
+}
+
+// newline writes a newline followed by depth indents.
+func (p *pp) newline(depth int) {
+	p.buf.WriteByte('\n')
+	for ; depth > 0; depth-- {
+		p.buf.WriteString(p.indentString)
+	}
+}
+
 // intFromArg gets the argNumth element of a. On return, isInt reports whether the argument has integer type.
 func intFromArg(a []interface{}, argNum int) (num int, isInt bool, newArgNum int) {
 	newArgNum = argNum
@@ -972,18 +1654,53 @@ func (p *pp) argNumber(argNum int, format string, i int, numArgs int) (newArgNum
 	return argNum, i + wid, ok
 }
 
+// markBad records that a formatting error is about to be written.
+func (p *pp) markBad() {
+	if p.badAt < 0 {
+		p.badAt = len(p.buf)
+	}
+}
+
 func (p *pp) badArgNum(verb rune) {
+	p.markBad()
 	p.buf.WriteString(percentBangString)
 	p.buf.WriteRune(verb)
 	p.buf.WriteString(badIndexString)
 }
 
+func (p *pp) badLayout(verb rune) {
+	p.markBad()
+	p.buf.WriteString(percentBangString)
+	p.buf.WriteRune(verb)
+	p.buf.WriteString(badLayoutString)
+}
+
 func (p *pp) missingArg(verb rune) {
+	p.markBad()
 	p.buf.WriteString(percentBangString)
 	p.buf.WriteRune(verb)
 	p.buf.WriteString(missingString)
 }
 
+// printField is like printArg for the operand with index argNum,
+// recording its position when annotating.
+func (p *pp) printField(arg interface{}, argNum int, verb rune) {
+	p.field = argNum
+	p.indent, p.nest = 0, 0
+	if p.redact != nil {
+		if v, ok := p.redact(arg); ok {
+			arg = v
+		}
+	}
+	if !p.annotate {
+		p.printArg(arg, verb)
+		return
+	}
+	start := len(p.buf)
+	p.printArg(arg, verb)
+	p.spans = append(p.spans, fieldSpan{arg: argNum, verb: verb, start: start, end: len(p.buf)})
+}
+
 func (p *pp) doPrintf(format string, a []interface{}) {
 	end := len(format)
 	argNum := 0         // we process one argument per non-trivial format
@@ -1016,7 +1733,7 @@ formatLoop:
 			case '#':
 				p.fmt.sharp = true
 			case '0':
-				p.fmt.zero = !p.fmt.minus // Only allow zero padding to the left.
+				p.fmt.zero = !p.fmt.minus && !p.fmt.center && p.fmt.fill == 0 // Only allow zero padding to the left.
 			case '+':
 				p.fmt.plus = true
 			case '-':
@@ -1024,11 +1741,39 @@ formatLoop:
 				p.fmt.zero = false // Do not pad with zeros to the right.
 			case ' ':
 				p.fmt.space = true
+			case '=':
+				p.fmt.unit = UnitBytes
+			case '~':
+				p.fmt.unit = UnitRunes
+			case '|':
+				p.fmt.unit = UnitColumns
+			case '^':
+				p.fmt.center = true
+				p.fmt.zero = false // Do not pad with zeros to the right.
+			case '>':
+				p.fmt.ellipsis = true
+			case ',':
+				p.fmt.group = true
+			case '_':
+				p.fmt.underscore = true
+			case '\'':
+				// The rune after the quote is the pad rune.
+				if i+1 >= end {
+					break simpleFormat
+				}
+				r, size := utf8.DecodeRuneInString(format[i+1:])
+				p.fmt.fill = r
+				p.fmt.zero = false
+				i += size
 			default:
 				// Fast path for common case of ascii lower case simple verbs
 				// without precision or width or argument indices.
 				if 'a' <= c && c <= 'z' && argNum < len(a) {
-					if c == 'v' {
+					switch c {
+					case 'w':
+						p.wrappedErrs = append(p.wrappedErrs, argNum)
+						fallthrough
+					case 'v':
 						// Go syntax
 						p.fmt.sharpV = p.fmt.sharp
 						p.fmt.sharp = false
@@ -1036,7 +1781,7 @@ formatLoop:
 						p.fmt.plusV = p.fmt.plus
 						p.fmt.plus = false
 					}
-					p.printArg(a[argNum], rune(c))
+					p.printField(a[argNum], argNum, rune(c))
 					argNum++
 					i++
 					continue formatLoop
@@ -1055,6 +1800,7 @@ formatLoop:
 			p.fmt.wid, p.fmt.widPresent, argNum = intFromArg(a, argNum)
 
 			if !p.fmt.widPresent {
+				p.markBad()
 				p.buf.WriteString(badWidthString)
 			}
 
@@ -1089,6 +1835,7 @@ formatLoop:
 					p.fmt.precPresent = false
 				}
 				if !p.fmt.precPresent {
+					p.markBad()
 					p.buf.WriteString(badPrecString)
 				}
 				afterIndex = false
@@ -1105,7 +1852,18 @@ formatLoop:
 			argNum, i, afterIndex = p.argNumber(argNum, format, i, len(a))
 		}
 
+		// Do we have a time layout?
+		hasLayout := false
+		if i < end && format[i] == '{' {
+			if j := strings.IndexByte(format[i:], '}'); j >= 0 {
+				p.layout = format[i+1 : i+j]
+				hasLayout = true
+				i += j + 1
+			}
+		}
+
 		if i >= end {
+			p.markBad()
 			p.buf.WriteString(noVerbString)
 			break
 		}
@@ -1123,6 +1881,12 @@ formatLoop:
 			p.badArgNum(verb)
 		case argNum >= len(a): // No argument left over to print for the current verb.
 			p.missingArg(verb)
+		case hasLayout && verb != 't': // Only times take a layout.
+			p.badLayout(verb)
+			argNum++
+		case verb == 'w':
+			p.wrappedErrs = append(p.wrappedErrs, argNum)
+			fallthrough
 		case verb == 'v':
 			// Go syntax
 			p.fmt.sharpV = p.fmt.sharp
@@ -1132,31 +1896,38 @@ formatLoop:
 			p.fmt.plus = false
 			fallthrough
 		default:
-			p.printArg(a[argNum], verb)
+			p.printField(a[argNum], argNum, verb)
 			argNum++
 		}
+		p.layout = ""
 	}
 
 	// Check for extra arguments unless the call accessed the arguments
 	// out of order, in which case it's too expensive to detect if they've all
 	// been used and arguably OK if they're not.
 	if !p.reordered && argNum < len(a) {
-		p.fmt.clearflags()
-		p.buf.WriteString(extraString)
-		for i, arg := range a[argNum:] {
-			if i > 0 {
-				p.buf.WriteString(commaSpaceString)
-			}
-			if arg == nil {
-				p.buf.WriteString(nilAngleString)
-			} else {
-				p.buf.WriteString(reflect.TypeOf(arg).String())
-				p.buf.WriteByte('=')
-				p.printArg(arg, 'v')
-			}
+		p.extraArgs(a[argNum:])
+	}
+}
+
+// extraArgs reports the operands a left over by a format.
+func (p *pp) extraArgs(a []interface{}) {
+	p.fmt.clearflags()
+	p.markBad()
+	p.buf.WriteString(extraString)
+	for i, arg := range a {
+		if i > 0 {
+			p.buf.WriteString(commaSpaceString)
+		}
+		if arg == nil {
+			p.buf.WriteString(nilAngleString)
+		} else {
+			p.buf.WriteString(reflect.TypeOf(arg).String())
+			p.buf.WriteByte('=')
+			p.printArg(arg, 'v')
 		}
-		p.buf.WriteByte(')')
 	}
+	p.buf.WriteByte(')')
 }
 
 func (p *pp) doPrint(a []interface{}) {
@@ -1167,7 +1938,7 @@ func (p *pp) doPrint(a []interface{}) {
 		if argNum > 0 && !isString && !prevString {
 			p.buf.WriteByte(' ')
 		}
-		p.printArg(arg, 'v')
+		p.printField(arg, argNum, 'v')
 		prevString = isString
 	}
 }
@@ -1179,7 +1950,7 @@ func (p *pp) doPrintln(a []interface{}) {
 		if argNum > 0 {
 			p.buf.WriteByte(' ')
 		}
-		p.printArg(arg, 'v')
+		p.printField(arg, argNum, 'v')
 	}
 	p.buf.WriteByte('\n')
 }
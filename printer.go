@@ -0,0 +1,343 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"io"
+	"os"
+)
+
+// WrapTerminal, used as Printer.Wrap, wraps output at the width of the
+// terminal: $COLUMNS if it is set, otherwise the width of the terminal
+// written to. Output to anything but a terminal is not wrapped unless
+// $COLUMNS is set.
+const WrapTerminal = -1
+
+// A Printer formats like the package-level print functions, with its own
+// Condition and output options. The zero Printer behaves like the
+// package-level functions.
+type Printer struct {
+	// Condition measures text; DefaultCondition if nil.
+	Condition *Condition
+	// Wrap, if positive, is the width in cells at which output is
+	// soft-wrapped, breaking lines at spaces and around wide characters
+	// but never within a grapheme cluster. See also WrapTerminal.
+	Wrap int
+	// Accessible makes output friendlier to screen readers: box drawing
+	// and leader characters are replaced with plain punctuation, and
+	// padding and rules are collapsed, with long runs of a fill
+	// character written as a count. See also Linearize.
+	Accessible bool
+	// Annotations, if not nil, receives a JSON sidecar for each call
+	// describing where each operand was rendered; see FieldLayout.
+	Annotations io.Writer
+	// UnsortedMaps prints the entries of maps in iteration order, which
+	// varies from one call to the next, rather than sorted by key. It
+	// saves the cost of sorting large maps in hot paths such as logging
+	// where a stable order does not matter.
+	UnsortedMaps bool
+	// Debug makes the diagnostics printed for bad verbs name the operand
+	// by its index, counting from 1, and its type by the full path of its
+	// package, as in %!d(arg#3 example.com/mypkg.ID=abc), so that a bad
+	// verb is easy to locate in a long format. It also appends to the
+	// diagnostic printed for a panic in a String, Format, Error or other
+	// method the stack of the panic, from the panicking function up to
+	// the method called by wfmt, one function and position per line, so
+	// that the faulty method can be found.
+	Debug bool
+	// GroupSeparator separates the thousands of numbers printed with the
+	// , flag, as in %,d; "," if empty. DecimalSeparator replaces their
+	// decimal point; "." if empty. A locale writing 1.234.567,89 sets
+	// them to "." and ",".
+	GroupSeparator   string
+	DecimalSeparator string
+	// Indent, if not empty, makes %#v print composite values across
+	// multiple lines, one element or field per line, indented by Indent
+	// for each level of nesting and laid out as gofmt would, as in
+	//
+	//	pr := wfmt.Printer{Indent: "\t"}
+	//	pr.Printf("%#v", deeplyNestedConfig)
+	Indent string
+	// Redact, if not nil, is called with each operand before it is
+	// formatted and, if it reports true, the value it returns is
+	// formatted instead, so that secrets and personal data can be masked
+	// wherever they are printed, as in
+	//
+	//	pr.Redact = func(arg interface{}) (interface{}, bool) {
+	//		if _, ok := arg.(Password); ok {
+	//			return "****", true
+	//		}
+	//		return nil, false
+	//	}
+	//
+	// Operands supplying a width or precision with * are not passed to
+	// Redact.
+	Redact func(arg interface{}) (interface{}, bool)
+	// MaxBytes, if positive, caps the length of the output of each call,
+	// so that a huge value passed by mistake cannot produce megabytes of
+	// text. Longer output is cut between grapheme clusters and marked
+	// with the Ellipsis of the Condition, before it is wrapped or
+	// post-processed; styles left open are closed, which may add a few
+	// bytes. Elements of slices, arrays and maps beyond the cap are not
+	// formatted at all.
+	MaxBytes int
+	// MaxDepth, if positive, is the number of levels of nested structs,
+	// maps, slices and arrays printed; the elements of those nested more
+	// deeply are elided, as in {a […] {…}} for a MaxDepth of 1, and not
+	// formatted at all.
+	MaxDepth int
+	// Pool, if not nil, supplies the buffers output is formatted in,
+	// instead of the pool shared by the package; NoPool allocates a
+	// buffer for each call. Output is copied or written out of the buffer
+	// before it is returned to Pool.
+	Pool BufferPool
+
+	post []func([]byte) []byte
+}
+
+// AddPostProcessor adds f to the processors applied to the output of each
+// call of pr, after it is wrapped and rewritten for accessibility and
+// before it is written or returned, for uses such as adding timestamps,
+// scrubbing secrets or transcoding. Processors run in the order they
+// were added, each receiving the output of the one before.
+//
+// The slice f receives is a pooled buffer owned by pr: f may modify it
+// in place or append to it, and returns the output to pass on, but must
+// not retain the slice after it returns. The slice returned is reused as
+// the buffer of later calls, so it must not be shared either.
+// AddPostProcessor must not be called concurrently with printing.
+func (pr *Printer) AddPostProcessor(f func([]byte) []byte) {
+	pr.post = append(pr.post, f)
+}
+
+func (pr *Printer) cond() *Condition {
+	if pr.Condition != nil {
+		return pr.Condition
+	}
+	return DefaultCondition
+}
+
+// newPrinter returns a pp using the Condition of pr.
+func (pr *Printer) newPrinter() *pp {
+	p := newPrinter()
+	p.fmt.init(&p.buf, pr.cond())
+	p.annotate = pr.Annotations != nil
+	p.unsorted = pr.UnsortedMaps
+	p.debug = pr.Debug
+	p.fmt.groupSep, p.fmt.decimalSep = pr.GroupSeparator, pr.DecimalSeparator
+	p.indentString = pr.Indent
+	p.redact = pr.Redact
+	p.maxBytes = pr.MaxBytes
+	p.maxDepth = pr.MaxDepth
+	if pr.Pool != nil {
+		p.usePool(pr.Pool)
+	}
+	return p
+}
+
+// output returns the formatted text in p as it is to be written to w,
+// which is nil for the Sprint functions. The result is valid until p is
+// freed.
+func (pr *Printer) output(p *pp, w io.Writer) []byte {
+	width := pr.Wrap
+	if width == WrapTerminal {
+		width = wrapWidth(w)
+	}
+	if pr.MaxBytes > 0 && len(p.buf) > pr.MaxBytes {
+		tail := pr.cond().Ellipsis
+		if tail == "" {
+			tail = ellipsis
+		}
+		p.buf = append(p.buf[:0], pr.cond().cutBytes(string(p.buf), pr.MaxBytes, tail)...)
+	}
+	if pr.Annotations != nil {
+		pr.writeAnnotations(p)
+	}
+	b := []byte(p.buf)
+	if pr.Accessible || width > 0 {
+		s := string(b)
+		if pr.Accessible {
+			s = pr.cond().accessible(s)
+		}
+		b = append(b[:0], pr.cond().Wrap(s, width)...)
+	}
+	for _, f := range pr.post {
+		b = f(b)
+	}
+	// Keep the buffer, which a processor may have grown, for reuse.
+	p.buf = b
+	return b
+}
+
+// cutBytes returns s cut between grapheme clusters to at most n bytes,
+// including tail, which is appended, and the sequences closing the
+// styles left open.
+func (c *Condition) cutBytes(s string, n int, tail string) string {
+	if n -= len(tail); n < 0 {
+		n, tail = 0, ""
+	}
+	var st styleState
+	end := 0
+	for g := c.Graphemes(s); g.Next(); {
+		start, stop := g.Positions()
+		if stop > n {
+			end = start
+			break
+		}
+		if g.IsSequence() {
+			st.update(g.Str())
+		}
+	}
+	if c.StyledTail {
+		return s[:end] + tail + st.close()
+	}
+	return s[:end] + st.close() + tail
+}
+
+// Fprintf formats according to a format specifier and writes to w.
+// It returns the number of bytes written and any write error encountered.
+func (pr *Printer) Fprintf(w io.Writer, format string, a ...interface{}) (n int, err error) {
+	p := pr.newPrinter()
+	if pr.streams() {
+		p.stream(w)
+	}
+	p.doPrintf(format, a)
+	n, err = p.writeOut(w, pr.output(p, w))
+	p.free()
+	return
+}
+
+// Printf formats according to a format specifier and writes to standard output.
+// It returns the number of bytes written and any write error encountered.
+func (pr *Printer) Printf(format string, a ...interface{}) (n int, err error) {
+	return pr.Fprintf(os.Stdout, format, a...)
+}
+
+// Sprintf formats according to a format specifier and returns the resulting string.
+func (pr *Printer) Sprintf(format string, a ...interface{}) string {
+	p := pr.newPrinter()
+	p.doPrintf(format, a)
+	s := string(pr.output(p, nil))
+	p.free()
+	return s
+}
+
+// Appendf formats according to a format specifier, appends the result to the byte
+// slice, and returns the updated slice.
+func (pr *Printer) Appendf(b []byte, format string, a ...interface{}) []byte {
+	p := pr.newPrinter()
+	p.doPrintf(format, a)
+	b = append(b, pr.output(p, nil)...)
+	p.free()
+	return b
+}
+
+// Bprintf formats according to a format specifier and writes the result
+// to buf without growing it. It returns the number of bytes written, or
+// 0 and ErrTooLong if the output does not fit.
+func (pr *Printer) Bprintf(buf []byte, format string, a ...interface{}) (n int, err error) {
+	p := pr.newPrinter()
+	p.doPrintf(format, a)
+	n, err = bcopy(buf, pr.output(p, nil))
+	p.free()
+	return
+}
+
+// Fprint formats using the default formats for its operands and writes to w.
+// Spaces are added between operands when neither is a string.
+// It returns the number of bytes written and any write error encountered.
+func (pr *Printer) Fprint(w io.Writer, a ...interface{}) (n int, err error) {
+	p := pr.newPrinter()
+	if pr.streams() {
+		p.stream(w)
+	}
+	p.doPrint(a)
+	n, err = p.writeOut(w, pr.output(p, w))
+	p.free()
+	return
+}
+
+// Print formats using the default formats for its operands and writes to standard output.
+// Spaces are added between operands when neither is a string.
+// It returns the number of bytes written and any write error encountered.
+func (pr *Printer) Print(a ...interface{}) (n int, err error) {
+	return pr.Fprint(os.Stdout, a...)
+}
+
+// Sprint formats using the default formats for its operands and returns the resulting string.
+// Spaces are added between operands when neither is a string.
+func (pr *Printer) Sprint(a ...interface{}) string {
+	p := pr.newPrinter()
+	p.doPrint(a)
+	s := string(pr.output(p, nil))
+	p.free()
+	return s
+}
+
+// Append formats using the default formats for its operands, appends the result to
+// the byte slice, and returns the updated slice.
+func (pr *Printer) Append(b []byte, a ...interface{}) []byte {
+	p := pr.newPrinter()
+	p.doPrint(a)
+	b = append(b, pr.output(p, nil)...)
+	p.free()
+	return b
+}
+
+// Fprintln formats using the default formats for its operands and writes to w.
+// Spaces are always added between operands and a newline is appended.
+// It returns the number of bytes written and any write error encountered.
+func (pr *Printer) Fprintln(w io.Writer, a ...interface{}) (n int, err error) {
+	p := pr.newPrinter()
+	if pr.streams() {
+		p.stream(w)
+	}
+	p.doPrintln(a)
+	n, err = p.writeOut(w, pr.output(p, w))
+	p.free()
+	return
+}
+
+// Println formats using the default formats for its operands and writes to standard output.
+// Spaces are always added between operands and a newline is appended.
+// It returns the number of bytes written and any write error encountered.
+func (pr *Printer) Println(a ...interface{}) (n int, err error) {
+	return pr.Fprintln(os.Stdout, a...)
+}
+
+// Sprintln formats using the default formats for its operands and returns the resulting string.
+// Spaces are always added between operands and a newline is appended.
+func (pr *Printer) Sprintln(a ...interface{}) string {
+	p := pr.newPrinter()
+	p.doPrintln(a)
+	s := string(pr.output(p, nil))
+	p.free()
+	return s
+}
+
+// Appendln formats using the default formats for its operands, appends the result
+// to the byte slice, and returns the updated slice. Spaces are always added
+// between operands and a newline is appended.
+func (pr *Printer) Appendln(b []byte, a ...interface{}) []byte {
+	p := pr.newPrinter()
+	p.doPrintln(a)
+	b = append(b, pr.output(p, nil)...)
+	p.free()
+	return b
+}
+
+// FprintfWrap formats according to a format specifier and writes to w,
+// soft-wrapping the output at the width of the terminal as described
+// for WrapTerminal.
+// It returns the number of bytes written and any write error encountered.
+func FprintfWrap(w io.Writer, format string, a ...interface{}) (n int, err error) {
+	pr := Printer{Wrap: WrapTerminal}
+	return pr.Fprintf(w, format, a...)
+}
+
+// PrintfWrap is like FprintfWrap but writes to standard output.
+func PrintfWrap(format string, a ...interface{}) (n int, err error) {
+	return FprintfWrap(os.Stdout, format, a...)
+}
@@ -0,0 +1,537 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+var wrapTests = []struct {
+	width int
+	in    string
+	out   string
+}{
+	{0, "the quick brown fox", "the quick brown fox"},
+	{10, "the quick brown fox", "the quick\nbrown fox"},
+	{9, "the quick brown fox", "the quick\nbrown fox"},
+	{5, "the quick brown fox", "the\nquick\nbrown\nfox"},
+	{4, "abcdefghij", "abcd\nefgh\nij"},
+	{10, "日本語のテキストを折り返す", "日本語のテ\nキストを折\nり返す"},
+	{9, "日本語のテキスト", "日本語の\nテキスト"},
+	{8, "help: 日本語の説明", "help: 日\n本語の説\n明"},
+	{3, "éééé", "ééé\né"},
+	{3, "ab👍🏽c", "ab\n👍🏽c"},
+	{5, "\x1b[1mbold\x1b[0m text", "\x1b[1mbold\x1b[0m\ntext"},
+	{10, "one\ntwo three four", "one\ntwo three\nfour"},
+	{6, "a  b  c  d", "a  b\nc  d"},
+}
+
+func TestPrinterWrap(t *testing.T) {
+	for _, tt := range wrapTests {
+		pr := Printer{Condition: &Condition{}, Wrap: tt.width}
+		if s := pr.Sprint(tt.in); s != tt.out {
+			t.Errorf("Wrap %d: Sprint(%+q) = %+q want %+q", tt.width, tt.in, s, tt.out)
+		}
+	}
+}
+
+func TestPrinterCondition(t *testing.T) {
+	pr := Printer{Condition: &Condition{EastAsian: true}}
+	if s := pr.Sprintf("[%4s]", "αβ"); s != "[αβ]" {
+		t.Errorf("EastAsian Sprintf = %q want %q", s, "[αβ]")
+	}
+	pr.Condition.EastAsian = false
+	if s := pr.Sprintf("[%4s]", "αβ"); s != "[  αβ]" {
+		t.Errorf("Sprintf = %q want %q", s, "[  αβ]")
+	}
+}
+
+func TestFprintfWrapColumns(t *testing.T) {
+	defer os.Setenv("COLUMNS", os.Getenv("COLUMNS"))
+	os.Setenv("COLUMNS", "8")
+	var b strings.Builder
+	FprintfWrap(&b, "%s %s", "wrapped", "text")
+	if got, want := b.String(), "wrapped\ntext"; got != want {
+		t.Errorf("FprintfWrap = %q want %q", got, want)
+	}
+	os.Unsetenv("COLUMNS")
+	b.Reset()
+	FprintfWrap(&b, "%s %s", "wrapped", "text")
+	if got, want := b.String(), "wrapped text"; got != want {
+		t.Errorf("FprintfWrap to non-terminal = %q want %q", got, want)
+	}
+}
+
+var accessibleTests = []struct {
+	format string
+	args   []interface{}
+	out    string
+}{
+	{"%-10s %8s", []interface{}{"Coffee", "4.50"}, "Coffee 4.50"},
+	{"Coffee ........ %s", []interface{}{"4.50"}, "Coffee .×8 4.50"},
+	{"┌──────┐\n│%-6s│\n└──────┘", []interface{}{"合計"}, "+-×6+\n|合計 |\n+-×6+"},
+	{"a...b…", nil, "a...b..."},
+	{"%s", []interface{}{"\x1b[1m====\x1b[0m"}, "\x1b[1m=×4\x1b[0m"},
+	{"名前　　　山田", nil, "名前 山田"},
+}
+
+func TestPrinterAccessible(t *testing.T) {
+	pr := Printer{Condition: &Condition{}, Accessible: true}
+	for _, tt := range accessibleTests {
+		if s := pr.Sprintf(tt.format, tt.args...); s != tt.out {
+			t.Errorf("Sprintf(%q, %q) = %q want %q", tt.format, tt.args, s, tt.out)
+		}
+	}
+}
+
+func TestLinearize(t *testing.T) {
+	got := Linearize([]string{"Name", "Qty"}, [][]string{{"りんご", "3", "extra"}, {"", "5"}})
+	want := "Name: りんご\nQty: 3\nColumn 3: extra\n\nQty: 5\n"
+	if got != want {
+		t.Errorf("Linearize = %q want %q", got, want)
+	}
+}
+
+func TestPrinterLayoutf(t *testing.T) {
+	pr := Printer{Condition: &Condition{}}
+	s, fields := pr.Layoutf("%-6s|%4d\n[%s]", "名前", 42, "x")
+	if want := "名前  |  42\n[x]"; s != want {
+		t.Errorf("Layoutf = %q want %q", s, want)
+	}
+	want := []FieldLayout{
+		{Arg: 0, Verb: "s", Line: 0, Column: 0, Width: 6, Text: "名前  "},
+		{Arg: 1, Verb: "d", Line: 0, Column: 7, Width: 4, Text: "  42"},
+		{Arg: 2, Verb: "s", Line: 1, Column: 1, Width: 1, Text: "x"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("Layoutf fields = %+v want %+v", fields, want)
+	}
+}
+
+func TestPrinterAnnotations(t *testing.T) {
+	var out, sidecar strings.Builder
+	pr := Printer{Condition: &Condition{}, Annotations: &sidecar}
+	pr.Fprintln(&out, "a", 12)
+	if got, want := out.String(), "a 12\n"; got != want {
+		t.Errorf("output = %q want %q", got, want)
+	}
+	want := `[{"arg":0,"verb":"v","line":0,"column":0,"width":1,"text":"a"},` +
+		`{"arg":1,"verb":"v","line":0,"column":2,"width":2,"text":"12"}]` + "\n"
+	if got := sidecar.String(); got != want {
+		t.Errorf("annotations = %s want %s", got, want)
+	}
+}
+
+func TestPrinterFeatures(t *testing.T) {
+	pr := Printer{Condition: &Condition{TabStops: true}, Wrap: 40}
+	fs := pr.Features()
+	if !fs.Has(FeatureDisplayWidth|FeatureTabStops|FeatureWrap) || fs.Has(FeatureEastAsian) {
+		t.Errorf("Features() = %v", fs)
+	}
+	if err := pr.Require(FeatureWrap | FeatureTabStops); err != nil {
+		t.Errorf("Require = %v", err)
+	}
+	err := pr.Require(FeatureEastAsian | FeatureAccessible | FeatureWrap)
+	if e, ok := err.(*FeatureError); !ok || e.Missing != FeatureEastAsian|FeatureAccessible {
+		t.Errorf("Require = %v want missing east-asian,accessible", err)
+	} else if got, want := e.Error(), "wfmt: features not enabled: east-asian,accessible"; got != want {
+		t.Errorf("Error() = %q want %q", got, want)
+	}
+	if !SupportedFeatures().Has(fs) {
+		t.Errorf("SupportedFeatures() = %v lacks %v", SupportedFeatures(), fs)
+	}
+}
+
+func TestParseFeatures(t *testing.T) {
+	fs, err := ParseFeatures("width, wrap")
+	if err != nil || fs != FeatureDisplayWidth|FeatureWrap {
+		t.Errorf("ParseFeatures = %v, %v", fs, err)
+	}
+	if got, err := ParseFeatures(fs.String()); err != nil || got != fs {
+		t.Errorf("ParseFeatures(%q) = %v, %v", fs.String(), got, err)
+	}
+	if _, err := ParseFeatures("width,hologram"); err == nil {
+		t.Error("ParseFeatures accepted an unknown feature")
+	}
+}
+
+var measureTests = []struct {
+	format string
+	arg    interface{}
+	cols   int
+	err    string
+}{
+	{"%-10s|", "日本", 11, ""},
+	{"%s", "一行\n第二行です", 10, ""},
+	{"\x1b[1m%s\x1b[0m", "ok", 2, ""},
+	{"%d", "hi", 14, `wfmt: bad format: "%!d(string=hi)"`},
+	{"%s %s", "a", 14, `wfmt: bad format: "%!s(MISSING)"`},
+}
+
+func TestMeasure(t *testing.T) {
+	for _, tt := range measureTests {
+		cols, err := Measure(tt.format, tt.arg)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if cols != tt.cols || errStr != tt.err {
+			t.Errorf("Measure(%q, %q) = %d, %q want %d, %q", tt.format, tt.arg, cols, errStr, tt.cols, tt.err)
+		}
+	}
+}
+
+func TestMeasureAllocs(t *testing.T) {
+	n := testing.AllocsPerRun(100, func() {
+		Measure("%-10s|%s", "日本", "\x1b[1mok\x1b[0m")
+	})
+	if n > 0 {
+		t.Errorf("Measure allocates %v times per call", n)
+	}
+}
+
+func TestPrinterDescribe(t *testing.T) {
+	pr := Printer{
+		Condition: &Condition{Control: ControlEscape, Lines: LinesEach, TabStops: true, Unicode: "15.0.0"},
+		Wrap:      WrapTerminal,
+	}
+	d := pr.Describe()
+	for _, line := range []string{
+		"east-asian    off\n",
+		"control       escape\n",
+		"invalid-utf8  keep\n",
+		"lines         each\n",
+		"unknown       narrow\n",
+		"tab-stops     every 8\n",
+		"unicode       15.0.0\n",
+		"wrap          terminal\n",
+		"sorted-maps   on\n",
+		"separators    \",\" \".\"\n",
+		"indent        \"\"\n",
+		"pool          shared\n",
+		"features      " + pr.Features().String() + "\n",
+	} {
+		if !strings.Contains(d, line) {
+			t.Errorf("Describe() lacks %q:\n%s", line, d)
+		}
+	}
+}
+
+type debugID string
+
+func TestPrinterDebug(t *testing.T) {
+	debug := Printer{Debug: true}
+	tests := []struct {
+		pr     Printer
+		format string
+		args   []interface{}
+		out    string
+	}{
+		{debug, "%s %d %d", []interface{}{"a", 1, debugID("abc")}, "a 1 %!d(arg#3 github.com/lostsnow/wfmt_test.debugID=abc)"},
+		{Printer{}, "%s %d %d", []interface{}{"a", 1, debugID("abc")}, "a 1 %!d(wfmt_test.debugID=abc)"},
+		{debug, "%[2]x %[1]t", []interface{}{1.5, true}, "%!x(arg#2 bool=true) %!t(arg#1 float64=1.5)"},
+		{debug, "%d", []interface{}{struct{ A string }{"x"}}, "{%!d(arg#1 string=x)}"},
+		{debug, "%d", []interface{}{[]debugID{"x"}}, "[%!d(arg#1 github.com/lostsnow/wfmt_test.debugID=x)]"},
+	}
+	for _, tt := range tests {
+		if got := tt.pr.Sprintf(tt.format, tt.args...); got != tt.out {
+			t.Errorf("Sprintf(%q) = %q want %q", tt.format, got, tt.out)
+		}
+	}
+}
+
+func TestPrinterUnsortedMaps(t *testing.T) {
+	m := make(map[int]string)
+	for i := 0; i < 50; i++ {
+		m[i] = Sprint(i)
+	}
+	var sorted Printer
+	unsorted := Printer{UnsortedMaps: true}
+	want := sorted.Sprint(m)
+	got := unsorted.Sprint(m)
+	if len(got) != len(want) || !strings.HasPrefix(got, "map[") {
+		t.Fatalf("unsorted Sprint = %q, sorted %q", got, want)
+	}
+	for k, v := range m {
+		if entry := Sprintf("%d:%s", k, v); !strings.Contains(" "+got[4:len(got)-1]+" ", " "+entry+" ") {
+			t.Errorf("unsorted Sprint lacks %q: %q", entry, got)
+		}
+	}
+	// A digest renders maps sorted regardless.
+	_, d1 := sorted.RenderDigest("%v", m)
+	_, d2 := unsorted.RenderDigest("%v", m)
+	if d1 != d2 {
+		t.Errorf("digest of unsorted map = %x want %x", d2, d1)
+	}
+	if got := sorted.Sprint(map[string]int{"c": 3, "a": 1, "b": 2}); got != "map[a:1 b:2 c:3]" {
+		t.Errorf("sorted Sprint = %q", got)
+	}
+}
+
+func TestPrinterPostProcessors(t *testing.T) {
+	var pr Printer
+	pr.AddPostProcessor(func(b []byte) []byte {
+		return bytes.Replace(b, []byte("hunter2"), []byte("*******"), -1)
+	})
+	pr.AddPostProcessor(func(b []byte) []byte {
+		return append(append(b[:0:0], "[app] "...), b...)
+	})
+	pr.AddPostProcessor(bytes.ToUpper)
+	if got, want := pr.Sprintf("password=%s", "hunter2"), "[APP] PASSWORD=*******"; got != want {
+		t.Errorf("Sprintf = %q want %q", got, want)
+	}
+	var b bytes.Buffer
+	pr.Wrap = 12
+	pr.Fprintln(&b, "login ok for", "hunter2")
+	if got, want := b.String(), "[APP] LOGIN OK FOR\n*******\n"; got != want {
+		t.Errorf("Fprintln wrote %q want %q", got, want)
+	}
+}
+
+type indentInner struct {
+	Name string
+	Tags []string
+}
+
+type indentOuter struct {
+	ID     int
+	Inner  indentInner
+	Counts map[string]int
+	Empty  []int
+	Nil    []int
+}
+
+func TestPrinterIndent(t *testing.T) {
+	v := indentOuter{
+		ID:     7,
+		Inner:  indentInner{Name: "a", Tags: []string{"x", "y"}},
+		Counts: map[string]int{"b": 2, "a": 1},
+		Empty:  []int{},
+	}
+	pr := Printer{Indent: "\t"}
+	want := `wfmt_test.indentOuter{
+	ID: 7,
+	Inner: wfmt_test.indentInner{
+		Name: "a",
+		Tags: []string{
+			"x",
+			"y",
+		},
+	},
+	Counts: map[string]int{
+		"a": 1,
+		"b": 2,
+	},
+	Empty: []int{},
+	Nil: []int(nil),
+}`
+	if got := pr.Sprintf("%#v", v); got != want {
+		t.Errorf("Sprintf(%%#v) =\n%s\nwant\n%s", got, want)
+	}
+	if got, want := pr.Sprintf("%#v", &indentInner{Name: "b"}), "&wfmt_test.indentInner{\n\tName: \"b\",\n\tTags: []string(nil),\n}"; got != want {
+		t.Errorf("Sprintf(%%#v, pointer) = %q want %q", got, want)
+	}
+	if got, want := (&Printer{Indent: "  "}).Sprintf("%v %#v", []int{1}, []int{1}), "[1] []int{\n  1,\n}"; got != want {
+		t.Errorf("Sprintf(%%v %%#v) = %q want %q", got, want)
+	}
+	if got, want := Sprintf("%#v", v.Inner), `wfmt_test.indentInner{Name:"a", Tags:[]string{"x", "y"}}`; got != want {
+		t.Errorf("Sprintf(%%#v) without Indent = %q want %q", got, want)
+	}
+}
+
+type secret string
+
+type account struct {
+	User     string
+	Password secret
+}
+
+func TestPrinterRedact(t *testing.T) {
+	pr := Printer{Redact: func(arg interface{}) (interface{}, bool) {
+		switch v := arg.(type) {
+		case secret:
+			return "****", true
+		case account:
+			v.Password = "****"
+			return v, true
+		}
+		return nil, false
+	}}
+	tests := []struct {
+		format string
+		args   []interface{}
+		out    string
+	}{
+		{"%s:%s", []interface{}{"bob", secret("hunter2")}, "bob:****"},
+		{"[%-6s]", []interface{}{secret("hunter2")}, "[****  ]"},
+		{"%+v", []interface{}{account{"bob", "hunter2"}}, "{User:bob Password:****}"},
+		{"%*d", []interface{}{4, 7}, "   7"},
+		{"%[2]s %[1]d", []interface{}{1, secret("x")}, "**** 1"},
+	}
+	for _, tt := range tests {
+		if got := pr.Sprintf(tt.format, tt.args...); got != tt.out {
+			t.Errorf("Sprintf(%q) = %q want %q", tt.format, got, tt.out)
+		}
+	}
+	if got := pr.Sprintln("token", secret("abc")); got != "token ****\n" {
+		t.Errorf("Sprintln = %q", got)
+	}
+	if got := Sprint(secret("abc")); got != "abc" {
+		t.Errorf("Sprint without Redact = %q", got)
+	}
+}
+
+func TestPrinterMaxBytes(t *testing.T) {
+	pr := Printer{MaxBytes: 12}
+	tests := []struct {
+		format string
+		args   []interface{}
+		out    string
+	}{
+		{"%s", []interface{}{"short"}, "short"},
+		{"%s", []interface{}{"exactly 12 b"}, "exactly 12 b"},
+		{"%s", []interface{}{"exactly 13 by"}, "exactly 1…"},
+		{"%v", []interface{}{make([]int, 1e6)}, "[0 0 0 0 …"},
+		{"%v", []interface{}{make([]byte, 1e6)}, "[0 0 0 0 …"},
+		{"%s", []interface{}{"日本語のテキスト"}, "日本語…"},
+		{"%s", []interface{}{"\x1b[31mred text here"}, "\x1b[31mred \x1b[0m…"},
+	}
+	for _, tt := range tests {
+		if got := pr.Sprintf(tt.format, tt.args...); got != tt.out {
+			t.Errorf("Sprintf(%q) = %q want %q", tt.format, got, tt.out)
+		}
+	}
+	m := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		m[i] = i
+	}
+	if got := (&Printer{MaxBytes: 20, Condition: &Condition{Ellipsis: "..."}}).Sprint(m); got != "map[0:0 1:1 2:2 3..." {
+		t.Errorf("Sprint(map) = %q", got)
+	}
+}
+
+type panicky struct{}
+
+func (panicky) String() string { return explode() }
+
+func explode() string { panic("boom") }
+
+func TestPrinterDebugPanicStack(t *testing.T) {
+	got := (&Printer{Debug: true}).Sprintf("%v", panicky{})
+	const head = "%!v(PANIC=String method: boom\n\t"
+	if !strings.HasPrefix(got, head) || !strings.HasSuffix(got, ")") {
+		t.Fatalf("Sprintf = %q", got)
+	}
+	lines := strings.Split(strings.TrimSuffix(got[len(head)-1:], ")"), "\n")
+	want := []string{"\tgithub.com/lostsnow/wfmt_test.explode", "printer_test.go:", "\tgithub.com/lostsnow/wfmt_test.panicky.String", "printer_test.go:"}
+	if len(lines) != len(want) {
+		t.Fatalf("stack = %q", lines)
+	}
+	for i, w := range want {
+		if !strings.Contains(lines[i], w) {
+			t.Errorf("stack line %d = %q want %q", i, lines[i], w)
+		}
+	}
+	if got := Sprintf("%v", panicky{}); got != "%!v(PANIC=String method: boom)" {
+		t.Errorf("Sprintf without Debug = %q", got)
+	}
+}
+
+type depthNode struct {
+	Name string
+	Kids []depthNode
+}
+
+func TestPrinterMaxDepth(t *testing.T) {
+	tree := depthNode{"a", []depthNode{{"b", []depthNode{{"c", nil}}}}}
+	tests := []struct {
+		pr     Printer
+		format string
+		arg    interface{}
+		out    string
+	}{
+		{Printer{MaxDepth: 1}, "%v", tree, "{a […]}"},
+		{Printer{MaxDepth: 2}, "%v", tree, "{a [{…}]}"},
+		{Printer{MaxDepth: 3}, "%+v", tree, "{Name:a Kids:[{Name:b Kids:[…]}]}"},
+		{Printer{}, "%v", tree, "{a [{b [{c []}]}]}"},
+		{Printer{MaxDepth: 1}, "%v", []interface{}{1, []int{2}, []int{}}, "[1 […] []]"},
+		{Printer{MaxDepth: 1}, "%v", map[string][]int{"k": {1}}, "map[k:[…]]"},
+		{Printer{MaxDepth: 1}, "%v", &tree, "&{a […]}"},
+		{Printer{MaxDepth: 1}, "%#v", [][]int{{1}}, "[][]int{[]int{…}}"},
+		{Printer{MaxDepth: 1, Indent: "  "}, "%#v", [][]int{{1}}, "[][]int{\n  []int{…},\n}"},
+		{Printer{MaxDepth: 1, Condition: &Condition{Ellipsis: "..."}}, "%v", [][]int{{1}}, "[[...]]"},
+	}
+	for _, tt := range tests {
+		if got := tt.pr.Sprintf(tt.format, tt.arg); got != tt.out {
+			t.Errorf("MaxDepth %d: Sprintf(%q) = %q want %q", tt.pr.MaxDepth, tt.format, got, tt.out)
+		}
+	}
+}
+
+// A countingPool hands out buffers of a fixed capacity and records those
+// returned.
+type countingPool struct {
+	mu       sync.Mutex
+	gets     int
+	returned [][]byte
+}
+
+func (cp *countingPool) Get() []byte {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.gets++
+	return make([]byte, 3, 64)
+}
+
+func (cp *countingPool) Put(b []byte) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.returned = append(cp.returned, b)
+}
+
+func TestPrinterPool(t *testing.T) {
+	cp := &countingPool{}
+	pr := Printer{Pool: cp}
+	if got := pr.Sprintf("%-6s|%d", "日本", 42); got != "日本  |42" {
+		t.Errorf("Sprintf = %q", got)
+	}
+	long := strings.Repeat("x", 100)
+	if got := string(pr.Appendf([]byte("> "), "%s", long)); got != "> "+long {
+		t.Errorf("Appendf = %q", got)
+	}
+	var b bytes.Buffer
+	pr.Fprintln(&b, "a", 1)
+	if b.String() != "a 1\n" {
+		t.Errorf("Fprintln wrote %q", b.String())
+	}
+	if cp.gets != 3 || len(cp.returned) != 3 {
+		t.Fatalf("%d buffers taken from the pool, %d returned", cp.gets, len(cp.returned))
+	}
+	if r := cp.returned[1]; string(r) != long {
+		t.Errorf("returned buffer holds %q", r)
+	}
+	if d := pr.Describe(); !strings.Contains(d, "pool          custom\n") {
+		t.Errorf("Describe() lacks the pool:\n%s", d)
+	}
+
+	none := Printer{Pool: NoPool}
+	if got := none.Sprintf("%5.1f", 2.25); got != "  2.2" {
+		t.Errorf("NoPool: Sprintf = %q", got)
+	}
+	if d := none.Describe(); !strings.Contains(d, "pool          none\n") {
+		t.Errorf("Describe() lacks the pool:\n%s", d)
+	}
+	// The shared pool is unaffected.
+	if got := Sprintf("%d", 7); got != "7" {
+		t.Errorf("Sprintf = %q", got)
+	}
+}
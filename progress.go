@@ -0,0 +1,177 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ellipsis marks text cut short to fit a status line.
+const ellipsis = "…"
+
+// fitLine truncates s to a line of width cells, leaving the last
+// column free so that terminals do not wrap. Width 0 means no limit.
+func fitLine(s string, width int) string {
+	if width <= 0 {
+		return s
+	}
+	return DefaultCondition.Truncate(s, width-1, ellipsis)
+}
+
+// A Step prints numbered progress lines such as "[ 2/15] message".
+// The counter column has the same width on every line.
+type Step struct {
+	// Width is the line width in cells. Longer lines are truncated.
+	// If zero, NewStep sets it to the terminal width of the output.
+	Width int
+
+	out   io.Writer
+	total int
+	n     int
+}
+
+// NewStep returns a Step that writes total steps to out.
+func NewStep(out io.Writer, total int) *Step {
+	return &Step{Width: writerWidth(out), out: out, total: total}
+}
+
+// Nextf advances to the next step and prints its line, with the message
+// formatted according to a format specifier.
+func (s *Step) Nextf(format string, a ...interface{}) (n int, err error) {
+	s.n++
+	digits := len(strconv.Itoa(s.total))
+	line := Sprintf("[%*d/%d] ", digits, s.n, s.total) + Sprintf(format, a...)
+	return io.WriteString(s.out, fitLine(line, s.Width)+"\n")
+}
+
+// Current returns the number of the last step printed.
+func (s *Step) Current() int {
+	return s.n
+}
+
+// DefaultSpinnerFrames are the frames drawn by a Spinner by default.
+var DefaultSpinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// A Spinner redraws a single status line, prefixed by an animation
+// frame, until it is stopped. Each redraw blanks whatever is left of the
+// previous line, so messages of different widths do not leave residue.
+// Fields must not be changed once the Spinner is started.
+type Spinner struct {
+	// Frames are drawn in turn. If empty, DefaultSpinnerFrames is used.
+	Frames []string
+	// Interval is the time between frames; 100ms if zero.
+	Interval time.Duration
+	// Width is the line width in cells. Longer lines are truncated.
+	// If zero, NewSpinner sets it to the terminal width of the output.
+	Width int
+	// Clock times the animation; DefaultClock if nil.
+	Clock Clock
+
+	out     io.Writer
+	mu      sync.Mutex
+	msg     string
+	frame   int
+	last    int // width of the line currently shown
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewSpinner returns a Spinner drawing on out.
+func NewSpinner(out io.Writer) *Spinner {
+	return &Spinner{Width: writerWidth(out), out: out}
+}
+
+// Startf shows the message formatted according to a format specifier and
+// starts animating it.
+func (s *Spinner) Startf(format string, a ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	if len(s.Frames) == 0 {
+		s.Frames = DefaultSpinnerFrames
+	}
+	if s.Interval <= 0 {
+		s.Interval = 100 * time.Millisecond
+	}
+	s.msg = Sprintf(format, a...)
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+	s.draw()
+	clock := s.Clock
+	if clock == nil {
+		clock = DefaultClock
+	}
+	go s.run(clock.NewTicker(s.Interval), s.stop, s.stopped)
+}
+
+func (s *Spinner) run(t Ticker, stop, stopped chan struct{}) {
+	defer close(stopped)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C():
+			s.mu.Lock()
+			s.frame = (s.frame + 1) % len(s.Frames)
+			s.draw()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Updatef replaces the message of a running spinner.
+func (s *Spinner) Updatef(format string, a ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msg = Sprintf(format, a...)
+	if s.stop != nil {
+		s.draw()
+	}
+}
+
+// Stopf stops the animation and replaces the status line with the
+// message formatted according to a format specifier, followed by a newline.
+func (s *Spinner) Stopf(format string, a ...interface{}) {
+	s.mu.Lock()
+	stop, stopped := s.stop, s.stopped
+	s.stop = nil
+	s.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.redraw(fitLine(Sprintf(format, a...), s.Width))
+	io.WriteString(s.out, "\n")
+	s.last = 0
+}
+
+// draw shows the current frame and message. s.mu must be held.
+func (s *Spinner) draw() {
+	s.redraw(fitLine(s.Frames[s.frame]+" "+s.msg, s.Width))
+}
+
+// redraw overwrites the status line with line. s.mu must be held.
+func (s *Spinner) redraw(line string) {
+	w := stringWidth(line)
+	p := newPrinter()
+	p.buf.WriteByte('\r')
+	p.buf.WriteString(line)
+	for i := w; i < s.last; i++ {
+		p.buf.WriteByte(' ')
+	}
+	s.out.Write(p.buf)
+	p.free()
+	s.last = w
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestStep(t *testing.T) {
+	var out bytes.Buffer
+	s := NewStep(&out, 12)
+	s.Width = 20
+	s.Nextf("取得中")
+	s.Nextf("依存関係を解決中です")
+	s.Nextf("%s", "done")
+	want := "[ 1/12] 取得中\n" +
+		"[ 2/12] 依存関係を…\n" +
+		"[ 3/12] done\n"
+	if out.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", out.String(), want)
+	}
+	if s.Current() != 3 {
+		t.Errorf("Current() = %d want 3", s.Current())
+	}
+}
+
+func TestSpinner(t *testing.T) {
+	var out bytes.Buffer
+	s := NewSpinner(&out)
+	s.Frames = []string{"-"}
+	s.Interval = time.Hour
+	s.Startf("依存関係を解決中")
+	s.Updatef("ok")
+	s.Stopf("完了")
+	want := "\r- 依存関係を解決中" +
+		"\r- ok              " +
+		"\r完了\n"
+	if out.String() != want {
+		t.Errorf("output = %q want %q", out.String(), want)
+	}
+}
+
+func TestSpinnerFrozenClock(t *testing.T) {
+	var out bytes.Buffer
+	clock := NewFrozenClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewSpinner(&out)
+	s.Frames = []string{"a", "b"}
+	s.Interval = 100 * time.Millisecond
+	s.Clock = clock
+	s.Startf("x")
+	clock.Advance(250 * time.Millisecond)
+	s.Stopf("done")
+	want := "\ra x\rb x\ra x\rdone\n"
+	if out.String() != want {
+		t.Errorf("output = %q want %q", out.String(), want)
+	}
+	if got, want := clock.Now(), time.Date(2019, 1, 1, 0, 0, 0, 250e6, time.UTC); !got.Equal(want) {
+		t.Errorf("Now() = %v want %v", got, want)
+	}
+}
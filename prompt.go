@@ -0,0 +1,183 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoAnswer is returned by Prompter methods when the input ends
+// before a valid answer was read.
+var ErrNoAnswer = errors.New("wfmt: no answer")
+
+// A Choice is one option offered by Choosef. Detail, if not empty, is
+// printed after the label; labels are padded so that details line up.
+type Choice struct {
+	Label  string
+	Detail string
+}
+
+// Choices returns one Choice per label.
+func Choices(labels ...string) []Choice {
+	c := make([]Choice, len(labels))
+	for i, l := range labels {
+		c[i].Label = l
+	}
+	return c
+}
+
+// A Prompter asks questions on an output and reads the answers, one
+// line each, from an input.
+type Prompter struct {
+	out io.Writer
+	in  *bufio.Reader
+}
+
+// NewPrompter returns a Prompter reading answers from in and writing
+// questions to out.
+func NewPrompter(in io.Reader, out io.Writer) *Prompter {
+	br, ok := in.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(in)
+	}
+	return &Prompter{out: out, in: br}
+}
+
+// stdPrompter is created on first use so that nothing is read from
+// standard input unless a prompt is shown.
+var (
+	stdOnce     sync.Once
+	stdPrompter *Prompter
+)
+
+func std() *Prompter {
+	stdOnce.Do(func() {
+		stdPrompter = NewPrompter(os.Stdin, os.Stdout)
+	})
+	return stdPrompter
+}
+
+// readLine reads one answer with surrounding white space removed.
+func (p *Prompter) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err == io.EOF {
+		if line == "" {
+			return "", ErrNoAnswer
+		}
+		err = nil
+	}
+	return strings.TrimSpace(line), err
+}
+
+// Promptf writes the question formatted according to a format specifier
+// and returns the answer.
+func (p *Prompter) Promptf(format string, a ...interface{}) (string, error) {
+	if _, err := Fprintf(p.out, format, a...); err != nil {
+		return "", err
+	}
+	return p.readLine()
+}
+
+// Confirmf asks a yes/no question formatted according to a format
+// specifier, followed by "[Y/n]" or "[y/N]", until it is answered.
+// An empty answer selects def.
+func (p *Prompter) Confirmf(def bool, format string, a ...interface{}) (bool, error) {
+	hint := " [y/N] "
+	if def {
+		hint = " [Y/n] "
+	}
+	question := Sprintf(format, a...) + hint
+	for {
+		answer, err := p.Promptf("%s", question)
+		if err != nil {
+			return def, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		Fprintln(p.out, "Please answer yes or no.")
+	}
+}
+
+// Choosef writes the heading formatted according to a format specifier
+// and a numbered list of choices, then asks until one is selected by
+// number or by label. An empty answer selects def unless it is out of
+// range. The returned index is zero-based.
+func (p *Prompter) Choosef(choices []Choice, def int, format string, a ...interface{}) (int, error) {
+	if len(choices) == 0 {
+		return -1, ErrNoAnswer
+	}
+	numWidth := len(strconv.Itoa(len(choices)))
+	labelWidth := 0
+	for _, c := range choices {
+		if w := stringWidth(c.Label); w > labelWidth {
+			labelWidth = w
+		}
+	}
+	hasDefault := 0 <= def && def < len(choices)
+
+	Fprintf(p.out, format, a...)
+	Fprintln(p.out)
+	for i, c := range choices {
+		mark := ' '
+		if i == def {
+			mark = '*'
+		}
+		if c.Detail == "" {
+			Fprintf(p.out, " %c %*d) %s\n", mark, numWidth, i+1, c.Label)
+		} else {
+			Fprintf(p.out, " %c %*d) %-*s  %s\n", mark, numWidth, i+1, labelWidth, c.Label, c.Detail)
+		}
+	}
+	question := Sprintf("Enter a number (1-%d): ", len(choices))
+	if hasDefault {
+		question = Sprintf("Enter a number (1-%d) [%d]: ", len(choices), def+1)
+	}
+	for {
+		answer, err := p.Promptf("%s", question)
+		if err != nil {
+			return -1, err
+		}
+		if answer == "" && hasDefault {
+			return def, nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil && 1 <= n && n <= len(choices) {
+			return n - 1, nil
+		}
+		for i, c := range choices {
+			if strings.EqualFold(answer, c.Label) {
+				return i, nil
+			}
+		}
+		Fprintf(p.out, "Please enter a number between 1 and %d.\n", len(choices))
+	}
+}
+
+// Promptf writes the question to standard output and reads the answer
+// from standard input. See Prompter.Promptf.
+func Promptf(format string, a ...interface{}) (string, error) {
+	return std().Promptf(format, a...)
+}
+
+// Confirmf asks a yes/no question on standard output. See Prompter.Confirmf.
+func Confirmf(def bool, format string, a ...interface{}) (bool, error) {
+	return std().Confirmf(def, format, a...)
+}
+
+// Choosef asks for one of choices on standard output. See Prompter.Choosef.
+func Choosef(choices []Choice, def int, format string, a ...interface{}) (int, error) {
+	return std().Choosef(choices, def, format, a...)
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestConfirmf(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrompter(strings.NewReader("maybe\nYes\n\n"), &out)
+	for _, want := range []bool{true, false} {
+		got, err := p.Confirmf(false, "削除しますか?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Confirmf = %v want %v", got, want)
+		}
+	}
+	if _, err := p.Confirmf(true, "again?"); err != ErrNoAnswer {
+		t.Errorf("Confirmf at EOF: err = %v want ErrNoAnswer", err)
+	}
+	want := "削除しますか? [y/N] Please answer yes or no.\n削除しますか? [y/N] 削除しますか? [y/N] again? [Y/n] "
+	if out.String() != want {
+		t.Errorf("output = %q want %q", out.String(), want)
+	}
+}
+
+func TestChoosef(t *testing.T) {
+	var out bytes.Buffer
+	choices := []Choice{
+		{"東京", "Tokyo"},
+		{"Osaka", "大阪"},
+		{"札幌市", "Sapporo"},
+	}
+	p := NewPrompter(strings.NewReader("9\nosaka\n\n"), &out)
+	got, err := p.Choosef(choices, 2, "地域を選択:")
+	if err != nil || got != 1 {
+		t.Errorf("Choosef = %d, %v want 1, nil", got, err)
+	}
+	want := "地域を選択:\n" +
+		"   1) 東京    Tokyo\n" +
+		"   2) Osaka   大阪\n" +
+		" * 3) 札幌市  Sapporo\n" +
+		"Enter a number (1-3) [3]: Please enter a number between 1 and 3.\n" +
+		"Enter a number (1-3) [3]: "
+	if out.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", out.String(), want)
+	}
+	if got, err := p.Choosef(choices, 2, "again"); err != nil || got != 2 {
+		t.Errorf("Choosef default = %d, %v want 2, nil", got, err)
+	}
+}
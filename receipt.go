@@ -0,0 +1,118 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "io"
+
+// A ReceiptProfile describes the line width of a thermal receipt printer.
+type ReceiptProfile struct {
+	Name    string
+	Columns int // line width in half-width cells
+}
+
+// Common receipt printer profiles, for the standard font of each paper width.
+var (
+	Receipt58mm   = ReceiptProfile{"58mm", 32}
+	Receipt80mm42 = ReceiptProfile{"80mm, 42 columns", 42}
+	Receipt80mm   = ReceiptProfile{"80mm", 48}
+)
+
+// A Receipt writes lines laid out for a receipt printer. Every line is
+// at most Columns cells wide, with CJK characters counted as two cells,
+// and longer text is truncated with an ellipsis.
+type Receipt struct {
+	Profile ReceiptProfile
+	// Condition measures text; DefaultCondition if nil.
+	Condition *Condition
+	// LeaderRune fills the gap of Leader lines; '.' if zero.
+	LeaderRune rune
+
+	out io.Writer
+}
+
+// NewReceipt returns a Receipt writing to w with the given profile.
+func NewReceipt(w io.Writer, p ReceiptProfile) *Receipt {
+	return &Receipt{Profile: p, out: w}
+}
+
+func (r *Receipt) cond() *Condition {
+	if r.Condition != nil {
+		return r.Condition
+	}
+	return DefaultCondition
+}
+
+// writeLine writes s, padded on the left by pad cells, and a newline.
+func (r *Receipt) writeLine(pad int, s string) error {
+	p := newPrinter()
+	p.fmt.writePadding(pad)
+	p.buf.WriteString(s)
+	p.buf.WriteByte('\n')
+	_, err := r.out.Write(p.buf)
+	p.free()
+	return err
+}
+
+// fit truncates s to the line width and returns it with its width.
+func (r *Receipt) fit(s string) (string, int) {
+	s = r.cond().Truncate(s, r.Profile.Columns, ellipsis)
+	return s, r.cond().StringWidth(s)
+}
+
+// Linef writes a left-aligned line formatted according to a format specifier.
+func (r *Receipt) Linef(format string, a ...interface{}) error {
+	s, _ := r.fit(Sprintf(format, a...))
+	return r.writeLine(0, s)
+}
+
+// Centerf writes a centered line formatted according to a format specifier.
+// When the space left cannot be split evenly the extra cell goes to the right.
+func (r *Receipt) Centerf(format string, a ...interface{}) error {
+	s, w := r.fit(Sprintf(format, a...))
+	return r.writeLine((r.Profile.Columns-w)/2, s)
+}
+
+// Rightf writes a right-aligned line formatted according to a format specifier.
+func (r *Receipt) Rightf(format string, a ...interface{}) error {
+	s, w := r.fit(Sprintf(format, a...))
+	return r.writeLine(r.Profile.Columns-w, s)
+}
+
+// Leader writes left and right at the two ends of a line joined by a
+// dot leader, as in "Coffee ........ 4.50". If they do not fit, left is
+// truncated.
+func (r *Receipt) Leader(left, right string) error {
+	c := r.cond()
+	right, rw := r.fit(right)
+	left = c.Truncate(left, r.Profile.Columns-rw-2, ellipsis)
+	gap := r.Profile.Columns - c.StringWidth(left) - rw
+	fill := r.LeaderRune
+	if fill == 0 {
+		fill = '.'
+	}
+	line := left
+	if gap >= 2 {
+		line += " " + c.fill(fill, gap-2) + " "
+	} else {
+		line += c.fill(' ', gap)
+	}
+	return r.writeLine(0, line+right)
+}
+
+// Separator writes a line filled with sep, such as '-' or the fullwidth
+// '＝'. A wide rune is repeated half as often.
+func (r *Receipt) Separator(sep rune) error {
+	return r.writeLine(0, r.cond().fill(sep, r.Profile.Columns))
+}
+
+// Feed writes n empty lines.
+func (r *Receipt) Feed(n int) error {
+	for i := 0; i < n; i++ {
+		if err := r.writeLine(0, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
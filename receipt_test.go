@@ -0,0 +1,37 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestReceipt(t *testing.T) {
+	var b strings.Builder
+	r := NewReceipt(&b, ReceiptProfile{"test", 20})
+	r.Centerf("%s", "領収書")
+	r.Separator('＝')
+	r.Leader("コーヒー", "¥450")
+	r.Leader("Sandwich", "12.50")
+	r.Leader("とても長い商品名のサンドイッチ", "¥980")
+	r.Separator('-')
+	r.Rightf("合計 %s", "¥1,430")
+	r.Linef("%s", "ありがとうございました")
+	want := "" +
+		"       領収書\n" +
+		"＝＝＝＝＝＝＝＝＝＝\n" +
+		"コーヒー ...... ¥450\n" +
+		"Sandwich ..... 12.50\n" +
+		"とても長い商… . ¥980\n" +
+		"--------------------\n" +
+		"         合計 ¥1,430\n" +
+		"ありがとうございま…\n"
+	if got := b.String(); got != want {
+		t.Errorf("receipt =\n%s\nwant\n%s", got, want)
+	}
+}
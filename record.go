@@ -0,0 +1,135 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// An Overflow is what a RecordWriter does with a field wider than its
+// column.
+type Overflow int
+
+const (
+	// OverflowTruncate cuts the field to the column.
+	OverflowTruncate Overflow = iota
+	// OverflowEllipsis cuts the field and marks the cut with the Tail of
+	// the RecordWriter.
+	OverflowEllipsis
+	// OverflowError rejects the record with a *ColumnOverflowError.
+	OverflowError
+)
+
+// A FixedColumn is a column of a fixed-width record layout.
+type FixedColumn struct {
+	Name     string
+	Width    int // in display cells
+	Align    Alignment
+	Overflow Overflow
+}
+
+// A ColumnOverflowError reports a field too wide for its column.
+type ColumnOverflowError struct {
+	Column string // name of the column
+	Width  int    // width of the field in cells
+	Max    int    // width of the column
+}
+
+func (e *ColumnOverflowError) Error() string {
+	return "wfmt: column " + strconv.Quote(e.Column) + " needs " +
+		strconv.Itoa(e.Width) + " cells, has " + strconv.Itoa(e.Max)
+}
+
+// A RecordWriter writes fixed-width records, one per line, whose columns
+// start at fixed display columns, for report formats read by systems
+// that count a CJK character as two columns. Fields are padded with
+// spaces to the width of their columns and handled by the column's
+// Overflow policy when wider; a wide character that would straddle the
+// end of a column is left out and replaced by a space.
+type RecordWriter struct {
+	// Condition measures fields; DefaultCondition if nil.
+	Condition *Condition
+	// Tail marks fields cut by OverflowEllipsis; "…" if empty.
+	Tail string
+	// LineEnd ends each record; "\n" if empty.
+	LineEnd string
+
+	cols []FixedColumn
+	out  io.Writer
+}
+
+// NewRecordWriter returns a RecordWriter writing records laid out in
+// cols to w.
+func NewRecordWriter(w io.Writer, cols ...FixedColumn) *RecordWriter {
+	return &RecordWriter{cols: cols, out: w}
+}
+
+func (rw *RecordWriter) cond() *Condition {
+	if rw.Condition != nil {
+		return rw.Condition
+	}
+	return DefaultCondition
+}
+
+// Width returns the width of a record in display cells.
+func (rw *RecordWriter) Width() int {
+	w := 0
+	for _, col := range rw.cols {
+		w += col.Width
+	}
+	return w
+}
+
+// Write writes a record with a field for each operand, formatted as by
+// Sprint. Missing fields are left blank; extra operands panic. If a
+// field overflows a column with OverflowError, nothing is written and
+// the *ColumnOverflowError is returned.
+func (rw *RecordWriter) Write(fields ...interface{}) error {
+	if len(fields) > len(rw.cols) {
+		panic("wfmt: record has " + strconv.Itoa(len(fields)) + " fields for " +
+			strconv.Itoa(len(rw.cols)) + " columns")
+	}
+	c := rw.cond()
+	pr := Printer{Condition: c}
+	var b strings.Builder
+	for j, col := range rw.cols {
+		var s string
+		if j < len(fields) {
+			s = pr.Sprint(fields[j])
+		}
+		if w := c.StringWidth(s); w > col.Width {
+			switch col.Overflow {
+			case OverflowError:
+				return &ColumnOverflowError{Column: col.Name, Width: w, Max: col.Width}
+			case OverflowEllipsis:
+				tail := rw.Tail
+				if tail == "" {
+					tail = ellipsis
+				}
+				s = c.Truncate(s, col.Width, tail)
+			default:
+				s = c.Truncate(s, col.Width, "")
+			}
+		}
+		switch col.Align {
+		case AlignRight, AlignDecimal, AlignCurrency:
+			s = c.PadLeft(s, col.Width, ' ')
+		case AlignCenter:
+			s = c.Center(s, col.Width, ' ')
+		default:
+			s = c.PadRight(s, col.Width, ' ')
+		}
+		b.WriteString(s)
+	}
+	if rw.LineEnd == "" {
+		b.WriteByte('\n')
+	} else {
+		b.WriteString(rw.LineEnd)
+	}
+	_, err := io.WriteString(rw.out, b.String())
+	return err
+}
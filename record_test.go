@@ -0,0 +1,60 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+var recordColumns = []FixedColumn{
+	{Name: "code", Width: 4, Align: AlignRight},
+	{Name: "name", Width: 8, Overflow: OverflowEllipsis},
+	{Name: "city", Width: 5},
+	{Name: "qty", Width: 4, Align: AlignRight, Overflow: OverflowError},
+}
+
+func TestRecordWriter(t *testing.T) {
+	var b strings.Builder
+	rw := NewRecordWriter(&b, recordColumns...)
+	rw.LineEnd = "\r\n"
+	if w := rw.Width(); w != 21 {
+		t.Errorf("Width() = %d", w)
+	}
+	for _, rec := range [][]interface{}{
+		{7, "山田太郎", "東京", 12},
+		{42, "長谷川まりこ", "横浜市", 3},
+		{1, "Bob"},
+	} {
+		if err := rw.Write(rec...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "" +
+		"   7山田太郎東京   12\r\n" +
+		"  42長谷川… 横浜    3\r\n" +
+		"   1Bob              \r\n"
+	if got := b.String(); got != want {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestRecordWriterOverflowError(t *testing.T) {
+	var b strings.Builder
+	rw := NewRecordWriter(&b, recordColumns...)
+	err := rw.Write(1, "a", "b", 12345)
+	oe, ok := err.(*ColumnOverflowError)
+	if !ok || oe.Column != "qty" || oe.Width != 5 || oe.Max != 4 {
+		t.Fatalf("Write returned %v", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("Write wrote %q for a rejected record", b.String())
+	}
+	if got := err.Error(); got != `wfmt: column "qty" needs 5 cells, has 4` {
+		t.Errorf("Error() = %q", got)
+	}
+}
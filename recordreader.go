@@ -0,0 +1,159 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// A RecordReader reads fixed-width records, one per line, slicing each
+// line into fields at the display columns of its layout, as written by
+// a RecordWriter. A wide character belongs to the column in which it
+// starts. Fields are trimmed of spaces, including the ideographic
+// space, and text beyond the last column is ignored. A RecordReader is
+// a RecordSource, so its records can be printed by a CSVPrinter.
+type RecordReader struct {
+	// Condition measures lines; DefaultCondition if nil.
+	Condition *Condition
+
+	cols []FixedColumn
+	r    *bufio.Reader
+	line int
+}
+
+// NewRecordReader returns a RecordReader reading records laid out in cols
+// from r.
+func NewRecordReader(r io.Reader, cols ...FixedColumn) *RecordReader {
+	return &RecordReader{cols: cols, r: bufio.NewReader(r)}
+}
+
+func (rr *RecordReader) cond() *Condition {
+	if rr.Condition != nil {
+		return rr.Condition
+	}
+	return DefaultCondition
+}
+
+// Line returns the number of lines read so far.
+func (rr *RecordReader) Line() int {
+	return rr.line
+}
+
+// Read returns the fields of the next record, or io.EOF after the last.
+func (rr *RecordReader) Read() ([]string, error) {
+	line, err := rr.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rr.line++
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	return rr.cond().splitFixed(line, rr.cols), nil
+}
+
+// ReadStruct reads the next record into the struct v points to, as
+// UnmarshalFixed does. It returns io.EOF after the last record.
+func (rr *RecordReader) ReadStruct(v interface{}) error {
+	fields, err := rr.Read()
+	if err != nil {
+		return err
+	}
+	if err := unmarshalFixed(fields, rr.cols, v); err != nil {
+		return Errorf("wfmt: line %d: %w", rr.line, err)
+	}
+	return nil
+}
+
+// splitFixed slices line into the trimmed fields of cols.
+func (c *Condition) splitFixed(line string, cols []FixedColumn) []string {
+	fields := make([]string, len(cols))
+	if len(cols) == 0 {
+		return fields
+	}
+	j, start, end := 0, 0, cols[0].Width
+	for g := c.Graphemes(line); g.Next(); {
+		if g.IsSequence() {
+			continue
+		}
+		pos, _ := g.Positions()
+		for j < len(cols) && g.Column()-g.Width() >= end {
+			fields[j] = line[start:pos]
+			start = pos
+			if j++; j < len(cols) {
+				end += cols[j].Width
+			}
+		}
+		if j == len(cols) {
+			break
+		}
+	}
+	if j < len(cols) {
+		fields[j] = line[start:]
+	}
+	for j, f := range fields {
+		fields[j] = strings.TrimSpace(f)
+	}
+	return fields
+}
+
+// UnmarshalFixed slices line into the fields of the fixed-width layout
+// cols, as a RecordReader does, and stores them in the struct v points
+// to. Each column is stored in the field tagged `fixed:"name"` with its
+// name or, failing that, the exported field of that name, ignoring
+// case; columns without a field are skipped. Fields of string type
+// take the text as it is; others are parsed by Sscan, and left unset
+// when the text is empty.
+func UnmarshalFixed(line string, cols []FixedColumn, v interface{}) error {
+	return unmarshalFixed(DefaultCondition.splitFixed(line, cols), cols, v)
+}
+
+func unmarshalFixed(fields []string, cols []FixedColumn, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("wfmt: UnmarshalFixed needs a pointer to a struct")
+	}
+	rv = rv.Elem()
+	for j, col := range cols {
+		f := fixedField(rv, col.Name)
+		if !f.IsValid() {
+			continue
+		}
+		s := fields[j]
+		if f.Kind() == reflect.String {
+			f.SetString(s)
+			continue
+		}
+		if s == "" {
+			continue
+		}
+		if _, err := Sscan(s, f.Addr().Interface()); err != nil {
+			return Errorf("column %q: %w", col.Name, err)
+		}
+	}
+	return nil
+}
+
+// fixedField returns the field of the struct rv that the column name is
+// stored in, or the zero Value if there is none.
+func fixedField(rv reflect.Value, name string) reflect.Value {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("fixed") == name {
+			return rv.Field(i)
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if sf := t.Field(i); sf.PkgPath == "" && strings.EqualFold(sf.Name, name) {
+			return rv.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
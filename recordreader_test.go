@@ -0,0 +1,75 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestRecordReader(t *testing.T) {
+	in := "" +
+		"   7山田太郎東京   12\r\n" +
+		"  42長谷川… 横浜    3\r\n" +
+		"   1Bob\n" +
+		// A wide character straddling the end of a column belongs to it.
+		"   9abc日本語x      5"
+	rr := NewRecordReader(strings.NewReader(in), recordColumns...)
+	want := [][]string{
+		{"7", "山田太郎", "東京", "12"},
+		{"42", "長谷川…", "横浜", "3"},
+		{"1", "Bob", "", ""},
+		{"9", "abc日本語", "x", "5"},
+	}
+	for i, w := range want {
+		got, err := rr.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("record %d = %q want %q", i, got, w)
+		}
+	}
+	if _, err := rr.Read(); err != io.EOF {
+		t.Errorf("Read after the last record returned %v", err)
+	}
+	if n := rr.Line(); n != 4 {
+		t.Errorf("Line() = %d", n)
+	}
+}
+
+type fixedItem struct {
+	Code  int
+	Label string `fixed:"name"`
+	City  string
+	Qty   float64
+}
+
+func TestUnmarshalFixed(t *testing.T) {
+	var it fixedItem
+	if err := UnmarshalFixed("  42長谷川… 横浜  3.5", recordColumns, &it); err != nil {
+		t.Fatal(err)
+	}
+	if want := (fixedItem{42, "長谷川…", "横浜", 3.5}); it != want {
+		t.Errorf("got %+v want %+v", it, want)
+	}
+
+	rr := NewRecordReader(strings.NewReader("   1a    b        \n  xxa    b       1\n"), recordColumns...)
+	it = fixedItem{}
+	if err := rr.ReadStruct(&it); err != nil || it.Code != 1 || it.Qty != 0 {
+		t.Errorf("ReadStruct = %+v, %v", it, err)
+	}
+	err := rr.ReadStruct(&it)
+	if err == nil || !strings.HasPrefix(err.Error(), `wfmt: line 2: column "code": `) {
+		t.Errorf("ReadStruct of a bad number returned %v", err)
+	}
+	if err := UnmarshalFixed("", recordColumns, it); err == nil {
+		t.Error("UnmarshalFixed into a non-pointer succeeded")
+	}
+}
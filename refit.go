@@ -0,0 +1,140 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+)
+
+// A Refitter keeps the output of a long-running program fitting its
+// terminal window. It listens for the terminal being resized, where the
+// platform reports it (SIGWINCH on Unix systems), sets the Wrap width of
+// its Printer to the new width and calls the functions registered with
+// OnResize, which may re-render what is on the screen, with Report.Render
+// for example.
+//
+// The Printer must not be used directly while the Refitter runs; print
+// through the Refitter instead, which serializes printing with refitting.
+type Refitter struct {
+	pr  *Printer
+	out *os.File
+
+	mu        sync.Mutex
+	width     int
+	callbacks []func(width int)
+
+	sig  chan os.Signal
+	done chan struct{}
+}
+
+// NewRefitter returns a Refitter for the terminal out, wrapping the
+// output of pr at its current width, and starts listening for resizes.
+// If out is not a terminal, the width is taken from $COLUMNS, and
+// output is not wrapped if that is unset.
+func NewRefitter(pr *Printer, out *os.File) *Refitter {
+	r := &Refitter{
+		pr:   pr,
+		out:  out,
+		sig:  make(chan os.Signal, 1),
+		done: make(chan struct{}),
+	}
+	r.width = r.measure()
+	pr.Wrap = r.width
+	notifyResize(r.sig)
+	go r.listen()
+	return r
+}
+
+// measure returns the width of the terminal: the size reported for out,
+// or $COLUMNS if out is not a terminal.
+func (r *Refitter) measure() int {
+	if cols, _, ok := terminalSize(r.out.Fd()); ok && cols > 0 {
+		return cols
+	}
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	return 0
+}
+
+func (r *Refitter) listen() {
+	for {
+		select {
+		case <-r.sig:
+			r.Refit()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// OnResize registers f to be called with the new width whenever the
+// terminal changes width. Callbacks run in the order they were
+// registered, one at a time, and may print through the Refitter.
+func (r *Refitter) OnResize(f func(width int)) {
+	r.mu.Lock()
+	r.callbacks = append(r.callbacks, f)
+	r.mu.Unlock()
+}
+
+// Width returns the width in cells at which output is wrapped, or 0 if
+// it is not.
+func (r *Refitter) Width() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.width
+}
+
+// Refit measures the terminal again and, if its width has changed,
+// updates the Printer and calls the resize callbacks. It is called on
+// each resize, and may be called directly where resizes are not
+// reported.
+func (r *Refitter) Refit() {
+	r.mu.Lock()
+	width := r.measure()
+	if width == r.width {
+		r.mu.Unlock()
+		return
+	}
+	r.width = width
+	r.pr.Wrap = width
+	callbacks := r.callbacks
+	r.mu.Unlock()
+	for _, f := range callbacks {
+		f(width)
+	}
+}
+
+// Stop stops listening for resizes. The Printer keeps the last width.
+func (r *Refitter) Stop() {
+	signal.Stop(r.sig)
+	close(r.done)
+}
+
+// Fprintf formats with the Printer according to a format specifier and
+// writes to w.
+func (r *Refitter) Fprintf(w io.Writer, format string, a ...interface{}) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pr.Fprintf(w, format, a...)
+}
+
+// Printf formats with the Printer according to a format specifier and
+// writes to the terminal.
+func (r *Refitter) Printf(format string, a ...interface{}) (n int, err error) {
+	return r.Fprintf(r.out, format, a...)
+}
+
+// Println formats with the Printer using the default formats and writes
+// to the terminal, adding spaces between operands and a newline.
+func (r *Refitter) Println(a ...interface{}) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pr.Fprintln(r.out, a...)
+}
@@ -0,0 +1,14 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package wfmt
+
+import "os"
+
+// notifyResize does nothing: resizes are not reported on this platform,
+// and Refitter.Refit must be called to pick up a new width.
+func notifyResize(c chan<- os.Signal) {}
@@ -0,0 +1,53 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestRefitter(t *testing.T) {
+	f, err := ioutil.TempFile("", "refit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	defer os.Setenv("COLUMNS", os.Getenv("COLUMNS"))
+
+	os.Setenv("COLUMNS", "40")
+	pr := &Printer{}
+	r := NewRefitter(pr, f)
+	defer r.Stop()
+	if r.Width() != 40 || pr.Wrap != 40 {
+		t.Fatalf("width = %d, Wrap = %d want 40", r.Width(), pr.Wrap)
+	}
+
+	var widths []int
+	r.OnResize(func(width int) {
+		widths = append(widths, width)
+		r.Printf("日本語 のテキスト\n")
+	})
+	os.Setenv("COLUMNS", "10")
+	r.Refit()
+	r.Refit() // unchanged: no callback
+	if len(widths) != 1 || widths[0] != 10 || pr.Wrap != 10 {
+		t.Fatalf("resized to %v, Wrap = %d want [10], 10", widths, pr.Wrap)
+	}
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		if w := DefaultCondition.StringWidth(line); w > 10 {
+			t.Errorf("line %q is %d cells wide, want at most 10", line, w)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "strings"
+
+// columnGap separates the columns of a Report table.
+const columnGap = "  "
+
+// A reportBlock is a paragraph, held as the wrap tokens of its lines, or
+// a table row, held as its cells and their widths.
+type reportBlock struct {
+	lines  [][]wrapToken
+	cells  []string
+	widths []int
+}
+
+// A Report is formatted text, paragraphs and tables, that can be
+// rendered again at a new width, as when a full-screen program's
+// terminal is resized. Operands are formatted and measured once, when
+// they are added; Render only lays the text out, wrapping paragraphs
+// and fitting tables to the width. The zero Report is empty and ready
+// to use.
+type Report struct {
+	// Condition measures text; DefaultCondition if nil.
+	Condition *Condition
+
+	blocks []reportBlock
+	// The last rendering, which is reused for the same width.
+	width    int
+	rendered string
+	valid    bool
+}
+
+func (r *Report) cond() *Condition {
+	if r.Condition != nil {
+		return r.Condition
+	}
+	return DefaultCondition
+}
+
+// Printf adds a paragraph formatted according to a format specifier.
+// Its lines are soft-wrapped as Wrap does.
+func (r *Report) Printf(format string, a ...interface{}) {
+	c := r.cond()
+	pr := Printer{Condition: c}
+	var blk reportBlock
+	for _, line := range strings.Split(pr.Sprintf(format, a...), "\n") {
+		blk.lines = append(blk.lines, c.wrapTokens(line))
+	}
+	r.blocks = append(r.blocks, blk)
+	r.valid = false
+}
+
+// Row adds a table row with a cell for each operand, formatted as by
+// Sprint. Consecutive rows form a table whose columns are as wide as
+// their widest cells; when the table is too wide, the widest columns
+// are narrowed and cells truncated with an ellipsis.
+func (r *Report) Row(cells ...interface{}) {
+	c := r.cond()
+	pr := Printer{Condition: c}
+	blk := reportBlock{cells: make([]string, len(cells)), widths: make([]int, len(cells))}
+	for i, cell := range cells {
+		blk.cells[i] = pr.Sprint(cell)
+		blk.widths[i] = c.StringWidth(blk.cells[i])
+	}
+	r.blocks = append(r.blocks, blk)
+	r.valid = false
+}
+
+// Render returns the report laid out for width cells. A width of zero
+// or less leaves paragraphs unwrapped and tables at their natural
+// width. Rendering again at the same width returns the previous result.
+func (r *Report) Render(width int) string {
+	if r.valid && r.width == width {
+		return r.rendered
+	}
+	c := r.cond()
+	var b strings.Builder
+	for i := 0; i < len(r.blocks); {
+		blk := r.blocks[i]
+		if blk.cells == nil {
+			for _, toks := range blk.lines {
+				if width > 0 {
+					c.wrapLine(&b, toks, width)
+				} else {
+					for _, tok := range toks {
+						b.WriteString(tok.text)
+					}
+				}
+				b.WriteByte('\n')
+			}
+			i++
+			continue
+		}
+		j := i
+		for j < len(r.blocks) && r.blocks[j].cells != nil {
+			j++
+		}
+		r.renderTable(&b, r.blocks[i:j], width)
+		i = j
+	}
+	r.width, r.rendered, r.valid = width, b.String(), true
+	return r.rendered
+}
+
+// renderTable writes the rows of a table fitted to width cells.
+func (r *Report) renderTable(b *strings.Builder, rows []reportBlock, width int) {
+	c := r.cond()
+	var cols []int
+	for _, row := range rows {
+		for k, w := range row.widths {
+			if k == len(cols) {
+				cols = append(cols, 0)
+			}
+			if w > cols[k] {
+				cols[k] = w
+			}
+		}
+	}
+	if width > 0 {
+		total := len(columnGap) * (len(cols) - 1)
+		for _, w := range cols {
+			total += w
+		}
+		// Narrow the widest column, one cell at a time, until the table fits.
+		for total > width {
+			widest := 0
+			for k, w := range cols {
+				if w > cols[widest] {
+					widest = k
+				}
+			}
+			if cols[widest] <= 1 {
+				break
+			}
+			cols[widest]--
+			total--
+		}
+	}
+	var line strings.Builder
+	for _, row := range rows {
+		line.Reset()
+		for k, cell := range row.cells {
+			if k > 0 {
+				line.WriteString(columnGap)
+			}
+			w := row.widths[k]
+			if w > cols[k] {
+				cell = c.Truncate(cell, cols[k], ellipsis)
+				w = c.StringWidth(cell)
+			}
+			line.WriteString(cell)
+			line.WriteString(strings.Repeat(" ", cols[k]-w))
+		}
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteByte('\n')
+	}
+}
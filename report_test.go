@@ -0,0 +1,52 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+type countingStringer struct {
+	s string
+	n *int
+}
+
+func (c countingStringer) String() string {
+	*c.n++
+	return c.s
+}
+
+func TestReportRender(t *testing.T) {
+	calls := 0
+	r := Report{Condition: &Condition{}}
+	r.Printf("%s の在庫 report for the quarter", countingStringer{"東京", &calls})
+	r.Row("商品", "数量", "note")
+	r.Row("りんご", 120, "fresh from Aomori")
+	r.Row("みかん", 8, "")
+
+	wide := "東京 の在庫 report for the quarter\n" +
+		"商品    数量  note\n" +
+		"りんご  120   fresh from Aomori\n" +
+		"みかん  8\n"
+	if got := r.Render(80); got != wide {
+		t.Errorf("Render(80) =\n%s\nwant\n%s", got, wide)
+	}
+	narrow := "東京 の在庫 report\n" +
+		"for the quarter\n" +
+		"商品    数量  note\n" +
+		"りんご  120   fresh…\n" +
+		"みかん  8\n"
+	if got := r.Render(20); got != narrow {
+		t.Errorf("Render(20) =\n%s\nwant\n%s", got, narrow)
+	}
+	if got := r.Render(80); got != wide {
+		t.Errorf("Render(80) after Render(20) =\n%s", got)
+	}
+	if calls != 1 {
+		t.Errorf("operand formatted %d times want 1", calls)
+	}
+}
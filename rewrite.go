@@ -0,0 +1,160 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// A Directive is a formatting directive of a format string, such as
+// "%-10.3[2]s", split into its parts as written. Joining the parts, as
+// String does, gives back the directive.
+type Directive struct {
+	// Flags are the flag characters, "+-# 0=~|^>,_", in the order written,
+	// including the fill flag ' followed by its rune.
+	Flags string
+	// Width is the width: digits, "*" or "[n]*"; empty if absent.
+	Width string
+	// Dot reports whether a precision was given, even an empty one.
+	Dot bool
+	// Precision is the precision after the dot: digits, "*" or "[n]*".
+	Precision string
+	// Index is the explicit argument index of the verb, as in "[2]";
+	// empty if absent.
+	Index string
+	// Layout is the time layout in braces before the verb, as in
+	// %{15:04}t, without the braces; empty if absent.
+	Layout string
+	// Verb is the verb.
+	Verb rune
+}
+
+// String returns the directive as it is written in a format string.
+func (d Directive) String() string {
+	var b strings.Builder
+	b.WriteByte('%')
+	b.WriteString(d.Flags)
+	b.WriteString(d.Width)
+	if d.Dot {
+		b.WriteByte('.')
+		b.WriteString(d.Precision)
+	}
+	b.WriteString(d.Index)
+	if d.Layout != "" {
+		b.WriteByte('{')
+		b.WriteString(d.Layout)
+		b.WriteByte('}')
+	}
+	b.WriteRune(d.Verb)
+	return b.String()
+}
+
+// RewriteFormat returns format with each directive passed to rewrite and,
+// if rewrite returns true, replaced by the string it returns, so that
+// a wrapper can add widths, swap verbs or inject flags without parsing
+// the format itself:
+//
+//	format = wfmt.RewriteFormat(format, func(d wfmt.Directive) (string, bool) {
+//		if d.Verb != 's' || d.Width != "" {
+//			return "", false
+//		}
+//		d.Flags += "-"
+//		d.Width = "20"
+//		return d.String(), true
+//	})
+//
+// "%%" and a percent sign at the end of format, which has no verb, are
+// left as they are.
+func RewriteFormat(format string, rewrite func(Directive) (string, bool)) string {
+	var b strings.Builder
+	for i := 0; i < len(format); {
+		j := strings.IndexByte(format[i:], '%')
+		if j < 0 {
+			b.WriteString(format[i:])
+			break
+		}
+		b.WriteString(format[i : i+j])
+		i += j
+		d, n := parseDirective(format[i:])
+		if n == 0 || d.Verb == '%' && n == 2 {
+			if n == 0 {
+				n = len(format) - i
+			}
+			b.WriteString(format[i : i+n])
+			i += n
+			continue
+		}
+		if s, ok := rewrite(d); ok {
+			b.WriteString(s)
+		} else {
+			b.WriteString(format[i : i+n])
+		}
+		i += n
+	}
+	return b.String()
+}
+
+// parseDirective parses the directive at the start of s, which begins
+// with a percent sign, and returns it and its length, or a length of 0
+// if s ends before the verb.
+func parseDirective(s string) (d Directive, n int) {
+	i := 1
+	for i < len(s) && strings.IndexByte("+-# 0=~|^>,_'", s[i]) >= 0 {
+		if s[i] == '\'' && i+1 < len(s) {
+			_, size := utf8.DecodeRuneInString(s[i+1:])
+			i += size
+		}
+		i++
+	}
+	d.Flags = s[1:i]
+
+	// operand returns the end of a width or precision starting at i:
+	// digits, or a star optionally preceded by an argument index. An
+	// argument index followed by neither, which belongs to the verb,
+	// is left alone unless a precision follows.
+	operand := func(i int) int {
+		j := i
+		if j < len(s) && s[j] == '[' {
+			if k := strings.IndexByte(s[j:], ']'); k >= 0 {
+				j += k + 1
+			}
+			if j < len(s) && s[j] != '*' && s[j] != '.' && (s[j] < '0' || s[j] > '9') {
+				return i
+			}
+		}
+		if j < len(s) && s[j] == '*' {
+			return j + 1
+		}
+		for j < len(s) && '0' <= s[j] && s[j] <= '9' {
+			j++
+		}
+		return j
+	}
+
+	j := operand(i)
+	d.Width, i = s[i:j], j
+	if i < len(s) && s[i] == '.' {
+		d.Dot = true
+		j = operand(i + 1)
+		d.Precision, i = s[i+1:j], j
+	}
+	if i < len(s) && s[i] == '[' {
+		if k := strings.IndexByte(s[i:], ']'); k >= 0 {
+			d.Index, i = s[i:i+k+1], i+k+1
+		}
+	}
+	if i < len(s) && s[i] == '{' {
+		if k := strings.IndexByte(s[i:], '}'); k >= 0 {
+			d.Layout, i = s[i+1:i+k], i+k+1
+		}
+	}
+	if i >= len(s) {
+		return Directive{}, 0
+	}
+	r, size := utf8.DecodeRuneInString(s[i:])
+	d.Verb = r
+	return d, i + size
+}
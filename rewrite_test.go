@@ -0,0 +1,82 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+var parseDirectiveTests = []struct {
+	format string
+	d      Directive
+}{
+	{"%d", Directive{Verb: 'd'}},
+	{"%-10s", Directive{Flags: "-", Width: "10", Verb: 's'}},
+	{"%+#08.3f", Directive{Flags: "+#0", Width: "8", Dot: true, Precision: "3", Verb: 'f'}},
+	{"%[2]q", Directive{Index: "[2]", Verb: 'q'}},
+	{"%[1]*.[2]*[3]f", Directive{Width: "[1]*", Dot: true, Precision: "[2]*", Index: "[3]", Verb: 'f'}},
+	{"%*d", Directive{Width: "*", Verb: 'd'}},
+	{"%.s", Directive{Dot: true, Verb: 's'}},
+	{"%|=-6s", Directive{Flags: "|=-", Width: "6", Verb: 's'}},
+	{"%日", Directive{Verb: '日'}},
+	{"%'*-10s", Directive{Flags: "'*-", Width: "10", Verb: 's'}},
+	{"%-12[2]{15:04}t", Directive{Flags: "-", Width: "12", Index: "[2]", Layout: "15:04", Verb: 't'}},
+	{"%'　^8v", Directive{Flags: "'　^", Width: "8", Verb: 'v'}},
+}
+
+func TestRewriteFormatDirectives(t *testing.T) {
+	for _, tt := range parseDirectiveTests {
+		var got []Directive
+		out := RewriteFormat("<"+tt.format+">", func(d Directive) (string, bool) {
+			got = append(got, d)
+			return "", false
+		})
+		if out != "<"+tt.format+">" {
+			t.Errorf("RewriteFormat(%q) with no rewrite = %q", tt.format, out)
+		}
+		if len(got) != 1 || got[0] != tt.d {
+			t.Errorf("RewriteFormat(%q) passed %+v want %+v", tt.format, got, tt.d)
+			continue
+		}
+		if s := got[0].String(); s != tt.format {
+			t.Errorf("Directive(%q).String() = %q", tt.format, s)
+		}
+	}
+}
+
+var rewriteFormatTests = []struct {
+	format string
+	out    string
+}{
+	{"user=%s id=%d", "user=%-12s id=%x"},
+	{"%5s%%%v", "%5s%%%-12v"},
+	{"100%% %s", "100%% %-12s"},
+	{"%[2]s %[1]d", "%-12[2]s %[1]x"},
+	{"tail %", "tail %"},
+	{"tail %-", "tail %-"},
+	{"no verbs", "no verbs"},
+}
+
+func TestRewriteFormat(t *testing.T) {
+	rewrite := func(d Directive) (string, bool) {
+		switch {
+		case d.Verb == 'd':
+			d.Verb = 'x'
+		case (d.Verb == 's' || d.Verb == 'v') && d.Width == "":
+			d.Flags += "-"
+			d.Width = "12"
+		default:
+			return "", false
+		}
+		return d.String(), true
+	}
+	for _, tt := range rewriteFormatTests {
+		if got := RewriteFormat(tt.format, rewrite); got != tt.out {
+			t.Errorf("RewriteFormat(%q) = %q want %q", tt.format, got, tt.out)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lostsnow/wfmt"
+)
+
+type testState struct {
+	width   int
+	widthOK bool
+	prec    int
+	precOK  bool
+	flag    map[int]bool
+}
+
+var _ wfmt.State = testState{}
+
+func (s testState) Write(b []byte) (n int, err error) {
+	panic("unimplemented")
+}
+
+func (s testState) Width() (wid int, ok bool) {
+	return s.width, s.widthOK
+}
+
+func (s testState) Precision() (prec int, ok bool) {
+	return s.prec, s.precOK
+}
+
+func (s testState) Flag(c int) bool {
+	return s.flag[c]
+}
+
+const NO = -1000
+
+func mkState(w, p int, flags string) testState {
+	s := testState{}
+	if w != NO {
+		s.width = w
+		s.widthOK = true
+	}
+	if p != NO {
+		s.prec = p
+		s.precOK = true
+	}
+	s.flag = make(map[int]bool)
+	for _, c := range flags {
+		s.flag[int(c)] = true
+	}
+	return s
+}
+
+func TestFormatString(t *testing.T) {
+	var tests = []struct {
+		width, prec int
+		flags       string
+		result      string
+	}{
+		{NO, NO, "", "%x"},
+		{NO, 3, "", "%.3x"},
+		{3, NO, "", "%3x"},
+		{7, 3, "", "%7.3x"},
+		{NO, NO, " +-#0", "% +-#0x"},
+		{7, 3, "+", "%+7.3x"},
+		{7, -3, "-", "%-7.-3x"},
+		{7, 3, " ", "% 7.3x"},
+		{7, 3, "#", "%#7.3x"},
+		{7, 3, "0", "%07.3x"},
+		{7, 3, "=-", "%-=7.3x"},
+		{NO, 2, "~", "%~.2x"},
+		{6, NO, "|", "%|6x"},
+		{8, NO, "^", "%^8x"},
+	}
+	for _, test := range tests {
+		got := wfmt.FormatString(mkState(test.width, test.prec, test.flags), 'x')
+		if got != test.result {
+			t.Errorf("%v: got %s", test, got)
+		}
+	}
+}
+
+type directive struct{}
+
+func (directive) Format(f wfmt.State, verb rune) {
+	fmt.Fprint(f, wfmt.FormatString(f, verb))
+}
+
+func TestFormatStringState(t *testing.T) {
+	for _, format := range []string{"%v", "%-=8.2s", "%~5q", "%+|3d", "%^'*8s", "%-'　6v", "%>.5s", "%+,12d", "%#_x", "%-8{15:04}t"} {
+		if got := wfmt.Sprintf(format, directive{}); got != format {
+			t.Errorf("Sprintf(%q) = %q", format, got)
+		}
+	}
+}
+
+// runePadded is a Formatter written for package fmt that pads its
+// output to the width itself.
+type runePadded string
+
+func (r runePadded) Format(f fmt.State, verb rune) {
+	w, _ := f.Width()
+	if f.Flag('-') {
+		fmt.Fprintf(f, "%-*s", w, string(r))
+	} else {
+		fmt.Fprintf(f, "%*s", w, string(r))
+	}
+}
+
+// columnPadded pads through the ColumnState.
+type columnPadded string
+
+func (c columnPadded) Format(f fmt.State, verb rune) {
+	f.(wfmt.ColumnState).Pad(string(c))
+}
+
+func TestColumnState(t *testing.T) {
+	tests := []struct {
+		format string
+		arg    interface{}
+		out    string
+	}{
+		{"[%6v]", runePadded("日本"), "[  日本]"},
+		{"[%-6v]", runePadded("日本"), "[日本  ]"},
+		{"[%6v]", runePadded("abc"), "[   abc]"},
+		{"[%v]", runePadded("日本"), "[日本]"},
+		{"[%6v]", columnPadded("日本"), "[  日本]"},
+		{"[%-|6.3v]", columnPadded("日本語"), "[日    ]"},
+		{"[%|6v]", columnPadded("日本"), "[  日本]"},
+	}
+	for _, tt := range tests {
+		if got := wfmt.Sprintf(tt.format, tt.arg); got != tt.out {
+			t.Errorf("Sprintf(%q) = %q want %q", tt.format, got, tt.out)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "io"
+
+// streamChunk is the length of output at which the encodings of %x, %X
+// and %H are written out while they are formatted by the Fprint
+// functions.
+const streamChunk = 32 << 10
+
+// A sink is the writer of an Fprint function, to which a pp writes long
+// encodings in chunks as it formats them, so that formatting a huge
+// byte slice with %x takes memory in proportion to streamChunk rather
+// than to the slice.
+type sink struct {
+	w   io.Writer
+	n   int   // bytes written so far
+	err error // the first write error
+}
+
+// flush writes buf to s, unless an earlier write failed, and returns buf
+// emptied for reuse.
+func (s *sink) flush(buf buffer) buffer {
+	if s.err == nil {
+		var n int
+		n, s.err = write(s.w, buf)
+		s.n += n
+	}
+	return buf[:0]
+}
+
+// stream makes p write long encodings to w while formatting. It is only
+// for output written as it is formatted, which pr.streams reports.
+func (p *pp) stream(w io.Writer) {
+	p.sink = sink{w: w}
+	p.fmt.sink = &p.sink
+}
+
+// streams reports whether the output of pr can be written to its writer
+// piecemeal, without being processed as a whole first.
+func (pr *Printer) streams() bool {
+	return pr.Wrap == 0 && !pr.Accessible && pr.Annotations == nil && pr.MaxBytes <= 0 && len(pr.post) == 0
+}
+
+// writeOut writes out, the rest of the output of p, to w and returns the
+// number of bytes written in all and the first write error.
+func (p *pp) writeOut(w io.Writer, out []byte) (n int, err error) {
+	if p.fmt.sink == nil {
+		return write(w, out)
+	}
+	if p.sink.err != nil {
+		return p.sink.n, p.sink.err
+	}
+	n, err = write(w, out)
+	return p.sink.n + n, err
+}
+
+// write writes b to w. If w is an io.StringWriter, such as a
+// strings.Builder or bufio.Writer, b is passed to WriteString without
+// being converted, so w must not retain the string after the call.
+func write(w io.Writer, b []byte) (n int, err error) {
+	if sw, ok := w.(io.StringWriter); ok {
+		return sw.WriteString(bytesString(b))
+	}
+	return w.Write(b)
+}
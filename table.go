@@ -0,0 +1,367 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import "strings"
+
+// An Alignment places text within a column.
+type Alignment int
+
+const (
+	AlignLeft   Alignment = iota // text starts at the left of the column
+	AlignRight                   // text ends at the right of the column
+	AlignCenter                  // text is centered, the extra cell to the right
+	// AlignDecimal lines numbers up on their decimal points, padding
+	// their integral and fractional parts independently; a number
+	// without a point is aligned as if it ended in one. The cells are
+	// right-aligned under the header.
+	AlignDecimal
+	// AlignCurrency aligns numbers as AlignDecimal does, and the currency
+	// symbols before them on the left, as in "$   1.50" and "€ 120.00".
+	AlignCurrency
+)
+
+// A TableRule is a horizontal line of a TableBorder: its left corner, the
+// line itself, the junction under column separators and its right
+// corner. A rule whose line is zero is not drawn.
+type TableRule [4]rune
+
+// A TableBorder is the set of characters a Table is drawn with. Sides are
+// the left edge, the separator between columns and the right edge; a
+// zero side is not drawn. Top is drawn above the table, Rule under its
+// header and Bottom below it.
+type TableBorder struct {
+	Top, Rule, Bottom TableRule
+	Sides             [3]rune
+}
+
+// The borders of tables. The zero TableBorder draws none, separating
+// columns by two spaces.
+var (
+	ASCIIBorder = TableBorder{
+		Top:    TableRule{'+', '-', '+', '+'},
+		Rule:   TableRule{'+', '-', '+', '+'},
+		Bottom: TableRule{'+', '-', '+', '+'},
+		Sides:  [3]rune{'|', '|', '|'},
+	}
+	LightBorder = TableBorder{
+		Top:    TableRule{'┌', '─', '┬', '┐'},
+		Rule:   TableRule{'├', '─', '┼', '┤'},
+		Bottom: TableRule{'└', '─', '┴', '┘'},
+		Sides:  [3]rune{'│', '│', '│'},
+	}
+	HeavyBorder = TableBorder{
+		Top:    TableRule{'┏', '━', '┳', '┓'},
+		Rule:   TableRule{'┣', '━', '╋', '┫'},
+		Bottom: TableRule{'┗', '━', '┻', '┛'},
+		Sides:  [3]rune{'┃', '┃', '┃'},
+	}
+	MarkdownBorder = TableBorder{
+		Rule:  TableRule{'|', '-', '|', '|'},
+		Sides: [3]rune{'|', '|', '|'},
+	}
+)
+
+// A Table is a table of text, with an optional header, laid out in
+// columns as wide as their widest cells in display cells, so that CJK
+// text, emoji and colored text line up. Cells wider than the maximum
+// width of their column are truncated with a Tail, without splitting
+// grapheme clusters or escape sequences, or, with Wrap set, wrapped. A
+// cell may hold several lines, separated by newlines. The zero Table
+// has no header and no border.
+type Table struct {
+	// Condition measures cells; DefaultCondition if nil.
+	Condition *Condition
+	// Border is the set of characters the table is drawn with.
+	Border TableBorder
+	// Width, if positive, is the width of the widest table to draw,
+	// borders included. Columns are sized from their cells, within
+	// their maximum widths, and the widest narrowed until the table
+	// fits.
+	Width int
+	// Tail marks truncated cells; "…" if empty.
+	Tail string
+	// Wrap wraps cells wider than their columns onto more lines, as
+	// Condition.Wrap does, rather than truncating them.
+	Wrap bool
+
+	header []string
+	rows   [][]string
+	align  []Alignment
+	max    []int
+}
+
+// NewTable returns a Table with the given header, drawn with
+// LightBorder.
+func NewTable(header ...string) *Table {
+	return &Table{Border: LightBorder, header: header}
+}
+
+func (t *Table) cond() *Condition {
+	if t.Condition != nil {
+		return t.Condition
+	}
+	return DefaultCondition
+}
+
+// Row adds a row with a cell for each operand, formatted as by Sprint.
+func (t *Table) Row(cells ...interface{}) {
+	pr := Printer{Condition: t.cond()}
+	row := make([]string, len(cells))
+	for i, cell := range cells {
+		row[i] = pr.Sprint(cell)
+	}
+	t.rows = append(t.rows, row)
+}
+
+// Align sets the alignment of column col, counted from zero. Columns
+// are left-aligned unless set otherwise.
+func (t *Table) Align(col int, a Alignment) {
+	for len(t.align) <= col {
+		t.align = append(t.align, AlignLeft)
+	}
+	t.align[col] = a
+}
+
+// MaxWidth limits column col to width cells; zero removes the limit.
+func (t *Table) MaxWidth(col, width int) {
+	for len(t.max) <= col {
+		t.max = append(t.max, 0)
+	}
+	t.max[col] = width
+}
+
+// columns returns the widths of the columns of t, laying out rows.
+func (t *Table) columns(rows [][]string) []int {
+	cols := t.measure(make([]int, len(t.header)), t.header)
+	for _, row := range rows {
+		cols = t.measure(cols, row)
+	}
+	return t.fit(t.limit(cols))
+}
+
+// measure widens cols, the widths of columns, to fit the cells of row
+// and returns them.
+func (t *Table) measure(cols []int, row []string) []int {
+	c := t.cond()
+	for j, cell := range row {
+		if j == len(cols) {
+			cols = append(cols, 0)
+		}
+		for _, l := range strings.Split(cell, "\n") {
+			if w := c.StringWidth(l); w > cols[j] {
+				cols[j] = w
+			}
+		}
+	}
+	return cols
+}
+
+// limit narrows cols to the maximum widths of their columns.
+func (t *Table) limit(cols []int) []int {
+	for j, max := range t.max {
+		if j < len(cols) && max > 0 && cols[j] > max {
+			cols[j] = max
+		}
+	}
+	return cols
+}
+
+// fit narrows the widest of cols, one cell at a time, until the table
+// is no wider than t.Width.
+func (t *Table) fit(cols []int) []int {
+	if t.Width <= 0 {
+		return cols
+	}
+	total := t.frame(len(cols))
+	for _, w := range cols {
+		total += w
+	}
+	for total > t.Width {
+		widest := 0
+		for j, w := range cols {
+			if w > cols[widest] {
+				widest = j
+			}
+		}
+		if len(cols) == 0 || cols[widest] <= 1 {
+			break
+		}
+		cols[widest]--
+		total--
+	}
+	return cols
+}
+
+// frame returns the width of the borders and padding of a table of n
+// columns.
+func (t *Table) frame(n int) int {
+	c := t.cond()
+	sideWidth := func(r rune) int {
+		if r == 0 {
+			return 0
+		}
+		return c.RuneWidth(r)
+	}
+	w := 0
+	for j := 0; j < n; j++ {
+		w += sideWidth(t.side(j))
+		if before, after := t.pads(j, n); before && after {
+			w += 2
+		} else if before || after {
+			w++
+		}
+	}
+	if n > 0 {
+		w += sideWidth(t.Border.Sides[2])
+	}
+	return w
+}
+
+// tail returns the marker of truncated cells.
+func (t *Table) tail() string {
+	if t.Tail != "" {
+		return t.Tail
+	}
+	return ellipsis
+}
+
+// Render returns the table laid out, a line for each row and rule.
+func (t *Table) Render() string {
+	rows := t.alignDecimals(t.rows)
+	cols := t.columns(rows)
+	var b strings.Builder
+	t.rule(&b, t.Border.Top, cols)
+	if t.header != nil {
+		t.line(&b, t.header, cols)
+		t.rule(&b, t.Border.Rule, cols)
+	}
+	for _, row := range rows {
+		t.line(&b, row, cols)
+	}
+	t.rule(&b, t.Border.Bottom, cols)
+	return b.String()
+}
+
+// String returns the table as Render does.
+func (t *Table) String() string {
+	return t.Render()
+}
+
+// pads reports whether column j of n has a space before and after it:
+// columns are padded on the sides that adjoin a border or another
+// column.
+func (t *Table) pads(j, n int) (before, after bool) {
+	return j > 0 || t.Border.Sides[0] != 0, j < n-1 || t.Border.Sides[2] != 0
+}
+
+// side returns the side drawn before column j.
+func (t *Table) side(j int) rune {
+	if j == 0 {
+		return t.Border.Sides[0]
+	}
+	return t.Border.Sides[1]
+}
+
+// rule writes r drawn over columns of widths cols.
+func (t *Table) rule(b *strings.Builder, r TableRule, cols []int) {
+	if r[1] == 0 {
+		return
+	}
+	c := t.cond()
+	for j, w := range cols {
+		if t.side(j) != 0 {
+			if j == 0 {
+				b.WriteRune(r[0])
+			} else {
+				b.WriteRune(r[2])
+			}
+		}
+		before, after := t.pads(j, len(cols))
+		if before {
+			w++
+		}
+		if after {
+			w++
+		}
+		b.WriteString(c.fill(r[1], w))
+	}
+	if t.Border.Sides[2] != 0 {
+		b.WriteRune(r[3])
+	}
+	b.WriteByte('\n')
+}
+
+// line writes the cells of row in columns of widths cols. Cells of
+// several lines, or wrapped to several, make the row as tall as the
+// tallest, the other cells blank below their last line.
+func (t *Table) line(b *strings.Builder, row []string, cols []int) {
+	c := t.cond()
+	lines := make([][]string, len(cols))
+	height := 1
+	for j, w := range cols {
+		if j >= len(row) {
+			continue
+		}
+		if t.Wrap {
+			lines[j] = c.WrapLines(row[j], w)
+		} else {
+			lines[j] = strings.Split(row[j], "\n")
+		}
+		if len(lines[j]) > height {
+			height = len(lines[j])
+		}
+	}
+	cells := make([]string, len(cols))
+	for k := 0; k < height; k++ {
+		for j := range cells {
+			cells[j] = ""
+			if k < len(lines[j]) {
+				cells[j] = lines[j][k]
+			}
+		}
+		t.textLine(b, cells, cols)
+	}
+}
+
+// textLine writes a line of text with a cell for each column of widths
+// cols.
+func (t *Table) textLine(b *strings.Builder, cells []string, cols []int) {
+	c := t.cond()
+	var line strings.Builder
+	for j, w := range cols {
+		if side := t.side(j); side != 0 {
+			line.WriteRune(side)
+		}
+		before, after := t.pads(j, len(cols))
+		if before {
+			line.WriteByte(' ')
+		}
+		cell := c.Truncate(cells[j], w, t.tail())
+		align := AlignLeft
+		if j < len(t.align) {
+			align = t.align[j]
+		}
+		switch align {
+		case AlignRight, AlignDecimal, AlignCurrency:
+			cell = c.PadLeft(cell, w, ' ')
+		case AlignCenter:
+			cell = c.Center(cell, w, ' ')
+		default:
+			cell = c.PadRight(cell, w, ' ')
+		}
+		line.WriteString(cell)
+		if after {
+			line.WriteByte(' ')
+		}
+	}
+	if t.Border.Sides[2] != 0 {
+		line.WriteRune(t.Border.Sides[2])
+		b.WriteString(line.String())
+	} else {
+		b.WriteString(strings.TrimRight(line.String(), " "))
+	}
+	b.WriteByte('\n')
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func newTestTable(border TableBorder) *Table {
+	t := NewTable("名前", "Qty", "Note")
+	t.Border = border
+	t.Align(1, AlignRight)
+	t.Row("寿司", 12, "🍣 fresh")
+	t.Row("\x1b[1mtea\x1b[0m", 3, "")
+	return t
+}
+
+func TestTableBorders(t *testing.T) {
+	tests := []struct {
+		name   string
+		border TableBorder
+		want   string
+	}{
+		{"light", LightBorder, "" +
+			"┌──────┬─────┬──────────┐\n" +
+			"│ 名前 │ Qty │ Note     │\n" +
+			"├──────┼─────┼──────────┤\n" +
+			"│ 寿司 │  12 │ 🍣 fresh │\n" +
+			"│ \x1b[1mtea\x1b[0m  │   3 │          │\n" +
+			"└──────┴─────┴──────────┘\n"},
+		{"heavy", HeavyBorder, "" +
+			"┏━━━━━━┳━━━━━┳━━━━━━━━━━┓\n" +
+			"┃ 名前 ┃ Qty ┃ Note     ┃\n" +
+			"┣━━━━━━╋━━━━━╋━━━━━━━━━━┫\n" +
+			"┃ 寿司 ┃  12 ┃ 🍣 fresh ┃\n" +
+			"┃ \x1b[1mtea\x1b[0m  ┃   3 ┃          ┃\n" +
+			"┗━━━━━━┻━━━━━┻━━━━━━━━━━┛\n"},
+		{"ascii", ASCIIBorder, "" +
+			"+------+-----+----------+\n" +
+			"| 名前 | Qty | Note     |\n" +
+			"+------+-----+----------+\n" +
+			"| 寿司 |  12 | 🍣 fresh |\n" +
+			"| \x1b[1mtea\x1b[0m  |   3 |          |\n" +
+			"+------+-----+----------+\n"},
+		{"markdown", MarkdownBorder, "" +
+			"| 名前 | Qty | Note     |\n" +
+			"|------|-----|----------|\n" +
+			"| 寿司 |  12 | 🍣 fresh |\n" +
+			"| \x1b[1mtea\x1b[0m  |   3 |          |\n"},
+		{"none", TableBorder{}, "" +
+			"名前  Qty  Note\n" +
+			"寿司   12  🍣 fresh\n" +
+			"\x1b[1mtea\x1b[0m     3\n"},
+	}
+	for _, tt := range tests {
+		if got := newTestTable(tt.border).Render(); got != tt.want {
+			t.Errorf("%s border:\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTableMaxWidth(t *testing.T) {
+	tab := &Table{Border: ASCIIBorder}
+	tab.MaxWidth(0, 5)
+	tab.Align(1, AlignCenter)
+	tab.Row("日本語の説明", "x")
+	tab.Row("ok", "abc")
+	want := "" +
+		"+-------+-----+\n" +
+		"| 日本… |  x  |\n" +
+		"| ok    | abc |\n" +
+		"+-------+-----+\n"
+	if got := tab.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTableAlignDecimal(t *testing.T) {
+	tab := NewTable("Item", "Value", "Price")
+	tab.Border = ASCIIBorder
+	tab.Align(1, AlignDecimal)
+	tab.Align(2, AlignCurrency)
+	tab.Row("a", "3.14159", "$1.50")
+	tab.Row("b", "1200", "￥300")
+	tab.Row("c", "-0.5", "€ 12.25")
+	tab.Row("d", "12%", "CHF 1,000")
+	want := "" +
+		"+------+------------+--------------+\n" +
+		"| Item |      Value |        Price |\n" +
+		"+------+------------+--------------+\n" +
+		"| a    |    3.14159 | $       1.50 |\n" +
+		"| b    | 1200       | ￥    300    |\n" +
+		"| c    |   -0.5     | €      12.25 |\n" +
+		"| d    |   12%      | CHF 1,000    |\n" +
+		"+------+------------+--------------+\n"
+	if got := tab.Render(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	md := "" +
+		"| Item |      Value |        Price |\n" +
+		"|:-----|-----------:|-------------:|\n"
+	if got := tab.Markdown(MarkdownAlign); !strings.HasPrefix(got, md) {
+		t.Errorf("Markdown:\n%s\nwant prefix\n%s", got, md)
+	}
+}
+
+func TestTableWidth(t *testing.T) {
+	tab := NewTable("ID", "説明", "Tag")
+	tab.Tail = "~"
+	tab.MaxWidth(2, 4)
+	tab.Row(1, "👩‍👩‍👧 family emoji and a long description", "alpha-beta")
+	tab.Row(2, "短い", "x")
+	natural := tab.Render()
+	if w := DefaultCondition.StringWidth(natural[:strings.IndexByte(natural, '\n')]); w != 54 {
+		t.Errorf("natural width = %d\n%s", w, natural)
+	}
+	tab.Width = 30
+	want := "" +
+		"┌────┬────────────────┬──────┐\n" +
+		"│ ID │ 説明           │ Tag  │\n" +
+		"├────┼────────────────┼──────┤\n" +
+		"│ 1  │ 👩‍👩‍👧 family emo~ │ alp~ │\n" +
+		"│ 2  │ 短い           │ x    │\n" +
+		"└────┴────────────────┴──────┘\n"
+	if got := tab.Render(); got != want {
+		t.Errorf("Width 30:\n%s\nwant\n%s", got, want)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(tab.Render(), "\n"), "\n") {
+		if w := DefaultCondition.StringWidth(line); w != 30 {
+			t.Errorf("line %q is %d cells wide", line, w)
+		}
+	}
+}
+
+func TestTableMultiLine(t *testing.T) {
+	tab := NewTable("Key", "Description")
+	tab.Border = ASCIIBorder
+	tab.MaxWidth(1, 12)
+	tab.Wrap = true
+	tab.Row("ja", "日本語の長い説明文がここに入ります")
+	tab.Row("two\nlines", "short")
+	want := "" +
+		"+-------+--------------+\n" +
+		"| Key   | Description  |\n" +
+		"+-------+--------------+\n" +
+		"| ja    | 日本語の長い |\n" +
+		"|       | 説明文がここ |\n" +
+		"|       | に入ります   |\n" +
+		"| two   | short        |\n" +
+		"| lines |              |\n" +
+		"+-------+--------------+\n"
+	if got := tab.Render(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Without Wrap, each line of a cell is truncated.
+	tab.Wrap = false
+	if got := tab.Render(); !strings.Contains(got, "| ja    | 日本語の長…  |\n") {
+		t.Errorf("without Wrap:\n%s", got)
+	}
+
+	// Markdown rows are single lines.
+	if got := tab.Markdown(0); !strings.Contains(got, "| two<br>lines | short") {
+		t.Errorf("Markdown:\n%s", got)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"io"
+	"os"
+	"strconv"
+)
+
+// fder is implemented by writers backed by a file descriptor, such as *os.File.
+type fder interface {
+	Fd() uintptr
+}
+
+// writerWidth returns the width in cells of the terminal w writes to,
+// or 0 if w is not a terminal.
+func writerWidth(w io.Writer) int {
+	if f, ok := w.(fder); ok {
+		if cols, _, ok := terminalSize(f.Fd()); ok {
+			return cols
+		}
+	}
+	return 0
+}
+
+// wrapWidth returns the width at which to wrap output written to w:
+// $COLUMNS if it is set to a positive number, otherwise the width of
+// the terminal w writes to, or 0 if w is not a terminal.
+func wrapWidth(w io.Writer) int {
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	return writerWidth(w)
+}
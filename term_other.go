@@ -0,0 +1,19 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package wfmt
+
+// terminalSize always reports that fd is not a terminal on platforms
+// without a known way to query one.
+func terminalSize(fd uintptr) (cols, rows int, ok bool) {
+	return 0, 0, false
+}
+
+// consoleCodePage returns 0: only Windows consoles have code pages.
+func consoleCodePage() int {
+	return 0
+}
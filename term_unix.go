@@ -0,0 +1,34 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package wfmt
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	row, col       uint16
+	xpixel, ypixel uint16
+}
+
+// terminalSize returns the dimensions of the terminal open on fd.
+// ok is false if fd does not refer to a terminal.
+func terminalSize(fd uintptr) (cols, rows int, ok bool) {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0, 0, false
+	}
+	return int(ws.col), int(ws.row), true
+}
+
+// consoleCodePage returns 0: only Windows consoles have code pages.
+func consoleCodePage() int {
+	return 0
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                       = syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+	procGetConsoleOutputCP         = kernel32.NewProc("GetConsoleOutputCP")
+)
+
+type coord struct {
+	x, y int16
+}
+
+type smallRect struct {
+	left, top, right, bottom int16
+}
+
+type consoleScreenBufferInfo struct {
+	size              coord
+	cursorPosition    coord
+	attributes        uint16
+	window            smallRect
+	maximumWindowSize coord
+}
+
+// terminalSize returns the dimensions of the console window open on fd.
+// ok is false if fd does not refer to a console.
+func terminalSize(fd uintptr) (cols, rows int, ok bool) {
+	var info consoleScreenBufferInfo
+	r, _, _ := procGetConsoleScreenBufferInfo.Call(fd, uintptr(unsafe.Pointer(&info)))
+	if r == 0 {
+		return 0, 0, false
+	}
+	cols = int(info.window.right-info.window.left) + 1
+	rows = int(info.window.bottom-info.window.top) + 1
+	return cols, rows, true
+}
+
+// consoleCodePage returns the output code page of the console, or 0 if
+// the process has no console.
+func consoleCodePage() int {
+	cp, _, _ := procGetConsoleOutputCP.Call()
+	return int(cp)
+}
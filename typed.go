@@ -0,0 +1,128 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// A typed is the operand of Sprintf1 and the like. It is held in the pp
+// that prints it, so that passing it to doPrintf as an interface{} does
+// not allocate, and is boxed as the value it holds only for the verbs
+// and the diagnostics that need its type.
+type typed struct {
+	kind reflect.Kind
+	u    uint64 // bools, integers and the bits of floats
+	s    string
+}
+
+// value returns the operand t holds.
+func (t *typed) value() interface{} {
+	switch t.kind {
+	case reflect.Bool:
+		return t.u != 0
+	case reflect.Int:
+		return int(t.u)
+	case reflect.Int8:
+		return int8(t.u)
+	case reflect.Int16:
+		return int16(t.u)
+	case reflect.Int32:
+		return int32(t.u)
+	case reflect.Int64:
+		return int64(t.u)
+	case reflect.Uint:
+		return uint(t.u)
+	case reflect.Uint8:
+		return uint8(t.u)
+	case reflect.Uint16:
+		return uint16(t.u)
+	case reflect.Uint32:
+		return uint32(t.u)
+	case reflect.Uint64:
+		return t.u
+	case reflect.Uintptr:
+		return uintptr(t.u)
+	case reflect.Float32:
+		return float32(math.Float64frombits(t.u))
+	case reflect.Float64:
+		return math.Float64frombits(t.u)
+	}
+	return t.s
+}
+
+// print formats the operand t holds as printArg would.
+func (t *typed) print(p *pp, verb rune) {
+	switch t.kind {
+	case reflect.Bool:
+		p.fmtBool(t.u != 0, verb)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		p.fmtInteger(t.u, signed, verb)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		p.fmtInteger(t.u, unsigned, verb)
+	case reflect.Float32:
+		p.fmtFloat(math.Float64frombits(t.u), 32, verb)
+	case reflect.Float64:
+		p.fmtFloat(math.Float64frombits(t.u), 64, verb)
+	default:
+		p.fmtString(t.s, verb)
+	}
+}
+
+// typedPrinter returns a pp for printing format with a typed operand and
+// the configuration set by SetConfig, if any. The pp is nil if the
+// operand must be boxed after all: when it is passed to a Redact
+// function, or when format takes it as a width or precision or leaves it
+// over as an extra operand.
+func typedPrinter(format string) (*Printer, *pp) {
+	pr := configured()
+	if pr != nil && pr.Redact != nil || !takesOperand(format) {
+		return pr, nil
+	}
+	if pr == nil {
+		return nil, newPrinter()
+	}
+	return pr, pr.newPrinter()
+}
+
+// printTyped formats the typed operand of p according to format and
+// returns the output as pr would write it to w, which is nil for the
+// Sprint functions. The result is valid until p is freed.
+func (p *pp) printTyped(pr *Printer, format string, w io.Writer) []byte {
+	p.typedArgs[0] = &p.typed
+	p.doPrintf(format, p.typedArgs[:])
+	p.typedArgs[0] = nil
+	if pr == nil {
+		return p.buf
+	}
+	return pr.output(p, w)
+}
+
+// takesOperand reports whether format prints a single operand with a
+// verb, rather than taking it as a width or precision or reporting it as
+// an extra operand.
+func takesOperand(format string) bool {
+	ok := false
+	for i := 0; i < len(format); {
+		j := strings.IndexByte(format[i:], '%')
+		if j < 0 {
+			break
+		}
+		i += j
+		d, n := parseDirective(format[i:])
+		if n == 0 {
+			break
+		}
+		if strings.IndexByte(d.Width+d.Precision, '*') >= 0 {
+			return false
+		}
+		ok = ok || d.Verb != '%' || d.Index != ""
+		i += n
+	}
+	return ok
+}
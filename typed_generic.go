@@ -0,0 +1,106 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package wfmt
+
+import (
+	"io"
+	"math"
+	"reflect"
+)
+
+// Scalar is the constraint of the operands of Sprintf1, Appendf1 and
+// Fprintf1: the predeclared boolean, integer, floating-point and string
+// types. Named types are left out because their methods, such as
+// String, take part in formatting them.
+type Scalar interface {
+	bool | int | int8 | int16 | int32 | int64 |
+		uint | uint8 | uint16 | uint32 | uint64 | uintptr |
+		float32 | float64 | string
+}
+
+// setTyped stores v in t.
+func setTyped[T Scalar](t *typed, v T) {
+	switch v := any(v).(type) {
+	case bool:
+		t.kind, t.u = reflect.Bool, 0
+		if v {
+			t.u = 1
+		}
+	case int:
+		t.kind, t.u = reflect.Int, uint64(v)
+	case int8:
+		t.kind, t.u = reflect.Int8, uint64(v)
+	case int16:
+		t.kind, t.u = reflect.Int16, uint64(v)
+	case int32:
+		t.kind, t.u = reflect.Int32, uint64(v)
+	case int64:
+		t.kind, t.u = reflect.Int64, uint64(v)
+	case uint:
+		t.kind, t.u = reflect.Uint, uint64(v)
+	case uint8:
+		t.kind, t.u = reflect.Uint8, uint64(v)
+	case uint16:
+		t.kind, t.u = reflect.Uint16, uint64(v)
+	case uint32:
+		t.kind, t.u = reflect.Uint32, uint64(v)
+	case uint64:
+		t.kind, t.u = reflect.Uint64, v
+	case uintptr:
+		t.kind, t.u = reflect.Uintptr, uint64(v)
+	case float32:
+		t.kind, t.u = reflect.Float32, math.Float64bits(float64(v))
+	case float64:
+		t.kind, t.u = reflect.Float64, math.Float64bits(v)
+	case string:
+		t.kind, t.s = reflect.String, v
+	}
+}
+
+// Sprintf1 is Sprintf with the single operand v. Unlike Sprintf, it
+// does not box v into an interface{}, which allocates for most values,
+// so that formatting a number in a tight loop costs only the allocation
+// of the result.
+func Sprintf1[T Scalar](format string, v T) string {
+	pr, p := typedPrinter(format)
+	if p == nil {
+		return Sprintf(format, v)
+	}
+	setTyped(&p.typed, v)
+	s := string(p.printTyped(pr, format, nil))
+	p.free()
+	return s
+}
+
+// Appendf1 is Appendf with the single operand v. Like Sprintf1, it does
+// not box v, and it allocates nothing when b has room for the output.
+func Appendf1[T Scalar](b []byte, format string, v T) []byte {
+	pr, p := typedPrinter(format)
+	if p == nil {
+		return Appendf(b, format, v)
+	}
+	setTyped(&p.typed, v)
+	b = append(b, p.printTyped(pr, format, nil)...)
+	p.free()
+	return b
+}
+
+// Fprintf1 is Fprintf with the single operand v, which it does not box.
+func Fprintf1[T Scalar](w io.Writer, format string, v T) (n int, err error) {
+	pr, p := typedPrinter(format)
+	if p == nil {
+		return Fprintf(w, format, v)
+	}
+	if pr == nil || pr.streams() {
+		p.stream(w)
+	}
+	setTyped(&p.typed, v)
+	n, err = p.writeOut(w, p.printTyped(pr, format, w))
+	p.free()
+	return
+}
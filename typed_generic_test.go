@@ -0,0 +1,86 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package wfmt_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+var typedFormats = []string{
+	"%v", "%d", "%5d|", "%-8.3f|", "%x", "%#v", "%T", "%s", "%q", "%t",
+	"%j", "%p", "%,d", "%^9s|", "[%[1]v %[1]T]", "%d %d", "no verb", "%%",
+	"%*d", "%.*f", "%!", "%",
+}
+
+func checkTyped[T Scalar](t *testing.T, v T) {
+	t.Helper()
+	for _, format := range typedFormats {
+		want := Sprintf(format, v)
+		if got := Sprintf1(format, v); got != want {
+			t.Errorf("Sprintf1(%q, %T(%v)) = %q want %q", format, v, v, got, want)
+		}
+		if got := string(Appendf1([]byte("> "), format, v)); got != "> "+want {
+			t.Errorf("Appendf1(%q, %T(%v)) = %q", format, v, v, got)
+		}
+		var b bytes.Buffer
+		if n, err := Fprintf1(&b, format, v); n != len(want) || err != nil || b.String() != want {
+			t.Errorf("Fprintf1(%q, %T(%v)) = %d, %v, %q", format, v, v, n, err, b.String())
+		}
+	}
+}
+
+func TestTypedHelpers(t *testing.T) {
+	checkTyped(t, true)
+	checkTyped(t, -1234567)
+	checkTyped(t, int8(-8))
+	checkTyped(t, int16(300))
+	checkTyped(t, int32(-70000))
+	checkTyped(t, int64(1)<<40)
+	checkTyped(t, uint(7))
+	checkTyped(t, uint8(200))
+	checkTyped(t, uint16(0xbeef))
+	checkTyped(t, uint32(1)<<31)
+	checkTyped(t, ^uint64(0))
+	checkTyped(t, uintptr(0x1000))
+	checkTyped(t, float32(2.5))
+	checkTyped(t, 3.14159)
+	checkTyped(t, "日本語")
+	checkTyped(t, "\xff")
+}
+
+func TestTypedHelpersConfig(t *testing.T) {
+	defer SetConfig(nil)
+	SetConfig(&Printer{GroupSeparator: ".", MaxBytes: 6})
+	if got, want := Sprintf1("%,d", 1234567), Sprintf("%,d", 1234567); got != want || got != "1.2…" {
+		t.Errorf("Sprintf1 = %q want %q", got, want)
+	}
+	SetConfig(&Printer{Redact: func(arg interface{}) (interface{}, bool) { return "***", true }})
+	if got := Sprintf1("%v", 42); got != "***" {
+		t.Errorf("Sprintf1 with Redact = %q", got)
+	}
+}
+
+func TestTypedHelpersAllocs(t *testing.T) {
+	buf := make([]byte, 0, 64)
+	tests := []struct {
+		name string
+		f    func()
+	}{
+		{"int", func() { buf = Appendf1(buf[:0], "n=%8d", 123456789) }},
+		{"float64", func() { buf = Appendf1(buf[:0], "%-10.3f|", 2.71828) }},
+		{"string", func() { buf = Appendf1(buf[:0], "%q", "日本") }},
+	}
+	for _, tt := range tests {
+		if n := testing.AllocsPerRun(100, tt.f); n > 0 {
+			t.Errorf("Appendf1 %s allocates %v times per call", tt.name, n)
+		}
+	}
+}
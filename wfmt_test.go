@@ -5,10 +5,15 @@
 package wfmt_test
 
 import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
 	"math"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/lostsnow/wfmt"
 )
@@ -57,6 +62,27 @@ var fmtTests = []struct {
 	{"%5s", "啊啊", " 啊啊"},
 	{"%5s", "abc", "  abc"},
 	{"%2s", "\u263a", "☺"},
+	{"%5s", "a\u200bb", "   a\u200bb"},
+	{"%-5s", "\ufeff啊b", "\ufeff啊b  "},
+	{"%6s", "\u200c\u200d啊", "    \u200c\u200d啊"},
+	{"%-10s|", "\x1b[31mエラー\x1b[0m", "\x1b[31mエラー\x1b[0m    |"},
+	{"%8s", "\x1b[1;32mok\x1b[m", "      \x1b[1;32mok\x1b[m"},
+	{"%8s", "\u009b7mab", "      \u009b7mab"},
+	{"%.2s", "\x1b[31mエラー\x1b[0m", "\x1b[31mエラ\x1b[0m"},
+	{"%-5.1s|", []byte("\x1b[4m日本"), "\x1b[4m日\x1b[0m   |"},
+	{"%.3s", "\x1b[31mab\x1b[0mcdef", "\x1b[31mab\x1b[0mc"},
+	{"%.2s", "\x1b]8;;https://go.dev\x1b\\link\x1b]8;;\x1b\\", "\x1b]8;;https://go.dev\x1b\\li\x1b]8;;\x1b\\"},
+	{"%-10s|", "\x1b]8;;https://example.com\x1b\\リンク\x1b]8;;\x1b\\", "\x1b]8;;https://example.com\x1b\\リンク\x1b]8;;\x1b\\    |"},
+	{"%6s|", "\x1b]8;id=1;http://a\ahere\x1b]8;;\a", "  \x1b]8;id=1;http://a\ahere\x1b]8;;\a|"},
+	{"%.2s|", "\x1b]8;;http://a\aabc\x1b]8;;\a", "\x1b]8;;http://a\aab\x1b]8;;\x1b\\|"},
+	{"%a", []byte("key-1"), "key-1"},
+	{"%a", []byte("日本\xff\x00"), `日本\xff\x00`},
+	{"%-12a|", []byte("a\\b\n\xfe"), `a\\b\n\xfe  |`},
+	{"%8a|", "ok\x80", `  ok\x80|`},
+	{"%.5a|", []byte("ab\xffcd"), `ab|`},
+	{"%.6a|", []byte("日本語"), `日本語|`},
+	{"%.5a|", []byte("日本語"), `日本|`},
+	{"%a", 42, "%!a(int=42)"},
 	{"%-5s", "abc", "abc  "},
 	{"%-8q", "abc", `"abc"   `},
 	{"%05s", "abc", "00abc"},
@@ -489,3 +515,890 @@ func TestWidthAndPrecision(t *testing.T) {
 		}
 	}
 }
+
+var controlTests = []struct {
+	policy ControlPolicy
+	fmt    string
+	val    interface{}
+	out    string
+}{
+	{ControlZero, "%-5s|", "a\rb", "a\rb   |"},
+	{ControlOne, "%-5s|", "a\rb", "a\rb  |"},
+	{ControlOne, "%5s|", "\x00\x85", "   \x00\x85|"},
+	{ControlEscape, "%-8s|", "a\rb", `a\rb    |`},
+	{ControlEscape, "%-8s|", []byte("\x1b啊"), `\x1b啊  |`},
+	{ControlEscape, "%-8s|", "\u0085", `\u0085  |`},
+	{ControlEscape, "%s", "a\tb\n", "a\tb\n"},
+	{ControlEscape, "%-6s|", "\x1b[1mab\x1b[0m\r", "\x1b[1mab\x1b[0m\\r  |"},
+}
+
+func TestControlPolicy(t *testing.T) {
+	defer func(p ControlPolicy) { DefaultCondition.Control = p }(DefaultCondition.Control)
+	for _, tt := range controlTests {
+		DefaultCondition.Control = tt.policy
+		if s := Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("policy %d: Sprintf(%q, %q) = %q want %q", tt.policy, tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var invalidTests = []struct {
+	policy    InvalidPolicy
+	eastAsian bool
+	fmt       string
+	val       interface{}
+	out       string
+}{
+	{InvalidKeep, false, "%-4s|", "a\xffb", "a\xffb |"},
+	{InvalidReplace, false, "%-4s|", "a\xffb", "a�b |"},
+	{InvalidReplace, true, "%-5s|", "a\xffb", "a�b |"},
+	{InvalidHex, false, "%-8s|", []byte("a\xffb"), `a\xffb  |`},
+	{InvalidHex, false, "%s", "日本", "日本"},
+	{InvalidStrict, false, "[%s]", "a\xff", `[%!s(BADUTF8="a\xff")]`},
+	{InvalidStrict, false, "[%v]", []byte("\xfe"), `[[254]]`},
+	{InvalidStrict, false, "[%s]", []byte("\xfe"), `[%!s(BADUTF8="\xfe")]`},
+	{InvalidStrict, false, "%q", "\xff", `"\xff"`},
+	{InvalidStrict, false, "%5s", "ok", "   ok"},
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	for _, tt := range invalidTests {
+		pr := Printer{Condition: &Condition{Invalid: tt.policy, EastAsian: tt.eastAsian}}
+		if s := pr.Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("policy %d: Sprintf(%q, %q) = %q want %q", tt.policy, tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var lineTests = []struct {
+	policy LinePolicy
+	fmt    string
+	val    interface{}
+	out    string
+}{
+	{LinesWhole, "%-8s|", "日本\n中", "日本\n中  |"},
+	{LinesLongest, "%-8s|", "日本\n中", "日本\n中    |"},
+	{LinesLongest, "%8s|", "日本\n中", "    日本\n中|"},
+	{LinesEach, "%-6s|", "日本\n中\nabc", "日本  \n中    \nabc   |"},
+	{LinesEach, "%6s|", []byte("日本\n中"), "  日本\n    中|"},
+	{LinesEach, "%s|", "日本\n中", "日本\n中|"},
+	{LinesWhole, "%#-6s|", "日本\n中", "日本  \n中    |"},
+	{LinesLongest, "%#6s|", []byte("日本\n中"), "  日本\n    中|"},
+	{LinesWhole, "%#s|", "日本\n中", "日本\n中|"},
+}
+
+func TestLinePolicy(t *testing.T) {
+	for _, tt := range lineTests {
+		pr := Printer{Condition: &Condition{Lines: tt.policy}}
+		if s := pr.Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("policy %d: Sprintf(%q, %q) = %q want %q", tt.policy, tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var unitTests = []struct {
+	unit WidthUnit
+	fmt  string
+	val  interface{}
+	out  string
+}{
+	{UnitDefault, "%-8.3s|", "日本語です", "日本語  |"},
+	{UnitColumns, "%-8.3s|", "日本語です", "日      |"},
+	{UnitColumns, "%.3s|", "e\u0301e\u0301e\u0301e\u0301", "e\u0301e\u0301e\u0301|"},
+	{UnitRunes, "%-8.3s|", "日本語です", "日本語     |"},
+	{UnitBytes, "%-8.4s|", "日本語です", "日     |"},
+	{UnitBytes, "%-8s|", []byte("\x1b[1mé\x1b[0m"), "\x1b[1mé\x1b[0m      |"},
+	{UnitDefault, "%=-8.4s|", "日本語です", "日     |"},
+	{UnitDefault, "%~-8s|", "日本", "日本      |"},
+	{UnitBytes, "%|-8.3s|", []byte("日本語です"), "日      |"},
+	{UnitBytes, "%5d|", 42, "   42|"},
+}
+
+func TestWidthUnits(t *testing.T) {
+	for _, tt := range unitTests {
+		pr := Printer{Condition: &Condition{Units: tt.unit}}
+		if s := pr.Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("units %d: Sprintf(%q, %q) = %q want %q", tt.unit, tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+// The width flags choose the units of each directive, so one format can
+// align by runes for a legacy file and by columns for a terminal.
+func TestMixedWidthUnits(t *testing.T) {
+	const want = "日本    |日本  |"
+	if s := Sprintf("%~-6s|%|-6s|", "日本", "日本"); s != want {
+		t.Errorf("Sprintf = %q want %q", s, want)
+	}
+	if s := Sprintf("%~-6[1]s|%|-6[1]s|", "日本"); s != want {
+		t.Errorf("Sprintf with indexes = %q want %q", s, want)
+	}
+}
+
+var centerTests = []struct {
+	fmt string
+	val interface{}
+	out string
+}{
+	{"[%^8s]", "日本", "[  日本  ]"},
+	{"[%^7s]", "日本", "[ 日本  ]"},
+	{"[%^8s]", "toolongvalue", "[toolongvalue]"},
+	{"[%^-8s]", "ab", "[   ab   ]"},
+	{"[%^08d]", 42, "[   42   ]"},
+	{"[%0^8d]", -42, "[  -42   ]"},
+	{"[%^9.2f]", 3.14159, "[  3.14   ]"},
+	{"[%^8v]", true, "[  true  ]"},
+	{"[%^8x]", "日", "[ e697a5 ]"},
+	{"[%^#6s]", "a\nbcd", "[  a   \n bcd  ]"},
+	{"[%^~8.1s]", "日本", "[   日    ]"},
+}
+
+func TestCenterFlag(t *testing.T) {
+	pr := Printer{Condition: &Condition{}}
+	for _, tt := range centerTests {
+		if s := pr.Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var fillTests = []struct {
+	fmt string
+	val interface{}
+	out string
+}{
+	{"[%'*8s]", "ab", "[******ab]"},
+	{"[%-'.8s]", "名前", "[名前....]"},
+	{"[%'　8s]", "x", "[　　　 x]"},
+	{"[%-'　7s]", "名前", "[名前　 ]"},
+	{"[%'*^8s]", "ab", "[***ab***]"},
+	{"[%'*8d]", -42, "[*****-42]"},
+	{"[%0'*8d]", 42, "[******42]"},
+	{"[%'08d]", 42, "[00000042]"},
+	{"[%'*8.1f]", 2.5, "[*****2.5]"},
+	{"[%'*~5s]", "日本", "[***日本]"},
+	{"[%'*s]", "ab", "[ab]"},
+	{"[%'日6s]", "ab", "[日日ab]"},
+}
+
+func TestFillFlag(t *testing.T) {
+	pr := Printer{Condition: &Condition{}}
+	for _, tt := range fillTests {
+		if s := pr.Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var ellipsisTests = []struct {
+	cond *Condition
+	fmt  string
+	val  interface{}
+	out  string
+}{
+	{&Condition{}, "[%>.5s]", "hello world", "[hell…]"},
+	{&Condition{}, "[%>.5s]", "hello", "[hello]"},
+	{&Condition{}, "[%>.3s]", []byte("abcdef"), "[ab…]"},
+	{&Condition{}, "[%>|-8.5s]", "日本語です", "[日本…   ]"},
+	{&Condition{}, "[%>|.1s]", "日本", "[…]"},
+	{&Condition{EastAsian: true}, "[%>|.1s]", "日本", "[]"},
+	{&Condition{EastAsian: true}, "[%>|.5s]", "日本語です", "[日…]"},
+	{&Condition{}, "[%>.5q]", "hello world", `["hell…"]`},
+	{&Condition{Ellipsis: "..."}, "[%>.6s]", "hello world", "[hel...]"},
+	{&Condition{Ellipsis: "..."}, "[%>.2s]", "hello", "[he]"},
+	{&Condition{}, "[%>.3s]", "\x1b[1mbold\x1b[0m", "[\x1b[1mbo\x1b[0m…]"},
+	{&Condition{StyledTail: true}, "[%>.3s]", "\x1b[1mbold\x1b[0m", "[\x1b[1mbo…\x1b[0m]"},
+	{&Condition{}, "[%.5s]", "hello world", "[hello]"},
+}
+
+func TestEllipsisFlag(t *testing.T) {
+	for _, tt := range ellipsisTests {
+		pr := Printer{Condition: tt.cond}
+		if s := pr.Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %q) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var groupingTests = []struct {
+	pr  Printer
+	fmt string
+	val interface{}
+	out string
+}{
+	{Printer{}, "%,d", 1234567, "1,234,567"},
+	{Printer{}, "%,d", -1234567, "-1,234,567"},
+	{Printer{}, "%,d", 123, "123"},
+	{Printer{}, "%,v", uint64(1 << 40), "1,099,511,627,776"},
+	{Printer{}, "[%,12d]", 1234567, "[   1,234,567]"},
+	{Printer{}, "[%-,12d]", 1234567, "[1,234,567   ]"},
+	{Printer{}, "[%0,12d]", 1234567, "[   1,234,567]"},
+	{Printer{}, "%+,d", 1234, "+1,234"},
+	{Printer{}, "%,x", 1234567, "12d687"},
+	{Printer{}, "%,.2f", 1234567.891, "1,234,567.89"},
+	{Printer{}, "%,.2f", -0.5, "-0.50"},
+	{Printer{}, "%,g", 1234567.0, "1.234567e+06"},
+	{Printer{}, "%,G", 12345.5, "12,345.5"},
+	{Printer{}, "%,f", math.Inf(1), "+Inf"},
+	{Printer{GroupSeparator: ".", DecimalSeparator: ","}, "%,.2f", 1234567.891, "1.234.567,89"},
+	{Printer{GroupSeparator: "\u2009"}, "[%,10d]", 1234567, "[ 1\u2009234\u2009567]"},
+	{Printer{GroupSeparator: "，"}, "[%,12d]", 1234567, "[ 1，234，567]"},
+}
+
+func TestGroupingFlag(t *testing.T) {
+	for _, tt := range groupingTests {
+		tt.pr.Condition = &Condition{}
+		if s := tt.pr.Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var underscoreTests = []struct {
+	fmt string
+	val interface{}
+	out string
+}{
+	{"%#_x", uint32(0xdeadbeef), "0xdead_beef"},
+	{"%_X", uint64(0x1deadbeef), "1_DEAD_BEEF"},
+	{"%#_b", 0x2d, "0b10_1101"},
+	{"%_O", 0755, "0o755"},
+	{"%_o", 01234567, "1_234_567"},
+	{"%#_o", 01234567, "01_234_567"},
+	{"%_d", -1234567, "-1_234_567"},
+	{"%_v", 1234, "1_234"},
+	{"[%#_12x]", uint32(0xdeadbeef), "[ 0xdead_beef]"},
+	{"[%-#_12x]", uint32(0xdeadbeef), "[0xdead_beef ]"},
+	{"%_.8x", 0xbeef, "0000_beef"},
+	{"%_x", 0xf, "f"},
+	{"%_x", "abc", "616263"},
+}
+
+func TestUnderscoreFlag(t *testing.T) {
+	pr := Printer{Condition: &Condition{}}
+	for _, tt := range underscoreTests {
+		if s := pr.Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var siTests = []struct {
+	fmt string
+	val interface{}
+	out string
+}{
+	{"%h", 1234, "1.2k"},
+	{"%h", 999, "999"},
+	{"%h", -3400000, "-3.4M"},
+	{"%h", uint64(5600000000), "5.6G"},
+	{"%.2h", 1234567, "1.23M"},
+	{"%.0h", 1500, "2k"},
+	{"%h", 999960, "1.0M"},
+	{"%h", 999.96, "1.0k"},
+	{"%.0h", 999.6, "1k"},
+	{"%h", 0.99996, "1.0"},
+	{"%h", 0.00099996, "1.0m"},
+	{"%h", 12.345, "12.3"},
+	{"%h", 0.0042, "4.2m"},
+	{"%h", 0.00000123, "1.2µ"},
+	{"%h", 0.0, "0.0"},
+	{"%+h", 1234, "+1.2k"},
+	{"%h", math.Inf(1), "+Inf"},
+	{"%h", 1e27, "1.0R"},
+	{"%h", 1e30, "1.0Q"},
+	{"%h", 1e33, "1.0e+33"},
+	{"%h", -999.96e30, "-1.0e+33"},
+	{"%h", 1e-30, "1.0q"},
+	{"%h", 1e-33, "1.0e-33"},
+	{"[%6h]", 1234, "[  1.2k]"},
+	{"[%-6h]", 1234, "[1.2k  ]"},
+	{"[%06h]", 1234, "[  1.2k]"},
+	{"%h", "x", "%!h(string=x)"},
+}
+
+func TestSIVerb(t *testing.T) {
+	pr := Printer{Condition: &Condition{}}
+	for _, tt := range siTests {
+		if s := pr.Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var durationTests = []struct {
+	fmt string
+	val interface{}
+	out string
+}{
+	{"%D", time.Hour + 3*time.Minute + 20123456789*time.Nanosecond, "1h3m"},
+	{"%.3D", time.Hour + 3*time.Minute + 20123456789*time.Nanosecond, "1h3m20s"},
+	{"%.1D", time.Hour + 33*time.Minute, "2h"},
+	{"%D", 3*time.Minute + 20500*time.Millisecond, "3m21s"},
+	{"%D", 1500 * time.Millisecond, "1.5s"},
+	{"%.2D", 1234567 * time.Microsecond, "1.235s"},
+	{"%D", 150250 * time.Microsecond, "150.25ms"},
+	{"%D", 2 * time.Hour, "2h"},
+	{"%D", 5 * time.Nanosecond, "5ns"},
+	{"%D", time.Duration(0), "0s"},
+	{"%D", -90 * time.Second, "-1m30s"},
+	{"%+D", 90 * time.Second, "+1m30s"},
+	{"[%8D]", 90 * time.Second, "[   1m30s]"},
+	{"[%-8D]", 1500 * time.Microsecond, "[1.5ms   ]"},
+	{"%v", 1500 * time.Millisecond, "1.5s"},
+	{"%D", 42, "%!D(int=42)"},
+}
+
+func TestDurationVerb(t *testing.T) {
+	for _, tt := range durationTests {
+		if s := Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var layoutTime = time.Date(2019, 3, 4, 15, 4, 5, 0, time.UTC)
+
+var layoutTests = []struct {
+	fmt string
+	val interface{}
+	out string
+}{
+	{"%{2006-01-02 15:04}t", layoutTime, "2019-03-04 15:04"},
+	{"[%-12{15:04}t]", layoutTime, "[15:04       ]"},
+	{"[%8{Jan 2}t]", &layoutTime, "[   Mar 4]"},
+	{"[%.4{2006-01-02}t]", layoutTime, "[2019]"},
+	{"%{2006年1月2日}t|", layoutTime, "2019年3月4日|"},
+	{"[%-14{2006年1月2日}t]", layoutTime, "[2019年3月4日  ]"},
+	{"%[2]{15:04}t %[1]d", []interface{}{7, layoutTime}, "15:04 7"},
+	{"%{15:04}t", []time.Time{layoutTime, layoutTime.Add(time.Hour)}, "[15:04 16:04]"},
+	{"%{15:04}t", true, "true"},
+	{"%{15:04}t %v", []interface{}{layoutTime, 1}, "15:04 1"},
+	{"%{2006}d", 5, "%!d(BADLAYOUT)"},
+	{"%{2006}s %d", []interface{}{layoutTime, 5}, "%!s(BADLAYOUT) 5"},
+}
+
+func TestTimeLayoutVerb(t *testing.T) {
+	pr := Printer{Condition: &Condition{}}
+	for _, tt := range layoutTests {
+		args := []interface{}{tt.val}
+		if a, ok := tt.val.([]interface{}); ok {
+			args = a
+		}
+		if s := pr.Sprintf(tt.fmt, args...); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+type jsonPoint struct {
+	X int    `json:"x"`
+	Y int    `json:"y"`
+	L string `json:"label,omitempty"`
+}
+
+// jsonFormatted formats itself, overriding %j.
+type jsonFormatted struct{}
+
+func (jsonFormatted) Format(f State, verb rune) { f.Write([]byte("formatted")) }
+
+var jsonTests = []struct {
+	fmt string
+	val interface{}
+	out string
+}{
+	{"%j", jsonPoint{1, 2, ""}, `{"x":1,"y":2}`},
+	{"%j", &jsonPoint{1, 2, "<a&b>"}, `{"x":1,"y":2,"label":"<a&b>"}`},
+	{"%#j", jsonPoint{1, 2, ""}, "{\n  \"x\": 1,\n  \"y\": 2\n}"},
+	{"%j", []string{"a", "b"}, `["a","b"]`},
+	{"%j", map[string]int{"b": 2, "a": 1}, `{"a":1,"b":2}`},
+	{"%j", "héllo", `"héllo"`},
+	{"%j", nil, "null"},
+	{"[%8j]", 42, "[      42]"},
+	{"[%-8j]", true, "[true    ]"},
+	{"%j", make(chan int), "%!j(ERROR=json: unsupported type: chan int)"},
+	{"%j", jsonFormatted{}, "formatted"},
+}
+
+func TestJSONVerb(t *testing.T) {
+	for _, tt := range jsonTests {
+		if s := Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+// keyValues marshals maps from strings to ints as key=value lines, in
+// the manner of a YAML encoder.
+func keyValues(v interface{}) ([]byte, error) {
+	m, ok := v.(map[string]int)
+	if !ok {
+		return nil, Errorf("not a map")
+	}
+	var b []byte
+	for _, k := range []string{"a", "b"} {
+		b = append(b, Sprintf("%s=%d\n", k, m[k])...)
+	}
+	return b, nil
+}
+
+func TestRegisterMarshaler(t *testing.T) {
+	RegisterMarshaler('y', keyValues)
+	defer RegisterMarshaler('y', nil)
+	tests := []struct {
+		fmt string
+		val interface{}
+		out string
+	}{
+		{"%y", map[string]int{"a": 1, "b": 2}, "a=1\nb=2"},
+		{"[%-4y]", map[string]int{"a": 1}, "[a=1\nb=0]"},
+		{"%y", 3, "%!y(ERROR=not a map)"},
+		{"%y", nil, "%!y(ERROR=not a map)"},
+		{"%y", jsonFormatted{}, "formatted"},
+	}
+	for _, tt := range tests {
+		if s := Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+	if !(&Printer{}).Features().Has(FeatureMarshalers) {
+		t.Error("Features() lacks marshalers")
+	}
+	RegisterMarshaler('y', nil)
+	if s := Sprintf("%y", 3); s != "%!y(int=3)" {
+		t.Errorf("after removal, Sprintf(%%y, 3) = %q", s)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterMarshaler('v') did not panic")
+		}
+	}()
+	RegisterMarshaler('v', keyValues)
+}
+
+func TestHexdumpVerb(t *testing.T) {
+	data := []byte("Hello, world!\n\x00\x01\xffwide 表")
+	if got, want := Sprintf("%H", data), strings.TrimSuffix(hex.Dump(data), "\n"); got != want {
+		t.Errorf("Sprintf(%%H) =\n%s\nwant\n%s", got, want)
+	}
+	tests := []struct {
+		fmt string
+		val interface{}
+		out string
+	}{
+		{"%H", "AB", "00000000  41 42                                             |AB|"},
+		{"%.3H", "ABCDEF", "00000000  41 42 43                                          |ABC|"},
+		{"%H", [2]byte{0x7f, ' '}, "00000000  7f 20                                             |. |"},
+		{"%H", "", ""},
+		{"[%-80H]", "A", "[00000000  41                                                |A|                 ]"},
+		{"%66H", "0123456789abcdefg", "00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|\n" +
+			"   00000010  67                                                |g|"},
+		{"%H", 12, "%!H(int=12)"},
+	}
+	for _, tt := range tests {
+		if s := Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var engineeringTests = []struct {
+	fmt string
+	val interface{}
+	out string
+}{
+	{"%n", 12340.0, "12.34e+03"},
+	{"%n", 1234.0, "1.234e+03"},
+	{"%n", 123400.0, "123.4e+03"},
+	{"%n", 100000.0, "100e+03"},
+	{"%n", 0.00047, "470e-06"},
+	{"%n", -0.5, "-500e-03"},
+	{"%N", 4.7e-9, "4.7E-09"},
+	{"%.2n", 12340.0, "12.34e+03"},
+	{"%.3n", 1.0, "1.000e+00"},
+	{"%.1n", 999.96, "1.0e+03"},
+	{"%.0n", 999999.0, "1e+06"},
+	{"%n", 1e300, "1e+300"},
+	{"%.2n", 0.0, "0.00e+00"},
+	{"%n", math.Inf(-1), "-Inf"},
+	{"%+.1n", 47000.0, "+47.0e+03"},
+	{"[%10.1n]", 47000.0, "[  47.0e+03]"},
+	{"[%-10.1n]", 47000.0, "[47.0e+03  ]"},
+	{"[%010.1n]", -47000.0, "[-047.0e+03]"},
+	{"%#n", 47000.0, "47.e+03"},
+	{"%n", float32(12340), "12.34e+03"},
+	{"%.1n", 2200 + 4.7e-3i, "(2.2e+03+4.7e-03i)"},
+	{"%n", 3, "%!n(int=3)"},
+}
+
+func TestEngineeringVerb(t *testing.T) {
+	for _, tt := range engineeringTests {
+		if s := Sprintf(tt.fmt, tt.val); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+var radixTests = []struct {
+	fmt string
+	val []interface{}
+	out string
+}{
+	{"%r", []interface{}{1295}, "zz"},
+	{"%R", []interface{}{uint64(1<<64 - 1)}, "3W5E11264SGSF"},
+	{"%.36r", []interface{}{35}, "z"},
+	{"%.*r", []interface{}{2, 5}, "101"},
+	{"%.*r", []interface{}{7, -48}, "-66"},
+	{"%.16r", []interface{}{255}, "ff"},
+	{"%#.16r", []interface{}{255}, "ff"},
+	{"%.10r", []interface{}{int8(-128)}, "-128"},
+	{"%r", []interface{}{0}, "0"},
+	{"%+.3r", []interface{}{5}, "+12"},
+	{"[%6r]", []interface{}{1295}, "[    zz]"},
+	{"[%-6r]", []interface{}{1295}, "[zz    ]"},
+	{"[%06.2r]", []interface{}{5}, "[000101]"},
+	{"%_.2r", []interface{}{255}, "1111_1111"},
+	{"%_.36r", []interface{}{36 * 36 * 36 * 36}, "10_000"},
+	{"%.1r", []interface{}{5}, "%!r(BADBASE)"},
+	{"%.37r", []interface{}{5}, "%!r(BADBASE)"},
+	{"%r", []interface{}{"x"}, "%!r(string=x)"},
+}
+
+func TestRadixVerb(t *testing.T) {
+	for _, tt := range radixTests {
+		if s := Sprintf(tt.fmt, tt.val...); s != tt.out {
+			t.Errorf("Sprintf(%q, %v) = %q want %q", tt.fmt, tt.val, s, tt.out)
+		}
+	}
+}
+
+// Test the various Append printers. The details are well tested above;
+// here we just make sure the byte slice is updated.
+
+const (
+	appendResult = "hello world, 23"
+	hello        = "hello "
+)
+
+func TestAppendf(t *testing.T) {
+	b := make([]byte, 100)
+	b = b[:copy(b, hello)]
+	got := Appendf(b, "world, %d", 23)
+	if string(got) != appendResult {
+		t.Fatalf("Appendf returns %q not %q", got, appendResult)
+	}
+	if &b[0] != &got[0] {
+		t.Fatalf("Appendf allocated a new slice")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	b := make([]byte, 100)
+	b = b[:copy(b, hello)]
+	got := Append(b, "world", ", ", 23)
+	if string(got) != appendResult {
+		t.Fatalf("Append returns %q not %q", got, appendResult)
+	}
+	if &b[0] != &got[0] {
+		t.Fatalf("Append allocated a new slice")
+	}
+}
+
+func TestAppendln(t *testing.T) {
+	b := make([]byte, 100)
+	b = b[:copy(b, hello)]
+	got := Appendln(b, "world,", 23)
+	if string(got) != appendResult+"\n" {
+		t.Fatalf("Appendln returns %q not %q", got, appendResult+"\n")
+	}
+	if &b[0] != &got[0] {
+		t.Fatalf("Appendln allocated a new slice")
+	}
+}
+
+func TestBprintf(t *testing.T) {
+	buf := make([]byte, 8)
+	n, err := Bprintf(buf, "%-5s|%d", "日", 7)
+	if err != nil || string(buf[:n]) != "日   |7" {
+		t.Errorf("Bprintf = %q, %v", buf[:n], err)
+	}
+	copy(buf, "xxxxxxxx")
+	if n, err := Bprintf(buf, "%d", 123456789); n != 0 || err != ErrTooLong || string(buf) != "xxxxxxxx" {
+		t.Errorf("Bprintf too long = %d, %v and wrote %q", n, err, buf)
+	}
+	pr := Printer{GroupSeparator: "."}
+	if n, err := pr.Bprintf(buf, "%,d", 1234); err != nil || string(buf[:n]) != "1.234" {
+		t.Errorf("Printer.Bprintf = %q, %v", buf[:n], err)
+	}
+	f, _ := Compile("%03d")
+	if n, err := f.Bprintf(buf[:2], 7); n != 0 || err != ErrTooLong {
+		t.Errorf("Format.Bprintf = %d, %v", n, err)
+	}
+	if n := testing.AllocsPerRun(100, func() { Bprintf(buf, "%-6s", "ab") }); n > 0 {
+		t.Errorf("Bprintf allocates %v times per call", n)
+	}
+}
+
+func TestPrinterAppendf(t *testing.T) {
+	pr := Printer{Condition: &Condition{}}
+	b := make([]byte, 0, 100)
+	b = append(b, "> "...)
+	got := pr.Appendf(b, "%-6s|", "日本")
+	if string(got) != "> 日本  |" {
+		t.Fatalf("Appendf returns %q not %q", got, "> 日本  |")
+	}
+	if &b[0] != &got[0] {
+		t.Fatalf("Appendf allocated a new slice")
+	}
+	if n := testing.AllocsPerRun(100, func() { got = pr.Appendf(got[:2], "%-6s|", "日本") }); n > 0 {
+		t.Errorf("Appendf allocates %v times per call", n)
+	}
+}
+
+// textLang has only a MarshalText method.
+type textLang struct{ tag string }
+
+func (l textLang) MarshalText() ([]byte, error) {
+	if l.tag == "" {
+		return nil, textLangError{}
+	}
+	return []byte("lang:" + l.tag), nil
+}
+
+type textLangError struct{}
+
+func (textLangError) Error() string { return "empty tag" }
+
+// textPoint has both AppendText and MarshalText; AppendText is preferred.
+type textPoint struct{ X, Y int }
+
+func (p textPoint) AppendText(b []byte) ([]byte, error) {
+	return Appendf(b, "(%d,%d)", p.X, p.Y), nil
+}
+
+func (p textPoint) MarshalText() ([]byte, error) {
+	return []byte("marshaled"), nil
+}
+
+var textMarshalerTests = []struct {
+	format string
+	arg    interface{}
+	out    string
+}{
+	{"%v", textLang{"ja"}, "lang:ja"},
+	{"%s", textLang{"ja"}, "lang:ja"},
+	{"%-10s|", textLang{"日本"}, "lang:日本 |"},
+	{"%.6s", textLang{"日本"}, "lang:日"},
+	{"%v", &textLang{"ja"}, "lang:ja"},
+	{"%v", []textLang{{"ja"}, {"zh"}}, "[lang:ja lang:zh]"},
+	{"%+v", struct{ L textLang }{textLang{"ko"}}, "{L:lang:ko}"},
+	{"%d", textLang{"ja"}, "{%!d(string=ja)}"},
+	{"%q", textLang{"ja"}, `{"ja"}`},
+	{"%#v", textLang{"ja"}, `wfmt_test.textLang{tag:"ja"}`},
+	{"%v", textLang{}, "%!v(ERROR=MarshalText method: empty tag)"},
+	{"%v", textPoint{1, 2}, "(1,2)"},
+	{"%6s", textPoint{1, 2}, " (1,2)"},
+}
+
+func TestTextMarshaler(t *testing.T) {
+	pr := Printer{Condition: &Condition{}}
+	for _, tt := range textMarshalerTests {
+		if got := pr.Sprintf(tt.format, tt.arg); got != tt.out {
+			t.Errorf("Sprintf(%q, %T) = %q want %q", tt.format, tt.arg, got, tt.out)
+		}
+	}
+}
+
+// stringWriter records whether output reached it through WriteString.
+type stringWriter struct {
+	strings.Builder
+	writes, writeStrings int
+}
+
+func (w *stringWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.Builder.Write(b)
+}
+
+func (w *stringWriter) WriteString(s string) (int, error) {
+	w.writeStrings++
+	return w.Builder.WriteString(s)
+}
+
+func TestFprintStringWriter(t *testing.T) {
+	var w stringWriter
+	Fprintf(&w, "%-6s|", "日本")
+	Fprint(&w, "a", 1)
+	Fprintln(&w, "b")
+	Fprintf(&w, "%x", strings.Repeat("z", 40<<10))
+	(&Printer{}).Fprintf(&w, "%d", 2)
+	if w.writes != 0 || w.writeStrings == 0 {
+		t.Errorf("Write called %d times, WriteString %d times", w.writes, w.writeStrings)
+	}
+	if got := w.String(); !strings.HasPrefix(got, "日本  |a1b\n7a7a") || !strings.HasSuffix(got, "7a2") {
+		t.Errorf("output = %.40q...", got)
+	}
+}
+
+// The Fprint functions hand their pooled buffer to WriteString or Write,
+// so that writing to a strings.Builder or bufio.Writer costs no
+// conversion or copy.
+func TestFprintAllocs(t *testing.T) {
+	var sb strings.Builder
+	sb.Grow(1 << 16)
+	bw := bufio.NewWriterSize(ioutil.Discard, 1<<16)
+	pr := Printer{}
+	tests := []struct {
+		name string
+		f    func()
+	}{
+		{"Fprintf Builder", func() { Fprintf(&sb, "%-8s|%s\n", "日本", "x") }},
+		{"Fprint bufio", func() { Fprint(bw, "日本", "x") }},
+		{"Fprintln bufio", func() { Fprintln(bw, "日本", "x") }},
+		{"Printer.Fprintf bufio", func() { pr.Fprintf(bw, "%-8s|%s\n", "日本", "x") }},
+	}
+	for _, tt := range tests {
+		if n := testing.AllocsPerRun(100, tt.f); n > 0 {
+			t.Errorf("%s allocates %v times per call", tt.name, n)
+		}
+	}
+}
+
+type (
+	namedStrings  []string
+	namedInts     []int
+	namedFloats   []float64
+	namedStrMap   map[string]string
+	namedAnyMap   map[string]interface{}
+	stringerValue int
+)
+
+func (v stringerValue) String() string { return "S" + Sprint(int(v)) }
+
+// The slices and maps printed without reflection print as those of
+// named types, which are printed by reflection.
+func TestCommonTypesFastPath(t *testing.T) {
+	values := map[string]interface{}{
+		"s": "x", "i": 1 << 30, "f": 2.5, "b": true, "nil": nil,
+		"ptr": &struct{ A int }{1}, "stringer": stringerValue(3),
+		"nested": map[string]interface{}{"k": []string{"v"}},
+	}
+	tests := []struct {
+		fast, slow interface{}
+	}{
+		{[]string{"a", "日本", ""}, namedStrings{"a", "日本", ""}},
+		{[]string(nil), namedStrings(nil)},
+		{[]int{-1, 0, 1 << 30}, namedInts{-1, 0, 1 << 30}},
+		{[]float64{0.1, -2, 1e21}, namedFloats{0.1, -2, 1e21}},
+		{map[string]string{"b": "2", "a": "1", "日本": "語"}, namedStrMap{"b": "2", "a": "1", "日本": "語"}},
+		{map[string]interface{}(nil), namedAnyMap(nil)},
+		{values, namedAnyMap(values)},
+	}
+	printers := []Printer{
+		{},
+		{MaxDepth: 1},
+		{MaxBytes: 12},
+		{Condition: &Condition{Invalid: InvalidStrict}},
+	}
+	for n, pr := range printers {
+		for _, format := range []string{"%v", "%+v", "%6v", "%-4v|", "%x"} {
+			for _, tt := range tests {
+				if got, want := pr.Sprintf(format, tt.fast), pr.Sprintf(format, tt.slow); got != want {
+					t.Errorf("printer %d: Sprintf(%q, %T) = %q want %q", n, format, tt.fast, got, want)
+				}
+			}
+		}
+	}
+	bad := Printer{Condition: &Condition{Invalid: InvalidStrict}}
+	if got, want := bad.Sprintf("%v", []string{"\xff"}), bad.Sprintf("%v", namedStrings{"\xff"}); got != want {
+		t.Errorf("Sprintf of invalid UTF-8 = %q want %q", got, want)
+	}
+}
+
+func BenchmarkSprintfCommonTypes(b *testing.B) {
+	strs := []string{"alpha", "beta", "gamma", "delta"}
+	m := map[string]interface{}{"user": "gopher", "id": 42, "ratio": 0.5}
+	b.Run("[]string", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Sprintf("%v", strs)
+		}
+	})
+	b.Run("reflect/[]string", func(b *testing.B) {
+		named := namedStrings(strs)
+		for i := 0; i < b.N; i++ {
+			Sprintf("%v", named)
+		}
+	})
+	b.Run("map[string]interface{}", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Sprintf("%v", m)
+		}
+	})
+	b.Run("reflect/map[string]interface{}", func(b *testing.B) {
+		named := namedAnyMap(m)
+		for i := 0; i < b.N; i++ {
+			Sprintf("%v", named)
+		}
+	})
+}
+
+// A chunkWriter records the writes made to it.
+type chunkWriter struct {
+	out     []byte
+	writes  int
+	longest int
+	fail    bool
+}
+
+func (w *chunkWriter) Write(b []byte) (int, error) {
+	if w.fail && w.writes > 0 {
+		return 0, io.ErrShortWrite
+	}
+	w.writes++
+	if len(b) > w.longest {
+		w.longest = len(b)
+	}
+	w.out = append(w.out, b...)
+	return len(b), nil
+}
+
+// The Fprint functions write long hexadecimal encodings out in chunks.
+func TestFprintStreamsHex(t *testing.T) {
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	want := hex.EncodeToString(data)
+	for _, tt := range []struct {
+		name string
+		f    func(w io.Writer) (int, error)
+		want string
+	}{
+		{"Fprintf %x", func(w io.Writer) (int, error) { return Fprintf(w, "<%x>", data) }, "<" + want + ">"},
+		{"Fprintf %X string", func(w io.Writer) (int, error) { return Fprintf(w, "%X", want[:1<<18]) }, strings.ToUpper(hex.EncodeToString([]byte(want[:1<<18])))},
+		{"Printer.Fprintf", func(w io.Writer) (int, error) { return (&Printer{}).Fprintf(w, "%-8x|\n", data) }, want + "|\n"},
+		{"Fprintf %H", func(w io.Writer) (int, error) { return Fprintf(w, "%H\n", data[:1<<16]) }, strings.TrimSuffix(hex.Dump(data[:1<<16]), "\n") + "\n"},
+	} {
+		var w chunkWriter
+		n, err := tt.f(&w)
+		if err != nil || n != len(tt.want) || string(w.out) != tt.want {
+			t.Errorf("%s = %d, %v; wrote %d bytes, correct: %v", tt.name, n, err, len(w.out), string(w.out) == tt.want)
+		}
+		if w.writes < 2 || w.longest > 64<<10 {
+			t.Errorf("%s wrote %d times, at most %d bytes", tt.name, w.writes, w.longest)
+		}
+	}
+
+	// Output processed as a whole is written at once.
+	var w chunkWriter
+	(&Printer{Wrap: 1 << 30}).Fprintf(&w, "%x", data)
+	if w.writes != 1 || string(w.out) != want {
+		t.Errorf("Printer with Wrap wrote %d times", w.writes)
+	}
+
+	// A write error stops the output.
+	w = chunkWriter{fail: true}
+	if n, err := Fprintf(&w, "%x", data); err != io.ErrShortWrite || n != len(w.out) {
+		t.Errorf("Fprintf to a failing writer = %d, %v; wrote %d bytes", n, err, len(w.out))
+	}
+}
@@ -0,0 +1,617 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// ControlPolicy selects how C0 and C1 control characters are measured.
+// Tab and newline are not affected by the policy.
+type ControlPolicy int
+
+const (
+	// ControlZero measures control characters as occupying no cells.
+	ControlZero ControlPolicy = iota
+	// ControlOne measures each control character as one cell.
+	ControlOne
+	// ControlEscape prints control characters in string operands as Go
+	// escapes such as \x1b or \r and measures them by the escape's width.
+	ControlEscape
+)
+
+// InvalidPolicy selects how invalid UTF-8 in string operands is printed.
+type InvalidPolicy int
+
+const (
+	// InvalidKeep prints invalid bytes as they are and measures each as
+	// U+FFFD, which is how most terminals show them.
+	InvalidKeep InvalidPolicy = iota
+	// InvalidReplace replaces each invalid byte with U+FFFD, which is
+	// East Asian ambiguous and so occupies two cells under EastAsian.
+	InvalidReplace
+	// InvalidHex prints each invalid byte as a Go escape such as \xff.
+	InvalidHex
+	// InvalidStrict prints an error such as %!s(BADUTF8="a\xff") in
+	// place of an operand that is not valid UTF-8.
+	InvalidStrict
+)
+
+// LinePolicy selects how the width of a verb applies to a string operand
+// of several lines.
+type LinePolicy int
+
+const (
+	// LinesWhole pads the string as a whole, measuring it as the sum of
+	// the widths of its lines.
+	LinesWhole LinePolicy = iota
+	// LinesLongest pads the string as a whole, measuring it as wide as
+	// its longest line.
+	LinesLongest
+	// LinesEach pads every line to the width, so that the string fills
+	// a rectangular block. The # flag, as in %#-20s, selects it for a
+	// single verb.
+	LinesEach
+)
+
+// WidthUnit selects what the width and precision of a verb count.
+// Escape sequences are never counted.
+type WidthUnit int
+
+const (
+	// UnitDefault counts display columns for widths and runes for
+	// precisions, as fmt does apart from measuring columns.
+	UnitDefault WidthUnit = iota
+	// UnitColumns counts display columns for both, so that a precision
+	// never cuts a string wider than itself or splits a grapheme cluster.
+	UnitColumns
+	// UnitRunes counts runes for both, as fmt does.
+	UnitRunes
+	// UnitBytes counts bytes for both, as fixed-width file formats do.
+	// A precision does not split a multibyte character.
+	UnitBytes
+)
+
+// UnknownPolicy selects how characters missing from the width data are
+// measured: code points unassigned in the Unicode version of the
+// package's character tables, which a terminal with newer data may know.
+type UnknownPolicy int
+
+const (
+	// UnknownNarrow measures unknown characters as one cell, as most
+	// terminals without data for them show them.
+	UnknownNarrow UnknownPolicy = iota
+	// UnknownWide measures unknown characters as two cells, as most of
+	// the emoji and ideographs added by new versions of Unicode are.
+	UnknownWide
+)
+
+// A Condition holds the rules used to measure the display width of text.
+type Condition struct {
+	// EastAsian reports whether East Asian ambiguous characters, such as
+	// Greek and Cyrillic letters, box drawing and many symbols, occupy two
+	// cells, as they do on terminals using a CJK locale.
+	EastAsian bool
+
+	// Control is the policy for C0 and C1 control characters.
+	Control ControlPolicy
+
+	// Invalid is the policy for invalid UTF-8 in string operands.
+	Invalid InvalidPolicy
+
+	// Lines is the policy for padding string operands that contain
+	// newlines.
+	Lines LinePolicy
+
+	// Units selects what the widths and precisions of verbs count; the
+	// = flag selects bytes, ~ runes and | columns for a single verb, as
+	// in %=-10s. Functions such as StringWidth always count columns.
+	Units WidthUnit
+
+	// EscPos enables recognition of ESC/POS printer commands, which
+	// occupy no cells. Characters printed in double-width or enlarged
+	// mode are measured at their printed size.
+	EscPos bool
+
+	// TabStops makes a tab advance to the next tab stop, every TabWidth
+	// cells, rather than occupy no cells. The text measured is taken to
+	// start at a tab stop, so padding a field that contains tabs aligns
+	// the output when the field itself starts at one.
+	TabStops bool
+	// TabWidth is the distance between tab stops; 8 if zero.
+	TabWidth int
+
+	// StyledTail shows the tail marker of truncated text, such as an
+	// ellipsis, in the color and style in effect where the text is cut
+	// rather than in the default style.
+	StyledTail bool
+
+	// Ellipsis marks text cut short by the precision of a verb with the
+	// > flag, as in %>.20s; "…" if empty. It is counted within the
+	// precision.
+	Ellipsis string
+
+	// CodePage, if it is one of the CJK Windows console code pages 932,
+	// 936, 949, 950 or 51932, measures characters as a legacy console
+	// using that output code page shows them: ambiguous characters are
+	// wide, apart from Latin-1 letters the code page lacks, and
+	// characters outside the Basic Multilingual Plane take two cells.
+	// On Windows, DefaultCondition uses the code page of the console.
+	CodePage int
+
+	// Unicode selects the bundled width tables of a Unicode version,
+	// such as "9.0" or "15.0.0", to match the data a terminal was built
+	// with. If empty or unknown, the go-runewidth tables are used.
+	// UnicodeVersions lists the versions available.
+	Unicode string
+
+	// Unknown is the policy for characters missing from the width
+	// data. UnknownWidth, if not nil, measures them instead.
+	Unknown      UnknownPolicy
+	UnknownWidth func(r rune) int
+	// OnUnknown, if not nil, is called with each unknown character
+	// measured, so that a program can count them or log them and learn
+	// that its width tables need regenerating. It may be called
+	// concurrently from several goroutines.
+	OnUnknown func(r rune)
+
+	// Cache, if not nil, remembers the widths of strings measured
+	// repeatedly, such as the labels of a log, so that measuring them
+	// again costs a lookup; see WidthCache. OnUnknown is not called for
+	// strings found in the cache.
+	Cache *WidthCache
+}
+
+// DefaultCondition is the Condition used by the package-level print functions.
+// Whether ambiguous characters are wide is detected from the environment;
+// see DetectEastAsian.
+var DefaultCondition = &Condition{EastAsian: DetectEastAsian(), CodePage: consoleCodePage()}
+
+// The go-runewidth conditions used outside the BMP when no Unicode
+// version is selected. StrictEmojiNeutral is set as in runewidth.DefaultCondition, so that
+// emoji-neutral symbols such as ☺ stay narrow under EastAsian.
+var (
+	runewidthNarrow    = &runewidth.Condition{StrictEmojiNeutral: true}
+	runewidthEastAsian = &runewidth.Condition{EastAsianWidth: true, StrictEmojiNeutral: true}
+)
+
+// interval is an inclusive range of code points.
+type interval struct {
+	first rune
+	last  rune
+}
+
+// table is a sorted list of non-overlapping intervals.
+type table []interval
+
+// inTable reports whether r falls within one of the intervals of t.
+func inTable(r rune, t table) bool {
+	if len(t) == 0 || r < t[0].first || r > t[len(t)-1].last {
+		return false
+	}
+	// Binary search over the sorted intervals.
+	lo, hi := 0, len(t)
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		switch {
+		case r < t[m].first:
+			hi = m
+		case r > t[m].last:
+			lo = m + 1
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// zeroWidth holds format characters that never occupy a terminal cell:
+// ZERO WIDTH SPACE, ZERO WIDTH NON-JOINER, ZERO WIDTH JOINER, the
+// directional marks, WORD JOINER and the invisible operators, and
+// ZERO WIDTH NO-BREAK SPACE (the byte order mark). Not every version of
+// the runewidth tables agrees on these, so they are checked first.
+var zeroWidth = table{
+	{0x200B, 0x200F},
+	{0x2060, 0x2064},
+	{0xFEFF, 0xFEFF},
+}
+
+//go:generate go run maketables.go -version 9.0.0
+//go:generate go run maketables.go -version 15.0.0
+//go:generate go run maketables.go -runewidth
+
+// widthTables are the width classes of one Unicode version, generated
+// from EastAsianWidth.txt and emoji-data.txt by maketables.go.
+type widthTables struct {
+	version   string
+	zero      table // nonspacing and enclosing marks, format characters
+	wide      table // East Asian Wide and Fullwidth, emoji presentation
+	ambiguous table // East Asian Ambiguous
+
+	// bmp holds the classes of the Basic Multilingual Plane.
+	bmp *widthTrie
+}
+
+// The width classes of widthTrie.
+const (
+	classNarrow uint8 = iota
+	classZero
+	classWide
+	classAmbiguous
+)
+
+// trieBlockBits is the number of low bits of a rune that index a block
+// of a widthTrie.
+const trieBlockBits = 7
+
+// A widthTrie is a two-stage lookup table of the width classes of the
+// Basic Multilingual Plane, generated by maketables.go: index maps the
+// high bits of a rune to a block of classes, indexed by its low bits.
+// Most blocks are alike, all narrow or all wide, and are stored once,
+// which keeps the table to about 13 kilobytes.
+type widthTrie struct {
+	index  [0x10000 >> trieBlockBits]uint16
+	blocks string
+}
+
+// class returns the width class of r, which must be in the BMP.
+func (t *widthTrie) class(r rune) uint8 {
+	return t.blocks[int(t.index[r>>trieBlockBits])<<trieBlockBits|int(r&(1<<trieBlockBits-1))]
+}
+
+// width returns the width of r, which must be in the BMP. Ambiguous
+// characters are wide if eastAsian is set.
+func (t *widthTrie) width(r rune, eastAsian bool) int {
+	switch t.class(r) {
+	case classZero:
+		return 0
+	case classWide:
+		return 2
+	case classAmbiguous:
+		if eastAsian {
+			return 2
+		}
+	}
+	return 1
+}
+
+// unicodeTables maps versions, in both full and major.minor form, to
+// the bundled tables.
+var unicodeTables = map[string]*widthTables{}
+
+func registerUnicode(t *widthTables) {
+	unicodeTables[t.version] = t
+	if i := len(t.version) - len(".0"); t.version[i:] == ".0" {
+		unicodeTables[t.version[:i]] = t
+	}
+}
+
+// UnicodeVersions returns the Unicode versions whose width tables are
+// bundled with the package, in increasing order.
+func UnicodeVersions() []string {
+	var vs []string
+	for v, t := range unicodeTables {
+		if v == t.version {
+			vs = append(vs, v)
+		}
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		a, b := strings.Split(vs[i], "."), strings.Split(vs[j], ".")
+		for k := range a {
+			x, _ := strconv.Atoi(a[k])
+			y, _ := strconv.Atoi(b[k])
+			if x != y {
+				return x < y
+			}
+		}
+		return false
+	})
+	return vs
+}
+
+// runeWidth returns the width of r according to the tables. Ambiguous
+// characters are wide if eastAsian is set.
+func (t *widthTables) runeWidth(r rune, eastAsian bool) int {
+	if 0 <= r && r <= 0xFFFF {
+		return t.bmp.width(r, eastAsian)
+	}
+	// The supplementary planes are sparse: their few intervals are
+	// searched instead.
+	switch {
+	case inTable(r, t.zero):
+		return 0
+	case inTable(r, t.wide):
+		return 2
+	case eastAsian && inTable(r, t.ambiguous):
+		return 2
+	}
+	return 1
+}
+
+// isControl reports whether r is a C0 or C1 control character subject
+// to the ControlPolicy.
+func isControl(r rune) bool {
+	return r < 0x20 && r != '\t' && r != '\n' || 0x7F <= r && r < 0xA0
+}
+
+// controlEscape returns the Go escape for the control character r.
+func controlEscape(r rune) string {
+	q := strconv.QuoteRune(r)
+	return q[1 : len(q)-1]
+}
+
+// RuneWidth returns the number of terminal cells occupied by r.
+func (c *Condition) RuneWidth(r rune) int {
+	switch {
+	case isControl(r):
+		switch c.Control {
+		case ControlOne:
+			return 1
+		case ControlEscape:
+			return len(controlEscape(r))
+		}
+		return 0
+	case inTable(r, zeroWidth):
+		return 0
+	}
+	eastAsian := c.EastAsian
+	if cjkCodePages[c.CodePage] {
+		if w, ok := codePageWidth(c.CodePage, r); ok {
+			return w
+		}
+		eastAsian = true
+	}
+	var w int
+	if t := unicodeTables[c.Unicode]; t != nil {
+		w = t.runeWidth(r, eastAsian)
+	} else if 0 <= r && r <= 0xFFFF {
+		w = runewidthBMP.width(r, eastAsian)
+	} else if eastAsian {
+		w = runewidthEastAsian.RuneWidth(r)
+	} else {
+		w = runewidthNarrow.RuneWidth(r)
+	}
+	if w < 2 && r >= firstUnassigned && !assigned(r) {
+		return c.unknownWidth(r)
+	}
+	return w
+}
+
+// firstUnassigned is the first code point not assigned a character.
+const firstUnassigned = 0x378
+
+// assigned reports whether r is assigned a character, or reserved for
+// private use or surrogates, in the Unicode version of package unicode.
+func assigned(r rune) bool {
+	return unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.P, unicode.S, unicode.Z, unicode.Cc, unicode.Cf, unicode.Co, unicode.Cs)
+}
+
+// unknownWidth returns the width of r, which is missing from the width
+// data, according to the UnknownPolicy.
+func (c *Condition) unknownWidth(r rune) int {
+	if c.OnUnknown != nil {
+		c.OnUnknown(r)
+	}
+	if c.UnknownWidth != nil {
+		return c.UnknownWidth(r)
+	}
+	if c.Unknown == UnknownWide {
+		return 2
+	}
+	return 1
+}
+
+// StringWidth returns the number of terminal cells occupied by s.
+// Terminal escape sequences occupy no cells, and each grapheme cluster
+// occupies the cells of its widest rune.
+func (c *Condition) StringWidth(s string) (width int) {
+	if c.Cache != nil && len(s) <= maxCachedLen {
+		if w, ok := c.Cache.get(s); ok {
+			return w
+		}
+		w := c.stringWidth(s)
+		c.Cache.put(s, w)
+		return w
+	}
+	return c.stringWidth(s)
+}
+
+// stringWidth measures s for StringWidth.
+func (c *Condition) stringWidth(s string) (width int) {
+	scale := 1
+	reg := registeredSequences()
+	for i := 0; i < len(s); {
+		if n := reg.asciiRun(s[i:]); n > 0 {
+			width += scale * n
+			i += n
+			continue
+		}
+		if n := c.seqLen(s[i:], &scale); n > 0 {
+			i += n
+			continue
+		}
+		n := c.clusterLen(s[i:])
+		if s[i] == '\t' && c.TabStops {
+			width = c.nextTabStop(width)
+		} else {
+			width += scale * c.clusterWidth(s[i:i+n])
+		}
+		i += n
+	}
+	return width
+}
+
+// Masks of the low and high bits of each byte of a word.
+const (
+	lowBits  = 0x0101010101010101
+	highBits = 0x8080808080808080
+)
+
+// asciiRun returns the length of the run of printable ASCII characters,
+// which occupy a cell each under every Condition, at the start of s. It
+// checks eight bytes at a time, so that measuring mostly ASCII text
+// seldom reaches the width tables. The run stops short of a character
+// that may start a registered sequence, and of the last character before
+// a non-ASCII one, which may be the base of a grapheme cluster.
+func (reg *sequenceRegistry) asciiRun(s string) int {
+	n := 0
+	for ; n+8 <= len(s); n += 8 {
+		x := uint64(s[n]) | uint64(s[n+1])<<8 | uint64(s[n+2])<<16 | uint64(s[n+3])<<24 |
+			uint64(s[n+4])<<32 | uint64(s[n+5])<<40 | uint64(s[n+6])<<48 | uint64(s[n+7])<<56
+		// The high bit of a byte is set in x if it is not ASCII, in
+		// x-0x20 if it is below a space, and in (x^0x7F)-1 if it is a
+		// DEL. Borrows only follow a byte found by the first two.
+		if (x|(x-0x20*lowBits)|((x^0x7F*lowBits)-lowBits))&highBits != 0 {
+			break
+		}
+	}
+	for n < len(s) && ' ' <= s[n] && s[n] < 0x7F {
+		n++
+	}
+	if reg.printableStarts {
+		for i := 0; i < n; i++ {
+			if reg.starts[s[i]] {
+				n = i
+				break
+			}
+		}
+	}
+	if n > 0 && n < len(s) && s[n] >= utf8.RuneSelf {
+		n--
+	}
+	return n
+}
+
+// nextTabStop returns the column of the first tab stop after col.
+func (c *Condition) nextTabStop(col int) int {
+	tw := c.TabWidth
+	if tw <= 0 {
+		tw = 8
+	}
+	return (col/tw + 1) * tw
+}
+
+// escapeControls returns s with its control characters replaced by
+// their Go escapes. Recognized escape sequences are kept.
+func (c *Condition) escapeControls(s string) string {
+	scale := 1
+	for i := 0; i < len(s); {
+		if n := c.seqLen(s[i:], &scale); n > 0 {
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if isControl(r) {
+			return string(c.appendControlEscapes([]byte(s[:i]), s[i:]))
+		}
+		i += size
+	}
+	return s
+}
+
+// appendControlEscapes appends s to b, replacing control characters
+// with their Go escapes. Recognized escape sequences are kept.
+func (c *Condition) appendControlEscapes(b []byte, s string) []byte {
+	scale := 1
+	for i := 0; i < len(s); {
+		if n := c.seqLen(s[i:], &scale); n > 0 {
+			b = append(b, s[i:i+n]...)
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if isControl(r) {
+			b = append(b, controlEscape(r)...)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return b
+}
+
+// fixUTF8 returns s with its invalid bytes replaced as c.Invalid says.
+func (c *Condition) fixUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r != utf8.RuneError || size != 1:
+			b.WriteString(s[i : i+size])
+		case c.Invalid == InvalidHex:
+			b.WriteString(`\x`)
+			b.WriteByte(ldigits[s[i]>>4])
+			b.WriteByte(ldigits[s[i]&0xF])
+		default:
+			b.WriteRune(utf8.RuneError)
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// stringWidth returns the number of terminal cells occupied by s
+// under the DefaultCondition.
+func stringWidth(s string) int {
+	return DefaultCondition.StringWidth(s)
+}
+
+// Truncate returns s cut to at most w cells. If anything is removed,
+// tail, such as "…" or "...", is appended and counted within w, unless
+// tail alone is wider. Wide characters, grapheme clusters and escape
+// sequences are never split, and a style or hyperlink left open by the
+// part kept is closed.
+func (c *Condition) Truncate(s string, w int, tail string) string {
+	if c.StringWidth(s) <= w {
+		return s
+	}
+	if tw := c.StringWidth(tail); tw <= w {
+		w -= tw
+	} else {
+		tail = ""
+	}
+	var st styleState
+	for g := c.Graphemes(s); g.Next(); {
+		if g.IsSequence() {
+			st.update(g.Str())
+			continue
+		}
+		if g.Column() > w {
+			i, _ := g.Positions()
+			if c.StyledTail {
+				return s[:i] + tail + st.close()
+			}
+			return s[:i] + st.close() + tail
+		}
+	}
+	return s
+}
+
+// Truncate returns s cut to at most maxWidth cells under the
+// DefaultCondition, with tail appended if anything is removed.
+// See Condition.Truncate.
+func Truncate(s string, maxWidth int, tail string) string {
+	return DefaultCondition.Truncate(s, maxWidth, tail)
+}
+
+// fill returns r repeated to fill w cells. If r is wide and w is odd,
+// the last cell is filled with a space.
+func (c *Condition) fill(r rune, w int) string {
+	rw := c.RuneWidth(r)
+	if w <= 0 || rw <= 0 {
+		return ""
+	}
+	return strings.Repeat(string(r), w/rw) + strings.Repeat(" ", w%rw)
+}
@@ -0,0 +1,371 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestUnicodeVersions(t *testing.T) {
+	if got, want := UnicodeVersions(), []string{"9.0.0", "15.0.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UnicodeVersions() = %q want %q", got, want)
+	}
+}
+
+var unicodeWidthTests = []struct {
+	version string
+	s       string
+	width   int
+}{
+	{"9.0", "\U0001F6D5", 1}, // HINDU TEMPLE, added in Unicode 12.0
+	{"15.0", "\U0001F6D5", 2},
+	{"15.0.0", "\U0001F6D5", 2},
+	{"9.0.0", "é", 1},
+	{"15.0", "é", 1},
+	{"9.0", "日本語", 6},
+	{"15.0", "\u200b日\ufeff", 2},
+	{"15.0", "⌚", 2},
+	{"15.0", "e\u0301\uff01\u3000", 5},
+	{"9.0", "\u1100\u115f\u1160", 5},
+	{"15.0", "\ufffd\uffff", 2},
+	{"15.0", "\U00020000\U0001F600a", 5},
+}
+
+func TestUnicodeWidth(t *testing.T) {
+	for _, tt := range unicodeWidthTests {
+		c := &Condition{Unicode: tt.version}
+		if w := c.StringWidth(tt.s); w != tt.width {
+			t.Errorf("Unicode %s: StringWidth(%+q) = %d want %d", tt.version, tt.s, w, tt.width)
+		}
+	}
+}
+
+func BenchmarkUnicodeWidth(b *testing.B) {
+	c := &Condition{Unicode: "15.0"}
+	s := "Größe: 日本語のテキスト, ελληνικά, русский, 한국어"
+	for i := 0; i < b.N; i++ {
+		c.StringWidth(s)
+	}
+}
+
+func TestEastAsianEmojiNeutral(t *testing.T) {
+	c := &Condition{EastAsian: true}
+	if w := c.StringWidth("☺"); w != 1 {
+		t.Errorf("EastAsian: StringWidth(☺) = %d want 1", w)
+	}
+	if w := c.StringWidth("±"); w != 2 {
+		t.Errorf("EastAsian: StringWidth(±) = %d want 2", w)
+	}
+}
+
+func TestRunewidthBMP(t *testing.T) {
+	for _, eastAsian := range []bool{false, true} {
+		c := &Condition{EastAsian: eastAsian}
+		rc := &runewidth.Condition{EastAsianWidth: eastAsian, StrictEmojiNeutral: true}
+		for r := rune(0xA0); r <= 0xFFFF; r++ {
+			if unicode.Is(unicode.Cf, r) || unicode.Is(unicode.Cs, r) || !unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.P, unicode.S, unicode.Z, unicode.Co) {
+				continue
+			}
+			if w, want := c.RuneWidth(r), rc.RuneWidth(r); w != want {
+				t.Errorf("EastAsian %v: RuneWidth(%U) = %d want %d", eastAsian, r, w, want)
+			}
+		}
+	}
+}
+
+var detectTests = []struct {
+	env  map[string]string
+	wide bool
+}{
+	{map[string]string{"LANG": "ja_JP.UTF-8"}, true},
+	{map[string]string{"LANG": "en_US.UTF-8"}, false},
+	{map[string]string{"LANG": "zh_TW.Big5"}, true},
+	{map[string]string{"LANG": "en_US.eucJP"}, true},
+	{map[string]string{"LANG": "ko_KR.UTF-8@cjk_narrow"}, false},
+	{map[string]string{"LANG": "en_US.UTF-8@cjk_wide"}, true},
+	{map[string]string{"LANG": "ja_JP.UTF-8", "LC_CTYPE": "C"}, false},
+	{map[string]string{"LANG": "en_US.UTF-8", "LC_ALL": "zh_CN.GB18030"}, true},
+	{map[string]string{"LANG": "ja_JP.UTF-8", "TERM": "linux"}, false},
+	{map[string]string{"TERM": "kterm-color"}, true},
+	{map[string]string{}, false},
+	{map[string]string{"RUNEWIDTH_EASTASIAN": "1"}, true},
+	{map[string]string{"RUNEWIDTH_EASTASIAN": "0", "LANG": "ja_JP.UTF-8"}, false},
+	{map[string]string{"RUNEWIDTH_EASTASIAN": "1", "TERM": "linux"}, true},
+	{map[string]string{"RUNEWIDTH_EASTASIAN": "", "LANG": "ja_JP.UTF-8"}, true},
+}
+
+func TestDetectEastAsian(t *testing.T) {
+	// Registered first, so that it runs after t.Setenv restores the
+	// environment.
+	t.Cleanup(func() { AutoDetect() })
+	for _, tt := range detectTests {
+		for _, k := range []string{"RUNEWIDTH_EASTASIAN", "LC_ALL", "LC_CTYPE", "LANG", "TERM"} {
+			t.Setenv(k, tt.env[k])
+		}
+		if got := AutoDetect(); got != tt.wide {
+			t.Errorf("%v: AutoDetect() = %v want %v", tt.env, got, tt.wide)
+		}
+		want := "±  |"
+		if tt.wide {
+			want = "± |"
+		}
+		if got := Sprintf("%-3s|", "±"); got != want {
+			t.Errorf("%v: Sprintf(%%-3s, ±) = %q want %q", tt.env, got, want)
+		}
+	}
+}
+
+var escPosWidthTests = []struct {
+	s     string
+	width int
+}{
+	{"\x1b@TOTAL", 5},
+	{"\x1bE\x01TOTAL\x1bE\x00", 5},
+	{"\x1d!\x10TOTAL\x1d!\x00", 10},
+	{"\x1d!\x11TOTAL", 10},
+	{"\x1d!\x30AB", 8},
+	{"\x1b!\x20AB\x1b!\x00CD", 6},
+	{"\x0eAB\x14CD", 6},
+	{"\x1ba\x01\x1b-\x01AB", 2},
+	{"\x1dV\x42\x00", 0},
+	{"\x1bp\x00\x19\xfa", 0},
+	{"\x1b[1mAB\x1b[0m", 2},
+}
+
+func TestEscPosWidth(t *testing.T) {
+	c := &Condition{EscPos: true}
+	for _, tt := range escPosWidthTests {
+		if w := c.StringWidth(tt.s); w != tt.width {
+			t.Errorf("StringWidth(%+q) = %d want %d", tt.s, w, tt.width)
+		}
+	}
+}
+
+var codePageWidthTests = []struct {
+	codePage int
+	s        string
+	width    int
+}{
+	{932, "é", 1},
+	{932, "×", 2},
+	{932, "─", 2},
+	{932, "ｱｲｳ", 3},
+	{932, "日本", 4},
+	{932, "\U0001F600", 2},
+	{936, "é", 2},
+	{936, "ß", 1},
+	{949, "ß", 2},
+	{950, "é", 1},
+	{65001, "×─", 2},
+	{437, "é", 1},
+}
+
+func TestCodePageWidth(t *testing.T) {
+	for _, tt := range codePageWidthTests {
+		c := &Condition{CodePage: tt.codePage}
+		if w := c.StringWidth(tt.s); w != tt.width {
+			t.Errorf("code page %d: StringWidth(%+q) = %d want %d", tt.codePage, tt.s, w, tt.width)
+		}
+	}
+}
+
+var tabStopTests = []struct {
+	tabWidth int
+	s        string
+	width    int
+}{
+	{0, "a\tb", 9},
+	{0, "\t\t", 16},
+	{0, "abcdefgh\t", 16},
+	{4, "a\tb", 5},
+	{4, "日本\t語", 10},
+}
+
+func TestTabStops(t *testing.T) {
+	for _, tt := range tabStopTests {
+		c := &Condition{TabStops: true, TabWidth: tt.tabWidth}
+		if w := c.StringWidth(tt.s); w != tt.width {
+			t.Errorf("TabWidth %d: StringWidth(%q) = %d want %d", tt.tabWidth, tt.s, w, tt.width)
+		}
+	}
+	pr := Printer{Condition: &Condition{TabStops: true}}
+	if got, want := pr.Sprintf("[%-10s][%10s]", "a\tb", "\t"), "[a\tb ][  \t]"; got != want {
+		t.Errorf("Sprintf = %q want %q", got, want)
+	}
+}
+
+func TestRegisterSequence(t *testing.T) {
+	RegisterSequence("\x1bPtmux;", TmuxPassthrough)
+	RegisterDelimited("\ue000", "\ue001")
+	t.Cleanup(func() {
+		UnregisterSequence("\x1bPtmux;")
+		UnregisterSequence("\ue000")
+	})
+	tests := []struct {
+		s     string
+		width int
+	}{
+		{"\x1bPtmux;\x1b\x1b]1337;SetMark\a\x1b\\ab", 2},
+		{"a\x1bPtmux;\x1b\x1b[1m\x1b\\b", 2},
+		{"\ue000hidden\ue001日本", 4},
+		{"\ue000unterminated", 13},
+	}
+	c := &Condition{}
+	for _, tt := range tests {
+		if w := c.StringWidth(tt.s); w != tt.width {
+			t.Errorf("StringWidth(%+q) = %d want %d", tt.s, w, tt.width)
+		}
+	}
+	pr := Printer{Condition: c}
+	if got, want := pr.Sprintf("%-4s|%.1s", "\ue000x\ue001ab", "\ue000x\ue001cd"), "\ue000x\ue001ab  |\ue000x\ue001c"; got != want {
+		t.Errorf("Sprintf = %+q want %+q", got, want)
+	}
+}
+
+var asciiWidthTests = []struct {
+	s     string
+	width int
+}{
+	{"hello, world", 12},
+	{"abcdefghij日本", 14},
+	{"abcdefghe\u0301tude", 13},
+	{"abcdefg\u200d👍", 8},
+	{"0123456789\x1b[1mab\x1b[0m", 12},
+	{"abcdefg\x7fhijklmn", 14},
+	{"abc\x00defghijk", 11},
+	{"👍🏽abcdefgh", 10},
+	{"x@@<hidden>@@y z", 4},
+}
+
+func TestStringWidthASCII(t *testing.T) {
+	RegisterDelimited("@@<", ">@@")
+	t.Cleanup(func() { UnregisterSequence("@@<") })
+	c := &Condition{}
+	for _, tt := range asciiWidthTests {
+		if w := c.StringWidth(tt.s); w != tt.width {
+			t.Errorf("StringWidth(%+q) = %d want %d", tt.s, w, tt.width)
+		}
+	}
+}
+
+func TestUnregisterSequence(t *testing.T) {
+	RegisterDelimited("@@<", ">@@")
+	UnregisterSequence("@@<")
+	if w := (&Condition{}).StringWidth("x@@<hidden>@@y"); w != 14 {
+		t.Errorf("StringWidth after UnregisterSequence = %d want 14", w)
+	}
+	if n := testing.AllocsPerRun(10, func() { UnregisterSequence("@@<") }); n != 0 {
+		t.Errorf("UnregisterSequence of an unknown prefix made %v allocations", n)
+	}
+}
+
+func BenchmarkStringWidthASCII(b *testing.B) {
+	c := &Condition{}
+	s := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 4)
+	for i := 0; i < b.N; i++ {
+		c.StringWidth(s)
+	}
+}
+
+var truncateTests = []struct {
+	s     string
+	width int
+	tail  string
+	out   string
+}{
+	{"hello", 5, "…", "hello"},
+	{"hello world", 8, "…", "hello w…"},
+	{"hello world", 8, "...", "hello..."},
+	{"日本語のテキスト", 7, "…", "日本語…"},
+	{"日本語のテキスト", 6, "", "日本語"},
+	{"日本語", 1, "", ""},
+	{"abc", 2, "...", "ab"},
+	{"cafe\u0301s", 4, "", "cafe\u0301"},
+	{"ab👍🏽cd", 3, "", "ab"},
+	{"\x1b[31mred text\x1b[0m", 4, "…", "\x1b[31mred\x1b[0m…"},
+}
+
+func TestTruncate(t *testing.T) {
+	c := &Condition{}
+	for _, tt := range truncateTests {
+		if got := c.Truncate(tt.s, tt.width, tt.tail); got != tt.out {
+			t.Errorf("Truncate(%+q, %d, %q) = %+q want %+q", tt.s, tt.width, tt.tail, got, tt.out)
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	c := &Condition{}
+	tests := []struct {
+		got, want string
+	}{
+		{c.PadLeft("42", 6, '·'), "····42"},
+		{c.PadRight("合計", 8, '·'), "合計····"},
+		{c.PadRight("名前", 9, '＿'), "名前＿＿ "},
+		{c.PadLeft("x", 6, '　'), "　　 x"},
+		{c.Center("見出し", 11, '-'), "--見出し---"},
+		{c.Center("toolong", 3, '-'), "toolong"},
+		{c.PadLeft("toolong", 3, '-'), "toolong"},
+	}
+	for i, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%d: got %q want %q", i, tt.got, tt.want)
+		}
+	}
+}
+
+func TestWrapLines(t *testing.T) {
+	c := &Condition{}
+	got := c.WrapLines("Go の幅を考慮した折り返し", 10)
+	want := []string{"Go の幅を", "考慮した折", "り返し"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WrapLines = %q want %q", got, want)
+	}
+	if got, want := c.Wrap("one two", 0), "one two"; got != want {
+		t.Errorf("Wrap at 0 = %q want %q", got, want)
+	}
+}
+
+func TestUnknownWidth(t *testing.T) {
+	const unknown = '͸' // unassigned
+	var reported []rune
+	report := func(r rune) { reported = append(reported, r) }
+	tests := []struct {
+		c    *Condition
+		want int
+	}{
+		{&Condition{}, 1},
+		{&Condition{Unknown: UnknownWide}, 2},
+		{&Condition{Unicode: "15.0.0", Unknown: UnknownWide}, 2},
+		{&Condition{Unknown: UnknownWide, UnknownWidth: func(rune) int { return 0 }}, 0},
+		{&Condition{OnUnknown: report}, 1},
+	}
+	for i, tt := range tests {
+		if got := tt.c.RuneWidth(unknown); got != tt.want {
+			t.Errorf("%d: RuneWidth(%U) = %d want %d", i, unknown, got, tt.want)
+		}
+		// Known characters are not affected.
+		if got := tt.c.StringWidth("a日"); got != 4 {
+			t.Errorf("%d: StringWidth of known characters = %d want 4", i, got)
+		}
+	}
+	if !reflect.DeepEqual(reported, []rune{unknown}) {
+		t.Errorf("OnUnknown reported %U want [%U]", reported, unknown)
+	}
+	pr := Printer{Condition: &Condition{Unknown: UnknownWide}}
+	if got, want := pr.Sprintf("%-4s|", string(unknown)), string(unknown)+"  |"; got != want {
+		t.Errorf("Sprintf = %q want %q", got, want)
+	}
+	if !pr.Features().Has(FeatureUnknownWidth) {
+		t.Errorf("Features() = %v lacks unknown-width", pr.Features())
+	}
+}
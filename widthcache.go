@@ -0,0 +1,79 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"container/list"
+	"sync"
+)
+
+// maxCachedLen is the length in bytes of the longest string a WidthCache
+// keeps: longer strings are seldom repeated, and would crowd out those
+// that are.
+const maxCachedLen = 256
+
+// A WidthCache remembers the widths of the strings a Condition measured
+// most recently, so that measuring the same level names, service names
+// or labels on every line of a log costs a map lookup. It holds a
+// bounded number of strings, evicting the least recently used, and
+// strings longer than 256 bytes are not kept. It is safe for concurrent
+// use, but must only be used by Conditions that measure alike, since
+// the widths it holds depend on the Condition.
+type WidthCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     list.List // of *widthEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type widthEntry struct {
+	s     string
+	width int
+}
+
+// NewWidthCache returns a WidthCache holding at most size strings.
+func NewWidthCache(size int) *WidthCache {
+	if size < 1 {
+		size = 1
+	}
+	return &WidthCache{size: size, entries: make(map[string]*list.Element, size)}
+}
+
+// Len returns the number of strings in the cache.
+func (wc *WidthCache) Len() int {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	return len(wc.entries)
+}
+
+// get returns the width of s if it is in the cache.
+func (wc *WidthCache) get(s string) (width int, ok bool) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	e, ok := wc.entries[s]
+	if !ok {
+		return 0, false
+	}
+	wc.lru.MoveToFront(e)
+	return e.Value.(*widthEntry).width, true
+}
+
+// put adds s and its width to the cache, evicting the least recently
+// used string if it is full. s is copied, as it may be a view of a
+// buffer that is later overwritten.
+func (wc *WidthCache) put(s string, width int) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if _, ok := wc.entries[s]; ok {
+		return
+	}
+	if len(wc.entries) >= wc.size {
+		last := wc.lru.Back()
+		delete(wc.entries, last.Value.(*widthEntry).s)
+		wc.lru.Remove(last)
+	}
+	s = string([]byte(s))
+	wc.entries[s] = wc.lru.PushFront(&widthEntry{s, width})
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt_test
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/lostsnow/wfmt"
+)
+
+func TestWidthCache(t *testing.T) {
+	var unknown int32
+	c := &Condition{
+		Cache:     NewWidthCache(2),
+		OnUnknown: func(rune) { atomic.AddInt32(&unknown, 1) },
+	}
+	for i := 0; i < 3; i++ {
+		if w := c.StringWidth("日本x"); w != 5 {
+			t.Fatalf("StringWidth = %d", w)
+		}
+		if w := c.StringWidth("\u0378"); w != 1 {
+			t.Errorf("StringWidth of an unknown character = %d want 1", w)
+		}
+	}
+	// The unknown character was measured once and then found in the cache.
+	if n := atomic.LoadInt32(&unknown); n != 1 {
+		t.Errorf("OnUnknown called %d times want 1", n)
+	}
+	c.StringWidth("a")
+	if n := c.Cache.Len(); n != 2 {
+		t.Errorf("Len() = %d want 2", n)
+	}
+	// The least recently used string, 日本x, was evicted, not the
+	// unknown character.
+	c.StringWidth("\u0378")
+	if n := atomic.LoadInt32(&unknown); n != 1 {
+		t.Errorf("OnUnknown called %d times after eviction of another string", n)
+	}
+
+	// Long strings are not kept.
+	c.StringWidth(strings.Repeat("x", 300))
+	if n := c.Cache.Len(); n != 2 {
+		t.Errorf("Len() = %d after a long string", n)
+	}
+
+	if d := (&Printer{Condition: c}).Describe(); !strings.Contains(d, "width-cache   2 strings\n") {
+		t.Errorf("Describe() lacks the cache:\n%s", d)
+	}
+}
+
+// Strings measured in the buffer of a Printer are copied into the cache.
+func TestWidthCachePrinter(t *testing.T) {
+	pr := Printer{Condition: &Condition{Cache: NewWidthCache(64)}}
+	for _, s := range []string{"日本", "abcd", "日本", "ab", "日本語"} {
+		got := pr.Sprintf("[%-8s|%s]", s, s)
+		want := (&Printer{Condition: &Condition{}}).Sprintf("[%-8s|%s]", s, s)
+		if got != want {
+			t.Errorf("Sprintf(%q) = %q want %q", s, got, want)
+		}
+		if n, err := pr.Measure("%s", s); err != nil || n != (&Condition{}).StringWidth(s) {
+			t.Errorf("Measure(%q) = %d, %v", s, n, err)
+		}
+	}
+}
+
+func TestWidthCacheConcurrent(t *testing.T) {
+	c := &Condition{Cache: NewWidthCache(4)}
+	labels := []string{"INFO", "警告", "ERROR", "デバッグ", "trace", "致命的"}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				s := labels[(i+j)%len(labels)]
+				if w, want := c.StringWidth(s), (&Condition{}).StringWidth(s); w != want {
+					t.Errorf("StringWidth(%q) = %d want %d", s, w, want)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkWidthCache(b *testing.B) {
+	labels := []string{"情報", "警告", "エラー", "デバッグ"}
+	b.Run("uncached", func(b *testing.B) {
+		c := &Condition{}
+		for i := 0; i < b.N; i++ {
+			c.StringWidth(labels[i%len(labels)])
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		c := &Condition{Cache: NewWidthCache(16)}
+		for i := 0; i < b.N; i++ {
+			c.StringWidth(labels[i%len(labels)])
+		}
+	})
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 The wfmt Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wfmt
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const zwj = 0x200D // ZERO WIDTH JOINER
+
+// isRegionalIndicator reports whether r is one of the letters that pair
+// up into flag emoji.
+func isRegionalIndicator(r rune) bool {
+	return 0x1F1E6 <= r && r <= 0x1F1FF
+}
+
+// extends reports whether r continues the grapheme cluster ending in
+// prev rather than starting a new one: combining marks and other
+// zero-width characters, variation selectors, emoji modifiers and the
+// character after a ZERO WIDTH JOINER do.
+func (c *Condition) extends(prev, r rune) bool {
+	switch {
+	case prev == zwj:
+		return true
+	case 0xFE00 <= r && r <= 0xFE0F, 0x1F3FB <= r && r <= 0x1F3FF:
+		return true
+	case isControl(r) || r == '\t' || r == '\n':
+		return false
+	}
+	return c.RuneWidth(r) == 0
+}
+
+// clusterLen returns the length in bytes of the grapheme cluster at the
+// start of s.
+func (c *Condition) clusterLen(s string) int {
+	r, n := utf8.DecodeRuneInString(s)
+	if n == 0 {
+		return 0
+	}
+	prev, pairs := r, isRegionalIndicator(r)
+	for n < len(s) {
+		next, size := utf8.DecodeRuneInString(s[n:])
+		if pairs && isRegionalIndicator(next) {
+			pairs = false
+		} else if !c.extends(prev, next) {
+			break
+		}
+		prev = next
+		n += size
+	}
+	return n
+}
+
+// clusterWidth returns the number of cells occupied by the grapheme
+// cluster cl: the width of its widest rune, so that an emoji modifier
+// or a second regional indicator adds nothing to the base. A pair of
+// regional indicators is a flag, which terminals show as wide even when
+// the width tables make each letter narrow.
+func (c *Condition) clusterWidth(cl string) int {
+	w := 0
+	for _, r := range cl {
+		if rw := c.RuneWidth(r); rw > w {
+			w = rw
+		}
+	}
+	if r, n := utf8.DecodeRuneInString(cl); w < 2 && isRegionalIndicator(r) && len(cl) > n {
+		w = 2
+	}
+	return w
+}
+
+// wrapToken is a word, a run of spaces or a wide cluster, which may be
+// broken before and after.
+type wrapToken struct {
+	text  string
+	width int
+	space bool
+}
+
+// wrapTokens splits a line into the tokens between which it may be
+// broken: at spaces and before and after wide characters.
+func (c *Condition) wrapTokens(line string) []wrapToken {
+	var toks []wrapToken
+	start, width, scale := 0, 0, 1
+	flush := func(end int) {
+		if end > start {
+			toks = append(toks, wrapToken{text: line[start:end], width: width})
+		}
+		start, width = end, 0
+	}
+	for i := 0; i < len(line); {
+		if n := c.seqLen(line[i:], &scale); n > 0 {
+			i += n
+			continue
+		}
+		if b := line[i]; b == ' ' || b == '\t' {
+			flush(i)
+			j := i
+			for j < len(line) && (line[j] == ' ' || line[j] == '\t') {
+				j++
+			}
+			toks = append(toks, wrapToken{text: line[i:j], width: j - i, space: true})
+			start, i = j, j
+			continue
+		}
+		n := c.clusterLen(line[i:])
+		w := scale * c.clusterWidth(line[i:i+n])
+		if w > scale {
+			flush(i)
+			toks = append(toks, wrapToken{text: line[i : i+n], width: w})
+			start = i + n
+		} else {
+			width += w
+		}
+		i += n
+	}
+	flush(len(line))
+	return toks
+}
+
+// Wrap returns s soft-wrapped at width cells. Lines are broken at
+// spaces, which are dropped at the break, and before and after wide
+// characters such as CJK ideographs; a word longer than a line is
+// broken between grapheme clusters. A width of zero or less leaves s
+// unchanged.
+func (c *Condition) Wrap(s string, width int) string {
+	if width <= 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for li, line := range strings.Split(s, "\n") {
+		if li > 0 {
+			b.WriteByte('\n')
+		}
+		c.wrapLine(&b, c.wrapTokens(line), width)
+	}
+	return b.String()
+}
+
+// wrapLine writes the tokens of a line to b, breaking it at width cells
+// as described for Wrap.
+func (c *Condition) wrapLine(b *strings.Builder, toks []wrapToken, width int) {
+	col, pending := 0, wrapToken{}
+	for _, tok := range toks {
+		if tok.space {
+			pending = tok
+			continue
+		}
+		if col > 0 && col+pending.width+tok.width > width {
+			b.WriteByte('\n')
+			col = 0
+		} else {
+			b.WriteString(pending.text)
+			col += pending.width
+		}
+		pending = wrapToken{}
+		if tok.width <= width {
+			b.WriteString(tok.text)
+			col += tok.width
+			continue
+		}
+		// Break an overlong word between clusters.
+		for i, scale := 0, 1; i < len(tok.text); {
+			if n := c.seqLen(tok.text[i:], &scale); n > 0 {
+				b.WriteString(tok.text[i : i+n])
+				i += n
+				continue
+			}
+			n := c.clusterLen(tok.text[i:])
+			w := scale * c.clusterWidth(tok.text[i:i+n])
+			if col > 0 && col+w > width {
+				b.WriteByte('\n')
+				col = 0
+			}
+			b.WriteString(tok.text[i : i+n])
+			col += w
+			i += n
+		}
+	}
+	if col+pending.width <= width {
+		b.WriteString(pending.text)
+	}
+}
+
+// WrapLines is like Wrap but returns the wrapped lines.
+func (c *Condition) WrapLines(s string, width int) []string {
+	return strings.Split(c.Wrap(s, width), "\n")
+}
+
+// Wrap returns s soft-wrapped at width cells under the DefaultCondition.
+// See Condition.Wrap.
+func Wrap(s string, width int) string {
+	return DefaultCondition.Wrap(s, width)
+}
+
+// WrapLines returns the lines of s soft-wrapped at width cells under the
+// DefaultCondition. See Condition.Wrap.
+func WrapLines(s string, width int) []string {
+	return DefaultCondition.WrapLines(s, width)
+}